@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// AddressType is a kind of address registered in addressTypes
+type AddressType int
+
+const (
+	AddressP2PKH  AddressType = iota // Base58Check pay to public key hash
+	AddressP2SH                      // Base58Check pay to script hash
+	AddressP2WPKH                    // Bech32 version 0 witness program of a public key hash
+)
+
+// Human-readable parts of the Bech32 addresses
+const (
+	MainnetBech32HRP = "bc"
+	TestnetBech32HRP = "tb"
+	RegtestBech32HRP = "bcrt"
+)
+
+var (
+	ErrEmptyAddress       = errors.New("empty address")
+	ErrAddressChecksum    = errors.New("invalid address checksum")
+	ErrAddressLength      = errors.New("invalid address length")
+	ErrAddressNetwork     = errors.New("address of another network")
+	ErrUnknownAddressType = errors.New("unknown address type")
+	ErrAddressTypeExists  = errors.New("address type already registered")
+)
+
+// AddressTypeInfo describes the encoding of an address type and the
+// locking script of the outputs paying to it
+type AddressTypeInfo struct {
+	Name     string
+	Bech32   bool // Bech32 witness address, or Base58Check address
+	Version  byte // witness version, or Base58Check version byte
+	HashSize int  // size of the hash or witness program
+	Script   func(hash []byte) Script
+}
+
+// addressTypes is the registry of the known address types
+var addressTypes = map[AddressType]AddressTypeInfo{
+	AddressP2PKH:  {Name: "p2pkh", Version: netParams.PubKeyHashAddrID, HashSize: 20, Script: P2PKHScript},
+	AddressP2SH:   {Name: "p2sh", Version: netParams.ScriptHashAddrID, HashSize: 20, Script: P2SHScript},
+	AddressP2WPKH: {Name: "p2wpkh", Bech32: true, Version: 0, HashSize: 20, Script: P2WPKHScript},
+}
+
+// RegisterAddressType adds an address type to the registry. Its encoding
+// must not be ambiguous with the encoding of a registered type.
+func RegisterAddressType(t AddressType, info AddressTypeInfo) error {
+	if _, ok := addressTypes[t]; ok {
+		return ErrAddressTypeExists
+	}
+	if _, ok := findAddressType(info.Bech32, info.Version, info.HashSize); ok {
+		return ErrAddressTypeExists
+	}
+	addressTypes[t] = info
+	return nil
+}
+
+// setAddressVersions sets the Base58Check versions of the network
+func setAddressVersions(params NetworkParams) {
+	for t, version := range map[AddressType]byte{AddressP2PKH: params.PubKeyHashAddrID, AddressP2SH: params.ScriptHashAddrID} {
+		info := addressTypes[t]
+		info.Version = version
+		addressTypes[t] = info
+	}
+}
+
+// findAddressType returns the registered type of an encoding
+func findAddressType(bech32 bool, version byte, hashSize int) (AddressType, bool) {
+	for t, info := range addressTypes {
+		if info.Bech32 == bech32 && info.Version == version && info.HashSize == hashSize {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// String returns the name of the address type
+func (t AddressType) String() string {
+	if info, ok := addressTypes[t]; ok {
+		return info.Name
+	}
+	return "unknown"
+}
+
+// Address is a decoded address: its type and the hash it pays to
+type Address struct {
+	Type AddressType
+	Hash []byte // public key hash, script hash or witness program
+}
+
+// NewAddress returns the address of the type paying to the hash
+func NewAddress(t AddressType, hash []byte) (*Address, error) {
+	info, ok := addressTypes[t]
+	if !ok {
+		return nil, ErrUnknownAddressType
+	}
+	if len(hash) != info.HashSize {
+		return nil, ErrAddressLength
+	}
+	return &Address{Type: t, Hash: hash}, nil
+}
+
+// ParseAddress decodes a Base58Check or Bech32 address of the network in
+// use, checking its checksum, its type and the size of its hash
+func ParseAddress(address string) (*Address, error) {
+	if len(address) == 0 {
+		return nil, ErrEmptyAddress
+	}
+	if hrp, witnessVersion, program, err := DecodeWitnessAddress(address); err == nil {
+		if hrp != netParams.Bech32HRP {
+			return nil, ErrAddressNetwork
+		}
+		t, ok := findAddressType(true, witnessVersion, len(program))
+		if !ok {
+			return nil, ErrUnknownAddressType
+		}
+		return &Address{Type: t, Hash: program}, nil
+	} else if strings.HasPrefix(strings.ToLower(address), netParams.Bech32HRP+string(bech32Separator)) {
+		// an address of the network failing to decode as Bech32
+		return nil, err
+	}
+	decoded, err := Base58Decode([]byte(address))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) <= 1+addressChecksumLen {
+		return nil, ErrAddressLength
+	}
+	payload := decoded[:len(decoded)-addressChecksumLen]
+	if !bytes.Equal(checksum(payload), decoded[len(decoded)-addressChecksumLen:]) {
+		return nil, ErrAddressChecksum
+	}
+	for t, info := range addressTypes {
+		if !info.Bech32 && info.Version == payload[0] {
+			if len(payload)-1 != info.HashSize {
+				return nil, ErrAddressLength
+			}
+			return &Address{Type: t, Hash: payload[1:]}, nil
+		}
+	}
+	for _, params := range []NetworkParams{MainnetParams, TestnetParams, RegtestParams} {
+		if payload[0] == params.PubKeyHashAddrID || payload[0] == params.ScriptHashAddrID {
+			return nil, ErrAddressNetwork
+		}
+	}
+	return nil, ErrUnknownAddressType
+}
+
+// String returns the encoding of the address
+func (a *Address) String() string {
+	info := addressTypes[a.Type]
+	if info.Bech32 {
+		address, _ := EncodeWitnessAddress(netParams.Bech32HRP, info.Version, a.Hash)
+		return address
+	}
+	return string(encodeAddress(info.Version, a.Hash))
+}
+
+// LockingScript returns the locking script of the outputs paying to the address
+func (a *Address) LockingScript() Script {
+	return addressTypes[a.Type].Script(a.Hash)
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"math/big"
 )
 
+var ErrInvalidBase58 = errors.New("invalid base58 string")
+
 // excluding: 0 (zero), O (capital o), I (capital i), l (lowercase L),
 var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
 
@@ -23,9 +26,12 @@ func Base58Encode(input []byte) []byte {
 		result = append(result, b58Alphabet[mod.Int64()])
 	}
 
-	// Append bitcoin pubkey hash leading symbol
+	// Append bitcoin pubkey hash leading symbol, once per leading zero byte
 	// https://en.bitcoin.it/wiki/Base58Check_encoding#Version_bytes
-	if input[0] == 0x00 {
+	for _, b := range input {
+		if b != 0x00 {
+			break
+		}
 		result = append(result, b58Alphabet[0])
 	}
 
@@ -35,20 +41,27 @@ func Base58Encode(input []byte) []byte {
 }
 
 // Base58Decode decodes Base58-encoded data
-func Base58Decode(input []byte) []byte {
+func Base58Decode(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return nil, ErrInvalidBase58
+	}
 	result := big.NewInt(0)
 
 	for _, b := range input {
 		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, ErrInvalidBase58
+		}
 		result.Mul(result, big.NewInt(58))
 		result.Add(result, big.NewInt(int64(charIndex)))
 	}
 
 	decoded := result.Bytes()
 
-	if input[0] == b58Alphabet[0] {
+	// each leading symbol is a leading zero byte
+	for i := 0; i < len(input) && input[i] == b58Alphabet[0]; i++ {
 		decoded = append([]byte{0x00}, decoded...)
 	}
 
-	return decoded
+	return decoded, nil
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bech32 (BIP173) and Bech32m (BIP350) encodings: a human-readable part
+// naming the network, the separator '1', data in 5-bit groups and a
+// 6-character checksum detecting any error affecting up to 4 characters.
+// https://github.com/bitcoin/bips/blob/master/bip-0173.mediawiki
+// https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki
+
+// Bech32Encoding selects the checksum constant of the encoding
+type Bech32Encoding int
+
+const (
+	Bech32  Bech32Encoding = iota // witness version 0 addresses
+	Bech32m                       // witness version 1 and above addresses
+)
+
+const (
+	bech32Charset   = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Const     = 1
+	bech32mConst    = 0x2bc830a3
+	bech32MaxLength = 90
+	bech32Separator = '1'
+
+	maxWitnessVersion    = 16
+	minWitnessProgramLen = 2
+	maxWitnessProgramLen = 40
+)
+
+var (
+	ErrBech32Length    = errors.New("invalid bech32 string length")
+	ErrBech32Case      = errors.New("mixed case bech32 string")
+	ErrBech32Char      = errors.New("invalid bech32 character")
+	ErrBech32Separator = errors.New("missing bech32 separator")
+	ErrBech32Checksum  = errors.New("invalid bech32 checksum")
+	ErrBech32Padding   = errors.New("invalid bech32 padding")
+	ErrWitnessVersion  = errors.New("invalid witness version")
+	ErrWitnessProgram  = errors.New("invalid witness program length")
+)
+
+// bech32Polymod returns the BCH checksum of the 5-bit values
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand returns the human-readable part as checksummed values
+func bech32HRPExpand(hrp string) []byte {
+	values := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return values
+}
+
+func (enc Bech32Encoding) constant() uint32 {
+	if enc == Bech32m {
+		return bech32mConst
+	}
+	return bech32Const
+}
+
+// Bech32Encode encodes the 5-bit values with the human-readable part
+func Bech32Encode(hrp string, data []byte, enc Bech32Encoding) (string, error) {
+	if len(hrp) == 0 || len(hrp)+len(data)+7 > bech32MaxLength {
+		return "", ErrBech32Length
+	}
+	hrp = strings.ToLower(hrp)
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", ErrBech32Char
+		}
+	}
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ enc.constant()
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte(bech32Separator)
+	for _, v := range data {
+		if v > 31 {
+			return "", ErrBech32Char
+		}
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+// Bech32Decode returns the human-readable part, the 5-bit values and the
+// encoding of a Bech32 or Bech32m string
+func Bech32Decode(s string) (string, []byte, Bech32Encoding, error) {
+	if len(s) < 8 || len(s) > bech32MaxLength {
+		return "", nil, 0, ErrBech32Length
+	}
+	lower, upper := strings.ToLower(s), strings.ToUpper(s)
+	if s != lower && s != upper {
+		return "", nil, 0, ErrBech32Case
+	}
+	s = lower
+	pos := strings.LastIndexByte(s, bech32Separator)
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, ErrBech32Separator
+	}
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, ErrBech32Char
+		}
+	}
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, 0, ErrBech32Char
+		}
+		data = append(data, byte(v))
+	}
+	var enc Bech32Encoding
+	switch bech32Polymod(append(bech32HRPExpand(hrp), data...)) {
+	case bech32Const:
+		enc = Bech32
+	case bech32mConst:
+		enc = Bech32m
+	default:
+		return "", nil, 0, ErrBech32Checksum
+	}
+	return hrp, data[:len(data)-6], enc, nil
+}
+
+// convertBits regroups the bits of the values, e.g. bytes to 5-bit values
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<toBits - 1
+	result := []byte{}
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, ErrBech32Char
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, ErrBech32Padding
+	}
+	return result, nil
+}
+
+// EncodeWitnessAddress returns the Bech32 (version 0) or Bech32m (version 1
+// and above) address of the witness program
+func EncodeWitnessAddress(hrp string, version byte, program []byte) (string, error) {
+	if err := checkWitnessProgram(version, program); err != nil {
+		return "", err
+	}
+	enc := Bech32
+	if version > 0 {
+		enc = Bech32m
+	}
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return Bech32Encode(hrp, append([]byte{version}, data...), enc)
+}
+
+// DecodeWitnessAddress returns the human-readable part, the witness version
+// and the witness program of a Bech32 or Bech32m address
+func DecodeWitnessAddress(address string) (string, byte, []byte, error) {
+	hrp, data, enc, err := Bech32Decode(address)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if len(data) == 0 {
+		return "", 0, nil, ErrWitnessVersion
+	}
+	version := data[0]
+	if (version == 0) != (enc == Bech32) {
+		return "", 0, nil, ErrBech32Checksum
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if err := checkWitnessProgram(version, program); err != nil {
+		return "", 0, nil, err
+	}
+	return hrp, version, program, nil
+}
+
+// checkWitnessProgram checks the version and the length of a witness program
+func checkWitnessProgram(version byte, program []byte) error {
+	if version > maxWitnessVersion {
+		return ErrWitnessVersion
+	}
+	if len(program) < minWitnessProgramLen || len(program) > maxWitnessProgramLen ||
+		(version == 0 && len(program) != 20 && len(program) != 32) {
+		return ErrWitnessProgram
+	}
+	return nil
+}
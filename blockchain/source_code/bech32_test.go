@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test vectors of BIP173 and BIP350
+func TestBech32Vectors(t *testing.T) {
+	tests := []struct {
+		s   string
+		enc Bech32Encoding
+	}{
+		{"A12UEL5L", Bech32},
+		{"a12uel5l", Bech32},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", Bech32},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", Bech32},
+		{"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", Bech32},
+		{"?1ezyfcl", Bech32},
+		{"A1LQFN3A", Bech32m},
+		{"a1lqfn3a", Bech32m},
+		{"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6", Bech32m},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", Bech32m},
+		{"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", Bech32m},
+		{"?1v759aa", Bech32m},
+	}
+	for _, test := range tests {
+		hrp, data, enc, err := Bech32Decode(test.s)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+		if enc != test.enc {
+			t.Errorf("%s: got encoding %d, want %d", test.s, enc, test.enc)
+		}
+		encoded, err := Bech32Encode(hrp, data, enc)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+		diff(t, strings.ToLower(test.s), encoded, "encoding of "+test.s)
+	}
+}
+
+func TestBech32Invalid(t *testing.T) {
+	tests := []struct {
+		s    string
+		want error
+	}{
+		{"\x201nwldj5", ErrBech32Char},
+		{"\x7f1axkwrx", ErrBech32Char},
+		{"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx", ErrBech32Length},
+		{"pzry9x0s0muk", ErrBech32Separator},
+		{"1pzry9x0s0muk", ErrBech32Separator},
+		{"x1b4n0q5v", ErrBech32Char},
+		{"li1dgmt3", ErrBech32Separator},
+		{"A1G7SGD8", ErrBech32Checksum},
+		{"10a06t8", ErrBech32Length},
+		{"1qzzfhee", ErrBech32Separator},
+		{"M1VUXWEZ", ErrBech32Checksum},
+		{"16plkw9", ErrBech32Length},
+		{"1p2gdwpf", ErrBech32Separator},
+		{"a12UEL5L", ErrBech32Case},
+	}
+	for _, test := range tests {
+		if _, _, _, err := Bech32Decode(test.s); err != test.want {
+			t.Errorf("%q: got %v, want %v", test.s, err, test.want)
+		}
+	}
+}
+
+func TestWitnessAddressVectors(t *testing.T) {
+	tests := []struct {
+		address string
+		hrp     string
+		version byte
+		program string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "bc", 0, "751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "tb", 0, "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "bc", 1, "751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", "bc", 16, "751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "bc", 2, "751e76e8199196d454941c45d1b3a323"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "tb", 1, "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "bc", 1, "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for _, test := range tests {
+		hrp, version, program, err := DecodeWitnessAddress(test.address)
+		if err != nil {
+			t.Errorf("%s: %v", test.address, err)
+			continue
+		}
+		diff(t, test.hrp, hrp, "hrp of "+test.address)
+		diff(t, test.version, version, "version of "+test.address)
+		diff(t, test.program, Bytes2Hex(program), "program of "+test.address)
+		address, err := EncodeWitnessAddress(hrp, version, program)
+		if err != nil {
+			t.Errorf("%s: %v", test.address, err)
+			continue
+		}
+		diff(t, strings.ToLower(test.address), address, "encoding of "+test.address)
+	}
+}
+
+func TestWitnessAddressInvalid(t *testing.T) {
+	tests := []struct {
+		address string
+		want    error
+	}{
+		// version 1 with the Bech32 checksum
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", ErrBech32Checksum},
+		// version 16 with the Bech32 checksum
+		{"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL", ErrBech32Checksum},
+		// version 0 with the Bech32m checksum
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", ErrBech32Checksum},
+		{"bc1gmk9yu", ErrWitnessVersion},
+		{"bc1rw5uspcuh", ErrBech32Checksum},
+		{"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", ErrWitnessProgram},
+		{"bc1pw5dgrnzv", ErrWitnessProgram},
+	}
+	for _, test := range tests {
+		if _, _, _, err := DecodeWitnessAddress(test.address); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.address, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// DefaultEntropyBits is the entropy of the generated mnemonics (12 words)
+	DefaultEntropyBits = 128
+	// SeedSize is the size of the seeds derived from mnemonics
+	SeedSize            = 64
+	mnemonicIterations  = 2048
+	mnemonicSaltPrefix  = "mnemonic"
+	mnemonicBitsPerWord = 11
+)
+
+var (
+	ErrInvalidEntropy  = errors.New("entropy must be 128 to 256 bits, a multiple of 32")
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+	ErrMnemonicWord    = errors.New("mnemonic word not in the word list")
+	ErrMnemonicSum     = errors.New("invalid mnemonic checksum")
+)
+
+// bip39WordIndex maps the words of the word list to their index
+var bip39WordIndex = func() map[string]int {
+	index := make(map[string]int, len(bip39WordList))
+	for i, word := range bip39WordList {
+		index[word] = i
+	}
+	return index
+}()
+
+// NewEntropy returns random entropy of the given size in bits
+func NewEntropy(bits int) ([]byte, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return nil, ErrInvalidEntropy
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+	return entropy, nil
+}
+
+// NewMnemonic returns the BIP39 mnemonic encoding the entropy: the entropy
+// followed by the first bits of its sha256, split in groups of 11 bits
+// indexing the word list
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", ErrInvalidEntropy
+	}
+	hash := sha256.Sum256(entropy)
+	data := append(append([]byte{}, entropy...), hash[0])
+	words := make([]string, (bits+bits/32)/mnemonicBitsPerWord)
+	for i := range words {
+		index := 0
+		for b := i * mnemonicBitsPerWord; b < (i+1)*mnemonicBitsPerWord; b++ {
+			index = index<<1 | int(data[b/8]>>(7-uint(b%8))&1)
+		}
+		words[i] = bip39WordList[index]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy returns the entropy encoded by the mnemonic,
+// checking its words and checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrInvalidMnemonic
+	}
+	totalBits := len(words) * mnemonicBitsPerWord
+	sumBits := totalBits / 33
+	data := make([]byte, (totalBits+7)/8)
+	for i, word := range words {
+		index, ok := bip39WordIndex[strings.ToLower(word)]
+		if !ok {
+			return nil, ErrMnemonicWord
+		}
+		for b := 0; b < mnemonicBitsPerWord; b++ {
+			if index>>(mnemonicBitsPerWord-1-b)&1 == 1 {
+				pos := i*mnemonicBitsPerWord + b
+				data[pos/8] |= 1 << (7 - uint(pos%8))
+			}
+		}
+	}
+	entropy := data[:(totalBits-sumBits)/8]
+	hash := sha256.Sum256(entropy)
+	mask := byte(0xff) << (8 - uint(sumBits))
+	if data[len(entropy)]&mask != hash[0]&mask {
+		return nil, ErrMnemonicSum
+	}
+	return append([]byte{}, entropy...), nil
+}
+
+// ValidateMnemonic checks the words and the checksum of the mnemonic
+func ValidateMnemonic(mnemonic string) bool {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err == nil
+}
+
+// NewSeed returns the seed of the mnemonic protected by the passphrase:
+// PBKDF2-HMAC-SHA512 of the mnemonic, salted with "mnemonic" and the
+// passphrase. Words and passphrase are expected to be NFKD normalized,
+// which is a no-op for ASCII.
+func NewSeed(mnemonic, passphrase string) []byte {
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normalized), []byte(mnemonicSaltPrefix+passphrase), mnemonicIterations, SeedSize, sha512.New)
+}
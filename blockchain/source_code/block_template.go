@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+)
+
+// BlockTemplate represents a non-mined block on top of the current
+// block, ready to be handed out to miners
+type BlockTemplate struct {
+	Block  *Block
+	header []byte
+}
+
+// NewBlockTemplate builds a block template with the valid transactions
+// among the given ones, the first one being usually the coinbase
+func (bc *Blockchain) NewBlockTemplate(transactions []*Transaction) (*BlockTemplate, error) {
+	// Discard invalid transactions that make reference to unknown inputs
+	// and the transactions still locked at the height of the block. A
+	// transaction may spend the outputs of the previous valid ones.
+	height := len(bc.blocks)
+	validTx := []*Transaction{}
+	for _, tx := range transactions {
+		if bc.verifyTransaction(tx, nil, validTx) && bc.CheckTransactionLocks(tx, height) == nil {
+			validTx = append(validTx, tx)
+		}
+	}
+	if len(validTx) == 0 {
+		return nil, ErrNoValidTx
+	}
+	block := NewBlock(time.Now().Unix(), validTx, bc.CurrentBlock().Hash)
+	return &BlockTemplate{Block: block, header: NewProofOfWork(block).setupHeader()}, nil
+}
+
+// Header returns the header of the template without the nonce
+func (t *BlockTemplate) Header() []byte {
+	return t.header
+}
+
+// Hash returns the header hash for the given nonce
+func (t *BlockTemplate) Hash(nonce int) []byte {
+	return hashHeader(t.header, nonce)
+}
+
+// Solve returns a mined copy of the template block if the nonce
+// satisfies the network target
+func (t *BlockTemplate) Solve(nonce int) (*Block, bool) {
+	hash := t.Hash(nonce)
+	if !hashMeetsTarget(hash, targetFromBits(netParams.TargetBits)) {
+		return nil, false
+	}
+	block := *t.Block
+	block.Nonce = nonce
+	block.Hash = hash
+	return &block, true
+}
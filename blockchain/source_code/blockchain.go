@@ -3,13 +3,10 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"errors"
 	"fmt"
-	"math/big"
 	"reflect"
 	"strings"
-	"time"
 )
 
 var (
@@ -21,22 +18,41 @@ var (
 
 // Blockchain keeps a sequence of Blocks
 type Blockchain struct {
-	blocks []*Block
+	blocks    []*Block
+	txHeights map[string]int // hex ID -> height of the block containing the transaction
 }
 
-// NewBlockchain creates a new blockchain with genesis Block
-func NewBlockchain(address string) (*Blockchain, error) {
-	timeStamp:=time.Now().Unix()
-	genesisTransaction,err:=NewCoinbaseTX(address,"")
-	genesisBlock:=NewGenesisBlock(timeStamp,genesisTransaction)
-	genesisBlock.Mine()
-	return &Blockchain{blocks:[]*Block{genesisBlock}},err
+// NewBlockchain creates a new blockchain with the genesis Block of the
+// network in use, checked against the network parameters. It no longer
+// takes the address paid by the genesis coinbase, as the genesis block
+// is fixed per network.
+func NewBlockchain() (*Blockchain, error) {
+	if err:=VerifyGenesisBlock(netParams); err!=nil {
+		return nil, err
+	}
+	bc:=&Blockchain{}
+	bc.appendBlock(GenesisBlock(netParams))
+	return bc,nil
+}
+
+// appendBlock appends the block to the blockchain and indexes the height
+// of its transactions
+func (bc *Blockchain) appendBlock(block *Block) {
+	if bc.txHeights == nil {
+		bc.txHeights = make(map[string]int)
+	}
+	for _, tx := range block.Transactions {
+		if _, ok := bc.txHeights[Bytes2Hex(tx.ID)]; !ok {
+			bc.txHeights[Bytes2Hex(tx.ID)] = len(bc.blocks)
+		}
+	}
+	bc.blocks = append(bc.blocks, block)
 }
 
 // addBlock saves the block into the blockchain
 func (bc *Blockchain) addBlock(block *Block) error {
 	if bc.ValidateBlock(block) { 
-		bc.blocks = append(bc.blocks,block)
+		bc.appendBlock(block)
 		return nil
 	}
 	return ErrInvalidBlock
@@ -62,79 +78,179 @@ func (bc Blockchain) GetBlock(hash []byte) (*Block, error) {
 	return nil, ErrBlockNotFound
 }
 
-// ValidateBlock validates the block before adding it to the blockchain
+// ValidateBlock validates the block before adding it on top of the
+// blockchain: its proof of work, lock times and coinbase, and the
+// signatures and spent outputs of its transactions
 func (bc *Blockchain) ValidateBlock(block *Block) bool {
+	if block == nil {
+		return false
+	}
 	pow :=NewProofOfWork(block)
-	if block!=nil&& len(block.Transactions)!=0 && pow.Validate()  { 
+	if len(block.Transactions)!=0 && pow.Validate() && bc.checkBlockLocks(block) == nil && bc.checkCoinbase(block) == nil && bc.VerifyBlockTransactions(block) { 
 		return true
 	}
 	return false
 }
 
+// blockHeight returns the height of a block on top of its previous block
+func (bc *Blockchain) blockHeight(block *Block) int {
+	for height, b := range bc.blocks {
+		if bytes.Equal(b.Hash, block.PrevBlockHash) {
+			return height + 1
+		}
+	}
+	return len(bc.blocks)
+}
+
+// checkCoinbase checks that the coinbase transactions of the block
+// pay at most the subsidy at its height and the fees of the block
+func (bc *Blockchain) checkCoinbase(block *Block) error {
+	value := 0
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			continue
+		}
+		for _, out := range tx.Vout {
+			value += out.Value
+		}
+	}
+	if value > netParams.BlockSubsidy(bc.blockHeight(block))+bc.blockFees(block) {
+		return ErrCoinbaseValue
+	}
+	return nil
+}
+
+// blockFees returns the fees of the transactions of the block, which may
+// spend the outputs of the previous transactions of the block
+func (bc *Blockchain) blockFees(block *Block) int {
+	fees := 0
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		prevTXs, err := bc.inputTXsOf(tx, block.Transactions[:i])
+		if err != nil {
+			continue
+		}
+		if fee, err := tx.Fee(prevTXs); err == nil {
+			fees += fee
+		}
+	}
+	return fees
+}
+
+// checkBlockLocks checks that the lock times of all the transactions of
+// the block are satisfied at its height
+func (bc *Blockchain) checkBlockLocks(block *Block) error {
+	height := bc.blockHeight(block)
+	for _, tx := range block.Transactions {
+		if err := bc.CheckTransactionLocks(tx, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // MineBlock mines a new block with the provided transactions
 func (bc *Blockchain) MineBlock(transactions []*Transaction) (*Block, error) {
 	// 1) Verify the existence of transactions inputs and discard invalid transactions that make reference to unknown inputs
 	// 2) Add a block if there is a list of valid transactions
-	validTx:=[]*Transaction{}
-	for _, tx := range transactions {
-		if bc.VerifyTransaction(tx){
-			validTx=append(validTx,tx)
-		}
+	template, err := bc.NewBlockTemplate(transactions)
+	if err != nil {
+		return nil, err
 	}
-	if len(validTx)==0{
-		return nil, ErrNoValidTx
-	}
-
-	//newblock with the valid transactions, mine and add to blockchain
-	timestamp:=time.Now().Unix()
-	currentBlock :=bc.CurrentBlock()
-	prevBlockHash:=currentBlock.Hash
-	block:=NewBlock(timestamp,validTx,prevBlockHash)
+	block := template.Block
 	block.Mine()
-	bc.blocks= append(bc.blocks,block)
+	bc.appendBlock(block)
 	return block, nil
 }
 
 // VerifyTransaction verifies transaction input signatures
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
+	return bc.verifyTransaction(tx, nil, nil)
+}
+
+// VerifyBlockTransactions verifies all the transactions of a block, their
+// Schnorr signatures being verified at once. If the batch fails, the
+// transactions are verified one by one. A transaction may spend the
+// outputs of the previous transactions of the block.
+func (bc *Blockchain) VerifyBlockTransactions(block *Block) bool {
+	batch := NewSchnorrBatch()
+	for i, tx := range block.Transactions {
+		if !bc.verifyTransaction(tx, batch, block.Transactions[:i]) {
+			return false
+		}
+	}
+	if batch.Verify() {
+		return true
+	}
+	for i, tx := range block.Transactions {
+		if !bc.verifyTransaction(tx, nil, block.Transactions[:i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyTransaction verifies the transaction, adding its Schnorr signatures
+// to the batch, if any, instead of verifying them. The transaction may
+// spend the outputs of the pending transactions, not mined yet, e.g. the
+// previous transactions of its block or the ones of the mempool.
+func (bc *Blockchain) verifyTransaction(tx *Transaction, batch *SchnorrBatch, pending []*Transaction) bool {
 	
 	//1)extract all unspent outputs to build UTXOset according to the blockchain state.
 	u:=bc.FindUTXOSet()
+	u.Update(pending)
 	//2)
+	//check the size and value of the data carrier outputs
+	if err := tx.CheckDataOutputs(); err != nil {
+		fmt.Println("-----invalid data output")
+		return false
+	}
 	//check if it is a coinbase transaction, return true
-	if tx.IsCoinbase(){			
+	//if it carries no token nor NFT
+	if tx.IsCoinbase(){
+		if tx.CheckTokens(nil) != nil || tx.CheckNFTs(nil) != nil {
+			fmt.Println("-----invalid tokens")
+			return false
+		}
 		return true
 	}
-	//check if it is not in UTXOset, return false
+	//check if it is not in UTXOset or spent twice by the transaction, return false
+	spent:=make(map[string]bool)
 	for _, txInput := range tx.Vin{
-
+		if spent[outpoint(txInput)] {
+			fmt.Println("-----output spent twice")
+			return false
+		}
+		spent[outpoint(txInput)]=true
 		txInputTxidString:=fmt.Sprintf("%x", txInput.Txid)
 		if reflect.DeepEqual(u[txInputTxidString][txInput.OutIdx], TXOutput{}){		
 			fmt.Println("-----not in UTXOset")
 			return false
 		}
 	}
-	//3)verify the signature of the given transaction
-	txCopy:=tx.TrimmedCopy()
-	curveForSign:= elliptic.P256()
-
-	for _,input:=range tx.Vin{
-		//recovering the R and S byte fields of the Signature
-		length:=len(input.Signature)
-		r:= new(big.Int).SetBytes(input.Signature[:length/2])
-		s:= new(big.Int).SetBytes(input.Signature[length/2:])
-		//recovering X and Y fields of the PubKey from the inputs of tx
-		length=len(input.PubKey)
-		x:= new(big.Int).SetBytes(input.PubKey[:length/2])
-		y:= new(big.Int).SetBytes(input.PubKey[length/2:])
-
-		ecdsaPubKey:=ecdsa.PublicKey{curveForSign, x, y}
-		if !ecdsa.Verify(&ecdsaPubKey, txCopy.Serialize(), r, s) {
-			fmt.Println("-----signature not correct")
-			return false
-		}	
+	//3)verify the unlocking scripts and signatures of the given transaction
+	prevTXs, err := bc.inputTXsOf(tx, pending)
+	if err != nil || !tx.verify(prevTXs, batch) {
+		fmt.Println("-----signature not correct")
+		return false
+	}
+	//the outputs cannot pay more than the inputs
+	if _, err := tx.Fee(prevTXs); err != nil {
+		fmt.Println("-----outputs exceed inputs")
+		return false
+	}
+	//4)check that the tokens are only issued, transferred or burned
+	if err := tx.CheckTokens(prevTXs); err != nil {
+		fmt.Println("-----invalid tokens")
+		return false
+	}
+	//5)check that the NFTs are only minted by their issuer and moved whole
+	if err := tx.CheckNFTs(prevTXs); err != nil {
+		fmt.Println("-----invalid NFTs")
+		return false
 	}
-	
 	return true
 }
 
@@ -176,6 +292,30 @@ func (bc *Blockchain) GetInputTXsOf(tx *Transaction) (map[string]*Transaction, e
 	return txMap, nil
 }
 
+// inputTXsOf returns the transactions used as inputs in the given
+// transaction, found in the pending transactions or in the blockchain
+func (bc *Blockchain) inputTXsOf(tx *Transaction, pending []*Transaction) (map[string]*Transaction, error) {
+	txMap := make(map[string]*Transaction)
+	for _, input := range tx.Vin {
+		id := Bytes2Hex(input.Txid)
+		for _, pendingTx := range pending {
+			if bytes.Equal(pendingTx.ID, input.Txid) {
+				txMap[id] = pendingTx
+			}
+		}
+		if txMap[id] != nil {
+			continue
+		}
+		if prevTx, err := bc.FindTransaction(input.Txid); err == nil {
+			txMap[id] = prevTx
+		}
+	}
+	if len(txMap) == 0 {
+		return nil, ErrTxNotFound
+	}
+	return txMap, nil
+}
+
 // SignTransaction signs inputs of a Transaction
 func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
 	prevTXs,errFindPrevTXs:=bc.GetInputTXsOf(tx)
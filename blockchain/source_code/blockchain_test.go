@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests on the regtest network, whose blocks are mined
+// instantly
+func TestMain(m *testing.M) {
+	SetNetworkParams(RegtestParams)
+	os.Exit(m.Run())
+}
+
+// newTestChain returns a blockchain whose block 1 pays the subsidy to the
+// key, and the coinbase transaction of the block
+func newTestChain(t *testing.T, pubKey []byte) (*Blockchain, *Transaction) {
+	t.Helper()
+	bc, err := NewBlockchain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc, mineTestBlock(t, bc, pubKey).Transactions[0]
+}
+
+// mineTestBlock mines a block of the transactions paying the subsidy to the key
+func mineTestBlock(t *testing.T, bc *Blockchain, pubKey []byte, txs ...*Transaction) *Block {
+	t.Helper()
+	coinbaseTX, err := NewCoinbaseTX(GetStringAddress(GetAddress(pubKey)), "", len(bc.blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := bc.MineBlock(append([]*Transaction{coinbaseTX}, txs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != len(txs)+1 {
+		t.Fatalf("%d of %d transactions mined", len(block.Transactions)-1, len(txs))
+	}
+	return block
+}
+
+// newTestSpend returns a signed transaction spending the outputs of the
+// previous transaction of the key
+func newTestSpend(t *testing.T, privKey ecdsa.PrivateKey, prevTX *Transaction, outIdxs []int, vout []TXOutput) *Transaction {
+	t.Helper()
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	tx := &Transaction{Vout: vout}
+	for _, outIdx := range outIdxs {
+		tx.Vin = append(tx.Vin, TXInput{Txid: prevTX.ID, OutIdx: outIdx, PubKey: pubKey, Sequence: SequenceFinal})
+	}
+	tx.ID = tx.Hash()
+	if err := tx.Sign(privKey, map[string]*Transaction{Bytes2Hex(prevTX.ID): prevTX}); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestVerifyTransactionDuplicateInput(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	_, otherPubKey := newKeyPair()
+	to := GetStringAddress(GetAddress(otherPubKey))
+	value := coinbaseTX.Vout[0].Value
+
+	tx := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(value, to)})
+	if !bc.VerifyTransaction(tx) {
+		t.Fatal("valid transaction rejected")
+	}
+	// the same output spent twice to pay twice its value
+	tx = newTestSpend(t, privKey, coinbaseTX, []int{0, 0}, []TXOutput{*NewTXOutput(2*value, to)})
+	if bc.VerifyTransaction(tx) {
+		t.Error("transaction spending an output twice accepted")
+	}
+	if _, err := tx.Fee(map[string]*Transaction{Bytes2Hex(coinbaseTX.ID): coinbaseTX}); err != ErrDuplicateInput {
+		t.Errorf("fee: got %v, want %v", err, ErrDuplicateInput)
+	}
+	if err := NewMempool(bc).Add(tx); err != ErrInvalidMempoolTx {
+		t.Errorf("mempool: got %v, want %v", err, ErrInvalidMempoolTx)
+	}
+	if _, err := bc.NewBlockTemplate([]*Transaction{tx}); err != ErrNoValidTx {
+		t.Errorf("block template: got %v, want %v", err, ErrNoValidTx)
+	}
+}
+
+func TestAddBlockVerifiesTransactions(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	_, otherPubKey := newKeyPair()
+	to := GetStringAddress(GetAddress(otherPubKey))
+	newTestBlock := func(tx *Transaction) *Block {
+		reward, err := NewCoinbaseTX(to, "", len(bc.blocks))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := NewBlock(TestBlockTime, []*Transaction{reward, tx}, bc.CurrentBlock().Hash)
+		block.Mine()
+		return block
+	}
+
+	// a transaction with a forged signature
+	tx := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value, to)})
+	tx.Vin[0].ScriptSig[10] ^= 1
+	if err := bc.addBlock(newTestBlock(tx)); err != ErrInvalidBlock {
+		t.Errorf("forged signature: got %v, want %v", err, ErrInvalidBlock)
+	}
+	// a transaction spending an unknown output
+	unknown := *coinbaseTX
+	unknown.ID = Hex2Bytes("00")
+	tx = newTestSpend(t, privKey, &unknown, []int{0}, []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value, to)})
+	if err := bc.addBlock(newTestBlock(tx)); err != ErrInvalidBlock {
+		t.Errorf("unknown output: got %v, want %v", err, ErrInvalidBlock)
+	}
+	tx = newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value, to)})
+	if err := bc.addBlock(newTestBlock(tx)); err != nil {
+		t.Errorf("valid block rejected: %v", err)
+	}
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChannelState is the life cycle state of a payment channel
+type ChannelState int
+
+const (
+	ChannelStateOpening ChannelState = iota // waiting for the funding transaction to be signed
+	ChannelStateOpen                        // payments can be made
+	ChannelStateClosed                      // a closing or commitment transaction was produced
+)
+
+var (
+	ErrChannelNotOpen     = errors.New("payment channel is not open")
+	ErrChannelBalance     = errors.New("not enough balance in payment channel")
+	ErrChannelDirection   = errors.New("unidirectional payment channel cannot pay back the funder")
+	ErrChannelPending     = errors.New("payment channel has a pending update")
+	ErrChannelSignature   = errors.New("invalid payment channel signature")
+	ErrChannelMessage     = errors.New("unexpected payment channel message")
+	ErrChannelFunding     = errors.New("invalid payment channel funding transaction")
+	ErrInvalidRevocation  = errors.New("revocation secret does not match the revoked commitment")
+	ErrCommitmentNotFound = errors.New("no spendable commitment output")
+)
+
+// PaymentChannel is the view of one of the two parties of a payment
+// channel. The channel capacity is locked in a 2-of-2 multisig funding
+// output; payments update off-chain commitment transactions spending it.
+//
+// The commitment held by a party pays the counterparty immediately and
+// pays the party itself through a revocable output: the party can only
+// sweep it after the dispute period (Delay blocks, OP_CHECKSEQUENCEVERIFY),
+// while the counterparty can take it at once with the revocation secret
+// revealed when the commitment was replaced. Broadcasting a revoked
+// commitment thus loses the whole balance of the cheater (penalty).
+type PaymentChannel struct {
+	privKey       ecdsa.PrivateKey
+	LocalPubKey   []byte
+	RemotePubKey  []byte
+	Funder        bool   // the party which opened the channel
+	Bidirectional bool   // false: only the funder pays
+	Delay         uint32 // dispute period in blocks
+	FundingScript Script // 2-of-2 multisig redeem script
+	FundingTx     *Transaction
+	Capacity      int
+	State         ChannelState
+	Number        int // number of the current commitment
+	LocalBalance  int
+	RemoteBalance int
+
+	localSecrets  [][]byte          // revocation secrets of the local commitments, by number
+	remoteHashes  [][]byte          // revocation hashes of the remote commitments, by number
+	remoteSecrets map[string][]byte // revoked remote commitments: hex revocation hash -> secret
+	remoteSig     []byte            // remote signature of the current local commitment
+	pending       *channelBalances  // proposed state waiting for the acknowledgement
+}
+
+// channelBalances is a channel state proposed by an update
+type channelBalances struct {
+	number        int
+	localBalance  int
+	remoteBalance int
+}
+
+// ChannelOpen is sent by the funder to open a channel
+type ChannelOpen struct {
+	PubKey             []byte
+	Bidirectional      bool
+	Delay              uint32
+	FunderAmount       int          // amount paid by the funder
+	AcceptorAmount     int          // amount paid by the acceptor, only for bidirectional channels
+	FundingTx          *Transaction // unsigned funding transaction
+	RevocationHash     []byte       // revocation hash of the commitment 0
+	NextRevocationHash []byte       // revocation hash of the commitment 1
+}
+
+// ChannelAccept answers a ChannelOpen
+type ChannelAccept struct {
+	PubKey             []byte
+	FundingTx          *Transaction // funding transaction with the acceptor inputs signed
+	Signature          []byte       // signature of the funder commitment 0
+	RevocationHash     []byte
+	NextRevocationHash []byte
+}
+
+// ChannelFunded completes the opening of a channel
+type ChannelFunded struct {
+	FundingTx *Transaction // signed funding transaction
+	Signature []byte       // signature of the acceptor commitment 0
+}
+
+// ChannelUpdate pays an amount to the receiver. It carries the signature
+// of the new commitment of the receiver.
+type ChannelUpdate struct {
+	Number    int
+	Amount    int
+	Signature []byte
+}
+
+// ChannelAck acknowledges an update: signature of the new commitment of
+// the payer and revocation of the previous commitment of the receiver
+type ChannelAck struct {
+	Number             int
+	Signature          []byte
+	RevocationSecret   []byte
+	NextRevocationHash []byte
+}
+
+// ChannelRevocation revokes the previous commitment of the payer.
+// The payment is final once the receiver gets it.
+type ChannelRevocation struct {
+	Number             int
+	RevocationSecret   []byte
+	NextRevocationHash []byte
+}
+
+// ChannelClose proposes a cooperative close with the current balances
+type ChannelClose struct {
+	Signature []byte
+}
+
+// channelFundingScript returns the 2-of-2 multisig script of the funding
+// output, the public keys being sorted so that both parties build the same
+func channelFundingScript(pubKey1, pubKey2 []byte) (Script, error) {
+	pubKeys := [][]byte{pubKey1, pubKey2}
+	sort.Slice(pubKeys, func(i, j int) bool { return bytes.Compare(pubKeys[i], pubKeys[j]) < 0 })
+	return MultisigScript(2, pubKeys)
+}
+
+// sameUnsignedTx checks whether two transactions only differ by their signatures
+func sameUnsignedTx(a, b *Transaction) bool {
+	trimmedA, trimmedB := a.TrimmedCopy(), b.TrimmedCopy()
+	return bytes.Equal(a.ID, b.ID) && bytes.Equal(trimmedA.Hash(), trimmedB.Hash())
+}
+
+// NewChannelFundingTransaction creates the unsigned transaction locking the
+// amounts of the two parties in the funding output of a channel
+func NewChannelFundingTransaction(funderPubKey, acceptorPubKey []byte, funderAmount, acceptorAmount int, utxos UTXOSet) (*Transaction, error) {
+	fundingScript, err := channelFundingScript(funderPubKey, acceptorPubKey)
+	if err != nil {
+		return nil, err
+	}
+	contributions := []Contribution{{PubKey: funderPubKey, Amount: funderAmount}}
+	if acceptorAmount > 0 {
+		contributions = append(contributions, Contribution{PubKey: acceptorPubKey, Amount: acceptorAmount})
+	}
+	payments := []Payment{{Address: GetScriptAddress(fundingScript), Amount: funderAmount + acceptorAmount}}
+	return NewCollaborativeTransaction(contributions, payments, utxos)
+}
+
+// NewPaymentChannel creates the funder side of a channel and the message
+// opening it. Unidirectional channels are only funded by the funder.
+func NewPaymentChannel(privKey ecdsa.PrivateKey, remotePubKey []byte, fundingTx *Transaction, funderAmount, acceptorAmount int, delay uint32, bidirectional bool) (*PaymentChannel, *ChannelOpen, error) {
+	if funderAmount <= 0 || acceptorAmount < 0 || (!bidirectional && acceptorAmount != 0) {
+		return nil, nil, ErrChannelFunding
+	}
+	ch, err := newChannel(privKey, remotePubKey, fundingTx, delay, bidirectional)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch.Funder = true
+	ch.LocalBalance, ch.RemoteBalance = funderAmount, acceptorAmount
+	if ch.Capacity != funderAmount+acceptorAmount {
+		return nil, nil, ErrChannelFunding
+	}
+	open := &ChannelOpen{
+		PubKey:             ch.LocalPubKey,
+		Bidirectional:      bidirectional,
+		Delay:              delay,
+		FunderAmount:       funderAmount,
+		AcceptorAmount:     acceptorAmount,
+		FundingTx:          fundingTx,
+		RevocationHash:     ch.revocationHash(0),
+		NextRevocationHash: ch.revocationHash(1),
+	}
+	return ch, open, nil
+}
+
+// newChannel creates a channel in the opening state
+func newChannel(privKey ecdsa.PrivateKey, remotePubKey []byte, fundingTx *Transaction, delay uint32, bidirectional bool) (*PaymentChannel, error) {
+	ch := &PaymentChannel{
+		privKey:       privKey,
+		LocalPubKey:   pubKeyToByte(privKey.PublicKey),
+		RemotePubKey:  remotePubKey,
+		Bidirectional: bidirectional,
+		Delay:         delay,
+		FundingTx:     fundingTx,
+		State:         ChannelStateOpening,
+		remoteSecrets: make(map[string][]byte),
+	}
+	fundingScript, err := channelFundingScript(ch.LocalPubKey, remotePubKey)
+	if err != nil {
+		return nil, err
+	}
+	ch.FundingScript = fundingScript
+	outIdx, err := contractOutput(fundingTx, fundingScript)
+	if err != nil {
+		return nil, ErrChannelFunding
+	}
+	ch.Capacity = fundingTx.Vout[outIdx].Value
+	return ch, nil
+}
+
+// AcceptPaymentChannel creates the acceptor side of a channel from the
+// open message. The acceptor inputs of the funding transaction, if any,
+// must be signed by the caller (see Account.AcceptChannel).
+func AcceptPaymentChannel(privKey ecdsa.PrivateKey, open *ChannelOpen) (*PaymentChannel, *ChannelAccept, error) {
+	if open.FunderAmount <= 0 || open.AcceptorAmount < 0 || (!open.Bidirectional && open.AcceptorAmount != 0) ||
+		len(open.RevocationHash) != sha256.Size || len(open.NextRevocationHash) != sha256.Size {
+		return nil, nil, ErrChannelMessage
+	}
+	ch, err := newChannel(privKey, open.PubKey, open.FundingTx, open.Delay, open.Bidirectional)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ch.Capacity != open.FunderAmount+open.AcceptorAmount {
+		return nil, nil, ErrChannelFunding
+	}
+	ch.LocalBalance, ch.RemoteBalance = open.AcceptorAmount, open.FunderAmount
+	ch.remoteHashes = [][]byte{open.RevocationHash, open.NextRevocationHash}
+	signature, err := ch.signRemoteCommitment(0, ch.LocalBalance, ch.RemoteBalance)
+	if err != nil {
+		return nil, nil, err
+	}
+	accept := &ChannelAccept{
+		PubKey:             ch.LocalPubKey,
+		FundingTx:          open.FundingTx,
+		Signature:          signature,
+		RevocationHash:     ch.revocationHash(0),
+		NextRevocationHash: ch.revocationHash(1),
+	}
+	return ch, accept, nil
+}
+
+// CompleteOpen checks the acceptor signature of the funder commitment 0 and
+// returns the signature of the acceptor commitment 0. The funding
+// transaction of the accept message must then be signed by the funder and
+// mined (see Account.CompleteChannelOpen).
+func (ch *PaymentChannel) CompleteOpen(accept *ChannelAccept) (*ChannelFunded, error) {
+	if ch.State != ChannelStateOpening || !ch.Funder || !bytes.Equal(accept.PubKey, ch.RemotePubKey) ||
+		len(accept.RevocationHash) != sha256.Size || len(accept.NextRevocationHash) != sha256.Size {
+		return nil, ErrChannelMessage
+	}
+	// the acceptor may only have added its signatures
+	if !sameUnsignedTx(accept.FundingTx, ch.FundingTx) {
+		return nil, ErrChannelFunding
+	}
+	ch.remoteHashes = [][]byte{accept.RevocationHash, accept.NextRevocationHash}
+	if err := ch.checkLocalCommitment(0, ch.LocalBalance, ch.RemoteBalance, accept.Signature); err != nil {
+		return nil, err
+	}
+	signature, err := ch.signRemoteCommitment(0, ch.LocalBalance, ch.RemoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	ch.FundingTx = accept.FundingTx
+	ch.remoteSig = accept.Signature
+	ch.State = ChannelStateOpen
+	return &ChannelFunded{FundingTx: ch.FundingTx, Signature: signature}, nil
+}
+
+// ReceiveFunded checks the funder signature of the acceptor commitment 0
+// and opens the channel
+func (ch *PaymentChannel) ReceiveFunded(funded *ChannelFunded) error {
+	if ch.State != ChannelStateOpening || ch.Funder || !sameUnsignedTx(funded.FundingTx, ch.FundingTx) {
+		return ErrChannelMessage
+	}
+	if err := ch.checkLocalCommitment(0, ch.LocalBalance, ch.RemoteBalance, funded.Signature); err != nil {
+		return err
+	}
+	ch.FundingTx = funded.FundingTx
+	ch.remoteSig = funded.Signature
+	ch.State = ChannelStateOpen
+	return nil
+}
+
+// Pay proposes a new state paying the amount to the counterparty
+func (ch *PaymentChannel) Pay(amount int) (*ChannelUpdate, error) {
+	if ch.State != ChannelStateOpen {
+		return nil, ErrChannelNotOpen
+	}
+	if ch.pending != nil {
+		return nil, ErrChannelPending
+	}
+	if !ch.Bidirectional && !ch.Funder {
+		return nil, ErrChannelDirection
+	}
+	if amount <= 0 || amount > ch.LocalBalance {
+		return nil, ErrChannelBalance
+	}
+	next := &channelBalances{number: ch.Number + 1, localBalance: ch.LocalBalance - amount, remoteBalance: ch.RemoteBalance + amount}
+	signature, err := ch.signRemoteCommitment(next.number, next.localBalance, next.remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	ch.pending = next
+	return &ChannelUpdate{Number: next.number, Amount: amount, Signature: signature}, nil
+}
+
+// ReceiveUpdate accepts a payment of the counterparty: the new local
+// commitment replaces the current one, which is revoked
+func (ch *PaymentChannel) ReceiveUpdate(update *ChannelUpdate) (*ChannelAck, error) {
+	if ch.State != ChannelStateOpen {
+		return nil, ErrChannelNotOpen
+	}
+	if ch.pending != nil {
+		return nil, ErrChannelPending
+	}
+	if update.Number != ch.Number+1 {
+		return nil, ErrChannelMessage
+	}
+	if !ch.Bidirectional && ch.Funder {
+		return nil, ErrChannelDirection
+	}
+	if update.Amount <= 0 || update.Amount > ch.RemoteBalance {
+		return nil, ErrChannelBalance
+	}
+	localBalance, remoteBalance := ch.LocalBalance+update.Amount, ch.RemoteBalance-update.Amount
+	if err := ch.checkLocalCommitment(update.Number, localBalance, remoteBalance, update.Signature); err != nil {
+		return nil, err
+	}
+	signature, err := ch.signRemoteCommitment(update.Number, localBalance, remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	revoked := ch.Number
+	ch.Number, ch.LocalBalance, ch.RemoteBalance = update.Number, localBalance, remoteBalance
+	ch.remoteSig = update.Signature
+	return &ChannelAck{
+		Number:             update.Number,
+		Signature:          signature,
+		RevocationSecret:   ch.localSecrets[revoked],
+		NextRevocationHash: ch.revocationHash(update.Number + 1),
+	}, nil
+}
+
+// ReceiveAck applies the pending payment once the counterparty signed the
+// new local commitment and revoked its previous one, and revokes the
+// previous local commitment
+func (ch *PaymentChannel) ReceiveAck(ack *ChannelAck) (*ChannelRevocation, error) {
+	if ch.pending == nil || ack.Number != ch.pending.number {
+		return nil, ErrChannelMessage
+	}
+	next := ch.pending
+	if err := ch.checkLocalCommitment(next.number, next.localBalance, next.remoteBalance, ack.Signature); err != nil {
+		return nil, err
+	}
+	if err := ch.addRemoteRevocation(ch.Number, ack.RevocationSecret, ack.NextRevocationHash); err != nil {
+		return nil, err
+	}
+	revoked := ch.Number
+	ch.Number, ch.LocalBalance, ch.RemoteBalance = next.number, next.localBalance, next.remoteBalance
+	ch.remoteSig = ack.Signature
+	ch.pending = nil
+	return &ChannelRevocation{
+		Number:             next.number,
+		RevocationSecret:   ch.localSecrets[revoked],
+		NextRevocationHash: ch.revocationHash(next.number + 1),
+	}, nil
+}
+
+// ReceiveRevocation stores the revocation of the previous commitment of
+// the payer, making the received payment final
+func (ch *PaymentChannel) ReceiveRevocation(revocation *ChannelRevocation) error {
+	if revocation.Number != ch.Number {
+		return ErrChannelMessage
+	}
+	return ch.addRemoteRevocation(revocation.Number-1, revocation.RevocationSecret, revocation.NextRevocationHash)
+}
+
+// addRemoteRevocation checks and stores the secret of a revoked remote
+// commitment and the revocation hash of the commitment after the next one
+func (ch *PaymentChannel) addRemoteRevocation(number int, secret, nextHash []byte) error {
+	hash := sha256.Sum256(secret)
+	if number >= len(ch.remoteHashes) || !bytes.Equal(hash[:], ch.remoteHashes[number]) || len(nextHash) != sha256.Size {
+		return ErrInvalidRevocation
+	}
+	if number+2 != len(ch.remoteHashes) {
+		return ErrChannelMessage
+	}
+	ch.remoteSecrets[Bytes2Hex(hash[:])] = secret
+	ch.remoteHashes = append(ch.remoteHashes, nextHash)
+	return nil
+}
+
+// ProposeClose signs the cooperative closing transaction paying the
+// current balances without dispute period
+func (ch *PaymentChannel) ProposeClose() (*ChannelClose, error) {
+	if ch.State != ChannelStateOpen {
+		return nil, ErrChannelNotOpen
+	}
+	if ch.pending != nil {
+		return nil, ErrChannelPending
+	}
+	tx := ch.closingTx()
+	signature, err := ch.signFunding(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelClose{Signature: signature}, nil
+}
+
+// AcceptClose countersigns the cooperative closing transaction and
+// returns it, ready to be mined
+func (ch *PaymentChannel) AcceptClose(close *ChannelClose) (*Transaction, error) {
+	if ch.State != ChannelStateOpen {
+		return nil, ErrChannelNotOpen
+	}
+	if ch.pending != nil {
+		return nil, ErrChannelPending
+	}
+	tx := ch.closingTx()
+	if err := ch.completeFundingSpend(tx, close.Signature); err != nil {
+		return nil, err
+	}
+	ch.State = ChannelStateClosed
+	return tx, nil
+}
+
+// ForceClose returns the current local commitment, signed by both parties.
+// Once mined, the local balance can be swept with SweepCommitment after
+// the dispute period.
+func (ch *PaymentChannel) ForceClose() (*Transaction, error) {
+	if ch.State != ChannelStateOpen {
+		return nil, ErrChannelNotOpen
+	}
+	tx, err := ch.commitment(true, ch.Number, ch.LocalBalance, ch.RemoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.completeFundingSpend(tx, ch.remoteSig); err != nil {
+		return nil, err
+	}
+	ch.State = ChannelStateClosed
+	return tx, nil
+}
+
+// SweepCommitment spends the revocable output of a mined local
+// commitment to the address, once the dispute period is over
+func (ch *PaymentChannel) SweepCommitment(commitTx *Transaction, to string) (*Transaction, error) {
+	for number := range ch.localSecrets {
+		script := ch.revocableScript(true, ch.revocationHash(number))
+		tx, prevOut, err := newScriptSpend(script, commitTx, to)
+		if err != nil {
+			continue
+		}
+		tx.SetSequence(RelativeLockBlocks(int(ch.Delay)))
+		// an empty push (false) selects the delayed branch
+		if err := tx.signScriptSpend(ch.privKey, prevOut, script, []byte{}); err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+	return nil, ErrCommitmentNotFound
+}
+
+// IsRevokedCommitment checks whether the transaction is a revoked
+// commitment of the counterparty
+func (ch *PaymentChannel) IsRevokedCommitment(tx *Transaction) bool {
+	_, _, err := ch.revokedOutput(tx)
+	return err == nil
+}
+
+// revokedOutput returns the revocable script and secret of a revoked
+// remote commitment
+func (ch *PaymentChannel) revokedOutput(commitTx *Transaction) (Script, []byte, error) {
+	for hash, secret := range ch.remoteSecrets {
+		script := ch.revocableScript(false, Hex2Bytes(hash))
+		if _, err := contractOutput(commitTx, script); err == nil {
+			return script, secret, nil
+		}
+	}
+	return nil, nil, ErrCommitmentNotFound
+}
+
+// Penalize takes, to the address, the balance of the counterparty from
+// a revoked commitment it broadcast, during the dispute period
+func (ch *PaymentChannel) Penalize(commitTx *Transaction, to string) (*Transaction, error) {
+	script, secret, err := ch.revokedOutput(commitTx)
+	if err != nil {
+		return nil, err
+	}
+	tx, prevOut, err := newScriptSpend(script, commitTx, to)
+	if err != nil {
+		return nil, err
+	}
+	// OP_1 selects the revocation branch
+	if err := tx.signScriptSpend(ch.privKey, prevOut, script, secret, []byte{1}); err != nil {
+		return nil, err
+	}
+	ch.State = ChannelStateClosed
+	return tx, nil
+}
+
+// revocationHash returns the revocation hash of the local commitment
+// number, creating its secret if needed
+func (ch *PaymentChannel) revocationHash(number int) []byte {
+	for len(ch.localSecrets) <= number {
+		secret, _, err := NewSecret()
+		if err != nil {
+			panic(err)
+		}
+		ch.localSecrets = append(ch.localSecrets, secret)
+	}
+	hash := sha256.Sum256(ch.localSecrets[number])
+	return hash[:]
+}
+
+// revocableScript returns the script of the balance of the holder of a
+// commitment: paid to the counterparty with the revocation secret, or to
+// the holder after the dispute period
+func (ch *PaymentChannel) revocableScript(local bool, revocationHash []byte) Script {
+	owner, counterparty := HashPubKey(ch.LocalPubKey), HashPubKey(ch.RemotePubKey)
+	if !local {
+		owner, counterparty = counterparty, owner
+	}
+	return hashLockScript(revocationHash, counterparty, OP_CHECKSEQUENCEVERIFY, int64(RelativeLockBlocks(int(ch.Delay))), owner)
+}
+
+// fundingOutput returns the funding output spent by the commitments
+func (ch *PaymentChannel) fundingOutput() (int, *TXOutput, error) {
+	outIdx, err := contractOutput(ch.FundingTx, ch.FundingScript)
+	if err != nil {
+		return 0, nil, err
+	}
+	return outIdx, &ch.FundingTx.Vout[outIdx], nil
+}
+
+// fundingSpend creates the unsigned transaction spending the funding output
+func (ch *PaymentChannel) fundingSpend(vout []TXOutput) *Transaction {
+	outIdx, _, _ := ch.fundingOutput()
+	tx := &Transaction{
+		Vin:  []TXInput{{Txid: ch.FundingTx.ID, OutIdx: outIdx, ScriptSig: multisigUnlockingScript(nil, ch.FundingScript), Sequence: SequenceFinal}},
+		Vout: vout,
+	}
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// commitment returns the commitment number of the local or remote party,
+// with the balances seen by the local party
+func (ch *PaymentChannel) commitment(local bool, number, localBalance, remoteBalance int) (*Transaction, error) {
+	var revocationHash []byte
+	holderBalance, otherBalance, otherPubKey := localBalance, remoteBalance, ch.RemotePubKey
+	if local {
+		revocationHash = ch.revocationHash(number)
+	} else {
+		if number >= len(ch.remoteHashes) {
+			return nil, ErrChannelMessage
+		}
+		revocationHash = ch.remoteHashes[number]
+		holderBalance, otherBalance, otherPubKey = remoteBalance, localBalance, ch.LocalPubKey
+	}
+	vout := []TXOutput{}
+	if holderBalance > 0 {
+		script := ch.revocableScript(local, revocationHash)
+		vout = append(vout, *NewTXOutput(holderBalance, GetScriptAddress(script)))
+	}
+	if otherBalance > 0 {
+		vout = append(vout, *NewTXOutput(otherBalance, string(GetAddress(otherPubKey))))
+	}
+	return ch.fundingSpend(vout), nil
+}
+
+// closingTx returns the cooperative closing transaction, the outputs
+// being ordered as the keys of the funding script
+func (ch *PaymentChannel) closingTx() *Transaction {
+	_, pubKeys, _ := ch.FundingScript.ParseMultisig()
+	vout := []TXOutput{}
+	for _, pubKey := range pubKeys {
+		balance := ch.LocalBalance
+		if !bytes.Equal(pubKey, ch.LocalPubKey) {
+			balance = ch.RemoteBalance
+		}
+		if balance > 0 {
+			vout = append(vout, *NewTXOutput(balance, string(GetAddress(pubKey))))
+		}
+	}
+	return ch.fundingSpend(vout)
+}
+
+// signFunding returns the local signature of a transaction spending the funding output
+func (ch *PaymentChannel) signFunding(tx *Transaction) ([]byte, error) {
+	_, prevOut, err := ch.fundingOutput()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := tx.SignatureHash(0, prevOut, SigHashAll)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signDigest(ch.privKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	return append(signature, byte(SigHashAll)), nil
+}
+
+// signRemoteCommitment returns the local signature of a remote commitment
+func (ch *PaymentChannel) signRemoteCommitment(number, localBalance, remoteBalance int) ([]byte, error) {
+	tx, err := ch.commitment(false, number, localBalance, remoteBalance)
+	if err != nil {
+		return nil, err
+	}
+	return ch.signFunding(tx)
+}
+
+// checkLocalCommitment checks the remote signature of a local commitment
+func (ch *PaymentChannel) checkLocalCommitment(number, localBalance, remoteBalance int, signature []byte) error {
+	tx, err := ch.commitment(true, number, localBalance, remoteBalance)
+	if err != nil {
+		return err
+	}
+	_, prevOut, err := ch.fundingOutput()
+	if err != nil {
+		return err
+	}
+	checker := txSigChecker{tx: tx, idx: 0, prevOut: prevOut}
+	if !checker.CheckSig(signature, ch.RemotePubKey) {
+		return ErrChannelSignature
+	}
+	return nil
+}
+
+// completeFundingSpend adds the local signature to the remote one and
+// sets the unlocking script of a transaction spending the funding output
+func (ch *PaymentChannel) completeFundingSpend(tx *Transaction, remoteSig []byte) error {
+	signature, err := ch.signFunding(tx)
+	if err != nil {
+		return err
+	}
+	_, pubKeys, _ := ch.FundingScript.ParseMultisig()
+	signatures := [][]byte{}
+	for _, pubKey := range pubKeys {
+		if bytes.Equal(pubKey, ch.LocalPubKey) {
+			signatures = append(signatures, signature)
+		} else {
+			signatures = append(signatures, remoteSig)
+		}
+	}
+	tx.Vin[0].ScriptSig = multisigUnlockingScript(signatures, ch.FundingScript)
+	_, prevOut, _ := ch.fundingOutput()
+	if err := tx.VerifyInput(0, prevOut); err != nil {
+		return ErrChannelSignature
+	}
+	return nil
+}
+
+func (ch *PaymentChannel) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("--- Payment channel %x :", ch.FundingTx.ID))
+	lines = append(lines, fmt.Sprintf("     Funder:        %v", ch.Funder))
+	lines = append(lines, fmt.Sprintf("     Bidirectional: %v", ch.Bidirectional))
+	lines = append(lines, fmt.Sprintf("     Capacity:      %d", ch.Capacity))
+	lines = append(lines, fmt.Sprintf("     Commitment:    %d", ch.Number))
+	lines = append(lines, fmt.Sprintf("     Local:         %d", ch.LocalBalance))
+	lines = append(lines, fmt.Sprintf("     Remote:        %d", ch.RemoteBalance))
+	lines = append(lines, fmt.Sprintf("     Dispute delay: %d blocks", ch.Delay))
+	return strings.Join(lines, "\n")
+}
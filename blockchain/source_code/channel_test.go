@@ -0,0 +1,180 @@
+package main
+
+import "testing"
+
+// newTestChannel opens a channel funded with 6 by alice and, if it is
+// bidirectional, 4 by bob, and mines its funding transaction
+func newTestChannel(t *testing.T, bidirectional bool) (alice, bob Account, chA, chB *PaymentChannel) {
+	t.Helper()
+	alicePrivKey, alicePubKey := newKeyPair()
+	bobPrivKey, bobPubKey := newKeyPair()
+	bc, _ := newTestChain(t, alicePubKey)
+	mineTestBlock(t, bc, bobPubKey)
+	alice = newTestSwapAccount("alice", alicePrivKey, bc)
+	bob = newTestSwapAccount("bob", bobPrivKey, bc)
+
+	bobAmount := 0
+	if bidirectional {
+		bobAmount = 4
+	}
+	chA, open, err := alice.OpenChannel(bobPubKey, 6, bobAmount, 2, bidirectional)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chB, accept, err := bob.AcceptChannel(open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funded, err := alice.CompleteChannelOpen(chA, accept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.ReceiveChannelFunded(chB, funded); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, alicePubKey, funded.FundingTx)
+	return alice, bob, chA, chB
+}
+
+// payTestChannel runs a payment of the amount from the payer to the receiver
+func payTestChannel(t *testing.T, payer, receiver *PaymentChannel, amount int) {
+	t.Helper()
+	update, err := payer.Pay(amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, err := receiver.ReceiveUpdate(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocation, err := payer.ReceiveAck(ack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.ReceiveRevocation(revocation); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaymentChannel(t *testing.T) {
+	alice, bob, chA, chB := newTestChannel(t, true)
+	diff(t, ChannelStateOpen, chA.State, "state of alice")
+	diff(t, ChannelStateOpen, chB.State, "state of bob")
+	diff(t, 10, chA.Capacity, "capacity")
+
+	payTestChannel(t, chA, chB, 5)
+	payTestChannel(t, chB, chA, 2)
+	diff(t, []int{2, 3}, []int{chA.Number, chA.LocalBalance}, "commitment and balance of alice")
+	diff(t, []int{2, 7}, []int{chB.Number, chB.LocalBalance}, "commitment and balance of bob")
+
+	closeMsg, err := chA.ProposeClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closingTx, err := chB.AcceptClose(closeMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bob.Blockchain, bob.PubKeyBytes, closingTx)
+	paid := map[string]int{}
+	for _, out := range closingTx.Vout {
+		paid[Bytes2Hex(out.PubKeyHash)] += out.Value
+	}
+	diff(t, map[string]int{Bytes2Hex(HashPubKey(alice.PubKeyBytes)): 3, Bytes2Hex(HashPubKey(bob.PubKeyBytes)): 7}, paid, "closing balances")
+	if _, err := chB.Pay(1); err != ErrChannelNotOpen {
+		t.Errorf("paying in a closed channel: got %v, want %v", err, ErrChannelNotOpen)
+	}
+}
+
+func TestPaymentChannelErrors(t *testing.T) {
+	_, _, chA, chB := newTestChannel(t, false)
+	if _, err := chB.Pay(1); err != ErrChannelDirection {
+		t.Errorf("acceptor paying in a unidirectional channel: got %v, want %v", err, ErrChannelDirection)
+	}
+	if _, err := chA.Pay(7); err != ErrChannelBalance {
+		t.Errorf("paying more than the balance: got %v, want %v", err, ErrChannelBalance)
+	}
+	update, err := chA.Pay(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chA.Pay(1); err != ErrChannelPending {
+		t.Errorf("paying with a pending update: got %v, want %v", err, ErrChannelPending)
+	}
+	// the signature of the commitment of another amount
+	forged := *update
+	forged.Amount = 2
+	if _, err := chB.ReceiveUpdate(&forged); err != ErrChannelSignature {
+		t.Errorf("update of another amount: got %v, want %v", err, ErrChannelSignature)
+	}
+	ack, err := chB.ReceiveUpdate(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedAck := *ack
+	forgedAck.RevocationSecret = make([]byte, len(ack.RevocationSecret))
+	if _, err := chA.ReceiveAck(&forgedAck); err != ErrInvalidRevocation {
+		t.Errorf("ack with a wrong revocation secret: got %v, want %v", err, ErrInvalidRevocation)
+	}
+	if _, err := chA.ReceiveAck(ack); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaymentChannelForceClose(t *testing.T) {
+	alice, bob, chA, chB := newTestChannel(t, false)
+	payTestChannel(t, chA, chB, 2)
+	commitTx, err := chA.ForceClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := alice.Blockchain
+	mineTestBlock(t, bc, bob.PubKeyBytes, commitTx)
+	if chB.IsRevokedCommitment(commitTx) {
+		t.Error("current commitment taken as revoked")
+	}
+	sweepTx, err := chA.SweepCommitment(commitTx, alice.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the balance of alice is locked during the dispute period
+	for i := uint32(0); i < chA.Delay-1; i++ {
+		coinbaseTX, err := NewCoinbaseTX(bob.Address, "", len(bc.blocks))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := bc.MineBlock([]*Transaction{coinbaseTX, sweepTx})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Transactions) != 1 {
+			t.Fatalf("sweep transaction mined %d blocks after the commitment", i+1)
+		}
+	}
+	block := mineTestBlock(t, bc, bob.PubKeyBytes, sweepTx)
+	diff(t, 4, block.Transactions[1].Vout[0].Value, "swept balance")
+}
+
+func TestPaymentChannelPenalty(t *testing.T) {
+	alice, bob, chA, chB := newTestChannel(t, false)
+	// alice keeps the commitment 0 paying her 6 before paying 2 to bob
+	stale := *chA
+	revokedTx, err := stale.ForceClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payTestChannel(t, chA, chB, 2)
+	bc := alice.Blockchain
+	mineTestBlock(t, bc, alice.PubKeyBytes, revokedTx)
+	if !chB.IsRevokedCommitment(revokedTx) {
+		t.Fatal("revoked commitment not detected")
+	}
+	// bob takes the balance of alice during the dispute period
+	penaltyTx, err := chB.Penalize(revokedTx, bob.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := mineTestBlock(t, bc, bob.PubKeyBytes, penaltyTx)
+	diff(t, 6, block.Transactions[1].Vout[0].Value, "penalty")
+	diff(t, ChannelStateClosed, chB.State, "state of bob")
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"crypto/ecdsa"
-	"errors"
+	"crypto/sha256"
 	"fmt"
 )
 
@@ -14,9 +15,15 @@ type Account struct {
 	Address     string
 	Balance     int
 	Blockchain 	*Blockchain
-	AddressMap 	map[string]string
+	Labels      *Labels    // labels of addresses and transactions, stored in the keystore
 	BlockIn chan *Block
 	ChannelMap 	map[string]chan *Block
+	RedeemScripts map[string]Script // P2SH address -> redeem script
+	DataIndex   *DataIndex // data published in the blockchain
+	NFTIndex    *NFTIndex  // current outpoints of the NFTs of the blockchain
+	HDWallet    *HDWallet  // wallet deriving the keys of the account
+	History     *TxHistory // transactions paying or spending the coins of the account
+	Funding     FundingOptions // coin selection and fee rate of the transfers
 }
 
 func PrintErr(err error) {
@@ -25,8 +32,42 @@ func PrintErr(err error) {
 	}
 }
 
-func NewAccount(name string) Account {
-	privateKey, pubKeyBytes:=newKeyPair()
+//create an account with a new HD wallet, its key being
+//the first receiving key of the wallet
+func NewAccount(name string) (Account, error) {
+	wallet, err:=NewHDWallet("")
+	if err != nil {
+		return Account{}, err
+	}
+	return newHDAccount(name, wallet)
+}
+
+//restore the account of a mnemonic and passphrase
+func RestoreAccount(name string, mnemonic string, passphrase string) (Account, error) {
+	wallet, err:=RestoreHDWallet(mnemonic, passphrase, DefaultAccountPath())
+	if err != nil {
+		return Account{}, err
+	}
+	return newHDAccount(name, wallet)
+}
+
+func newHDAccount(name string, wallet *HDWallet) (Account, error) {
+	privateKey, err:=wallet.PrivateKey(ExternalChain, 0)
+	if err != nil {
+		return Account{}, err
+	}
+	//the account key is the first receiving address of the wallet
+	_, err=wallet.NextAddress(ExternalChain)
+	if err != nil {
+		return Account{}, err
+	}
+	acc:=newKeyAccount(name, privateKey)
+	acc.HDWallet=wallet
+	return acc, nil
+}
+
+func newKeyAccount(name string, privateKey ecdsa.PrivateKey) Account {
+	pubKeyBytes:=pubKeyToByte(privateKey.PublicKey)
 	addressBytes:=GetAddress(pubKeyBytes)
 	addressString:=GetStringAddress(addressBytes)
 	return Account{
@@ -36,7 +77,97 @@ func NewAccount(name string) Account {
 		Address:addressString,
 		BlockIn: make(chan *Block, 8),
 		ChannelMap:make(map[string]chan *Block),		
+		RedeemScripts:make(map[string]Script),
+		DataIndex:&DataIndex{},
+		NFTIndex:&NFTIndex{},
+		Labels:NewLabels(),
+		History:&TxHistory{},
+	}
+}
+
+//load the account stored under its name in the unlocked keystore,
+//with its labels
+func LoadAccount(ks *Keystore, name string) (Account, error) {
+	acc, err:=loadAccountKey(ks, name)
+	if err != nil {
+		return Account{}, err
+	}
+	acc.Labels, err=ks.Labels(name)
+	if err != nil {
+		return Account{}, err
+	}
+	return acc, nil
+}
+
+func loadAccountKey(ks *Keystore, name string) (Account, error) {
+	for _, entry := range ks.Entries() {
+		if entry.Name != name {
+			continue
+		}
+		if entry.Type == KeyTypeMnemonic {
+			mnemonic, err:=ks.Mnemonic(name)
+			if err != nil {
+				return Account{}, err
+			}
+			return RestoreAccount(name, mnemonic, "")
+		}
+		privateKey, err:=ks.Key(name)
+		if err != nil {
+			return Account{}, err
+		}
+		return newKeyAccount(name, privateKey), nil
+	}
+	return Account{}, ErrKeyNotFound
+}
+
+//store the mnemonic of the HD wallet of the account, or its
+//private key, in the unlocked keystore under the account name,
+//with the labels of the account
+func (acc Account) SaveToKeystore(ks *Keystore) error {
+	var err error
+	if acc.HDWallet != nil && acc.HDWallet.Mnemonic != "" {
+		err=ks.AddMnemonic(acc.Name, acc.HDWallet.Mnemonic)
+	} else {
+		err=ks.AddKey(acc.Name, acc.PrivateKey)
+	}
+	if err != nil {
+		return err
 	}
+	return acc.SaveLabels(ks)
+}
+
+//store the labels of the account saved in the unlocked keystore
+func (acc Account) SaveLabels(ks *Keystore) error {
+	return ks.SetLabels(acc.Name, acc.Labels)
+}
+
+//the public key hashes of the addresses of the account: its key,
+//its schnorr key and the addresses given by its HD wallet
+func (acc Account) pubKeyHashes() ([][]byte, error) {
+	pubKeyHashes:=[][]byte{HashPubKey(acc.PubKeyBytes), HashPubKey(acc.SchnorrPubKey())}
+	if acc.HDWallet == nil {
+		return pubKeyHashes, nil
+	}
+	hdPubKeyHashes, err:=acc.HDWallet.PubKeyHashes()
+	if err != nil {
+		return nil, err
+	}
+	return append(pubKeyHashes, hdPubKeyHashes...), nil
+}
+
+//list the transactions of the account, the most recent first,
+//with their labels
+func (acc Account) ListTransactions() ([]WalletTx, error) {
+	pubKeyHashes, err:=acc.pubKeyHashes()
+	if err != nil {
+		return nil, err
+	}
+	acc.History.Update(acc.Blockchain, pubKeyHashes)
+	list:=acc.History.List(acc.Blockchain)
+	for i := range list {
+		list[i].Label=acc.Labels.Transaction(list[i].TxID)
+	}
+	return list, nil
 }
 
 
@@ -46,7 +177,7 @@ func NewAccount(name string) Account {
 //sender create the transactions and sign it
 func (acc Account) ProduceTransferTx(to string, amount int) (*Transaction,error){
 	utxos:=acc.Blockchain.FindUTXOSet()
-	tx,err:=NewUTXOTransaction(acc.PubKeyBytes,to,amount,utxos)
+	tx,err:=NewFundedTransaction(acc.PubKeyBytes,to,amount,utxos,acc.Funding)
 	if err != nil{
 		return nil,err
 	}
@@ -59,13 +190,141 @@ func (acc Account) ProduceTransferTx(to string, amount int) (*Transaction,error)
 	return tx,nil
 }
 
+//sender create a transaction publishing the data and sign it
+func (acc Account) ProduceDataTx(data []byte) (*Transaction, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewDataTransaction(acc.PubKeyBytes, data, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//issuer create a transaction issuing a token and sign it
+func (acc Account) ProduceTokenIssuanceTx(name string, supply int, decimals int) (*Transaction, *Token, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, token, err := NewTokenIssuanceTransaction(acc.PubKeyBytes, name, supply, decimals, utxos)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, token, nil
+}
+
+//sender create a transaction transferring tokens and sign it
+func (acc Account) ProduceTokenTransferTx(tokenID []byte, to string, amount int) (*Transaction, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewTokenTransferTransaction(acc.PubKeyBytes, tokenID, to, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//owner create a transaction burning tokens and sign it
+func (acc Account) ProduceTokenBurnTx(tokenID []byte, amount int) (*Transaction, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewTokenBurnTransaction(acc.PubKeyBytes, tokenID, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//get the token balances of the account by hex token ID
+func (acc Account) GetTokenBalances() map[string]int {
+	return acc.Blockchain.FindUTXOSet().TokenBalances(HashPubKey(acc.PubKeyBytes))
+}
+
+//get the balance of a token
+func (acc Account) GetTokenBalance(tokenID []byte) int {
+	return acc.GetTokenBalances()[Bytes2Hex(tokenID)]
+}
+
+//find the data published in the blockchain starting with the prefix
+func (acc Account) FindData(prefix []byte) []DataEntry {
+	acc.DataIndex.Update(acc.Blockchain)
+	return acc.DataIndex.FindByPrefix(prefix)
+}
+
+//issuer create a transaction minting an NFT for the metadata and sign it
+func (acc Account) ProduceNFTMintTx(metadata []byte) (*Transaction, *NFT, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	metadataHash := sha256.Sum256(metadata)
+	tx, nft, err := NewNFTMintTransaction(acc.PubKeyBytes, metadataHash[:], utxos, acc.Funding)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, nft, nil
+}
+
+//owner create a transaction transferring an NFT and sign it
+func (acc Account) ProduceNFTTransferTx(assetID []byte, to string) (*Transaction, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewNFTTransferTransaction(acc.PubKeyBytes, assetID, to, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//find the addresses of the HD wallet used in the blockchain
+func (acc Account) ScanHDWallet() ([]HDAddress, error) {
+	return acc.HDWallet.Scan(acc.Blockchain)
+}
+
+//list the NFTs owned by the account
+func (acc Account) ListNFTs() []NFTEntry {
+	acc.NFTIndex.Update(acc.Blockchain)
+	return acc.NFTIndex.Owned(HashPubKey(acc.PubKeyBytes))
+}
+
+//find the current outpoint of an NFT
+func (acc Account) FindNFT(assetID []byte) (*NFTEntry, error) {
+	acc.NFTIndex.Update(acc.Blockchain)
+	return acc.NFTIndex.Find(assetID)
+}
+
 //mine a block with the given transaction and get reward 
-//and add it to the mined block
+//and the fee of the transaction and add it to the mined block
 func (acc Account) MineTransaction(tx *Transaction) *Block{
 	if !acc.Blockchain.VerifyTransaction(tx){
 		return nil
 	}
-	coinbaseTX,err:=NewCoinbaseTX(acc.Address,"")
+	prevTXs,err:=acc.Blockchain.GetInputTXsOf(tx)
+	if err != nil {
+		PrintErr(err)
+		return nil
+	}
+	fee,err:=tx.Fee(prevTXs)
+	if err != nil {
+		PrintErr(err)
+		return nil
+	}
+	coinbaseTX,err:=NewFeeCoinbaseTX(acc.Address,"",len(acc.Blockchain.blocks),fee)
 	PrintErr(err)
 	minedBlock,err:=acc.Blockchain.MineBlock([]*Transaction{coinbaseTX,tx})
 	PrintErr(err)
@@ -80,18 +339,14 @@ func (acc Account) BroadcastBlock(block *Block) {
 
 //if the mined Block is valid, add to the block chain and return true
 func (acc Account) HandleMinedBlockIn(minedBlock *Block) error{
-	//verify the pow of the block
+	//verify the pow of the block and the signature for each
+	//transaction in that block, the schnorr signatures being
+	//verified in a batch
 	if acc.Blockchain.ValidateBlock(minedBlock)==false{
 		return ErrInvalidBlock
 	}
-	//verify the signature for each transaction in that block
-	for _,tx := range minedBlock.Transactions{
-		if acc.Blockchain.VerifyTransaction(tx)==false{
-			return errors.New("Signature not valid")
-		}
-	}
 	//add to blockchain if all valid
-	acc.Blockchain.blocks = append(acc.Blockchain.blocks,minedBlock)
+	acc.Blockchain.appendBlock(minedBlock)
 	return nil
 }
 
@@ -110,6 +365,426 @@ func (acc Account) GetBalance() int{
 	return accumulatedBalance
 }
 
+//get the bech32 witness address of the key of the account,
+//its outputs are spent as the outputs of the base58 address
+func (acc Account) WitnessAddress() string {
+	return GetWitnessAddress(acc.PubKeyBytes)
+}
+
+//get the x-only public key of the account used by schnorr signatures
+func (acc Account) SchnorrPubKey() []byte {
+	return SchnorrPubKey(acc.PrivateKey.PublicKey)
+}
+
+//get the address of the schnorr key of the account,
+//the outputs paid to it are spent with schnorr signatures
+func (acc Account) SchnorrAddress() string {
+	return GetStringAddress(GetAddress(acc.SchnorrPubKey()))
+}
+
+//get balance of the schnorr address of the account
+func (acc Account) GetSchnorrBalance() int {
+	balance, _:=acc.Blockchain.FindUTXOSet().FindSpendableOutputs(HashPubKey(acc.SchnorrPubKey()), 0)
+	return balance
+}
 
+//sender create a transaction paying all the payments of
+//the request at once and sign it
+func (acc Account) ProduceBatchTransferTx(request PaymentRequest) (*Transaction, error) {
+	return acc.produceBatchTransferTx(request, acc.Blockchain.FindUTXOSet(), acc.Funding)
+}
 
+func (acc Account) produceBatchTransferTx(request PaymentRequest, utxos UTXOSet, opts FundingOptions) (*Transaction, error) {
+	tx, err:=NewBatchTransaction(acc.PubKeyBytes, request, utxos, opts)
+	if err != nil {
+		return nil, err
+	}
+	err=acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//estimate the fee rate confirming the transactions of the
+//account within the target number of blocks with the confidence
+func (acc Account) EstimateFeeRate(target int, confidence float64) (int, error) {
+	if acc.Funding.Estimator == nil {
+		return 0, ErrNoFeeEstimate
+	}
+	return acc.Funding.Estimator.EstimateFeeRate(target, confidence)
+}
+
+//sender replaces its transaction waiting in the mempool with
+//one paying the fee rate, sign it and add it to the mempool
+func (acc Account) BumpFee(mempool *Mempool, txID []byte, feeRate int) (*Transaction, error) {
+	orig, err:=mempool.Get(txID)
+	if err != nil {
+		return nil, err
+	}
+	prevTXs, err:=mempool.InputTXsOf(orig)
+	if err != nil {
+		return nil, err
+	}
+	utxos:=acc.Blockchain.FindUTXOSet()
+	mempool.ExcludeSpent(utxos)
+	tx, err:=NewBumpFeeTransaction(acc.PubKeyBytes, orig, prevTXs, feeRate, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err=acc.signAndAddToMempool(mempool, tx)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
 
+//receiver or sender spends its output of a transaction waiting
+//in the mempool, paying the fee of both at the fee rate
+func (acc Account) BumpFeeCPFP(mempool *Mempool, txID []byte, feeRate int) (*Transaction, error) {
+	parent, err:=mempool.Get(txID)
+	if err != nil {
+		return nil, err
+	}
+	parentFee, err:=mempool.Fee(txID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err:=NewChildPaysForParentTransaction(acc.PubKeyBytes, parent, parentFee, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	err=acc.signAndAddToMempool(mempool, tx)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//sign a transaction spending outputs of the blockchain or of
+//the mempool, and add it to the mempool
+func (acc Account) signAndAddToMempool(mempool *Mempool, tx *Transaction) error {
+	prevTXs, err:=mempool.InputTXsOf(tx)
+	if err != nil {
+		return err
+	}
+	err=tx.Sign(acc.PrivateKey, prevTXs)
+	if err != nil {
+		return err
+	}
+	return mempool.Add(tx)
+}
+
+//sender create a transaction spending the outputs of its
+//schnorr address and sign it with schnorr signatures
+func (acc Account) ProduceSchnorrTransferTx(to string, amount int) (*Transaction, error) {
+	if !schnorrEnabled() {
+		return nil, ErrSchnorrCurve
+	}
+	utxos:=acc.Blockchain.FindUTXOSet()
+	tx, err:=NewFundedTransaction(acc.SchnorrPubKey(), to, amount, utxos, acc.Funding)
+	if err != nil {
+		return nil, err
+	}
+	err=acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//produce the partial signature of the account for a MuSig
+//aggregate key, its nonce being used only once
+func (acc Account) MuSigPartialSign(keyAgg *MuSigKeyAgg, nonce *MuSigNonce, aggNonce []byte, digest []byte) ([]byte, error) {
+	return keyAgg.PartialSign(acc.PrivateKey, nonce, aggNonce, digest)
+}
+
+//create a m-of-n multisig address with the given public keys,
+//the account keeps its redeem script to spend from it
+func (acc Account) NewMultisigAddress(m int, pubKeys [][]byte) (string, error) {
+	redeemScript, err := MultisigScript(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	address := GetScriptAddress(redeemScript)
+	acc.RedeemScripts[address] = redeemScript
+	return address, nil
+}
+
+//create a transaction spending from a multisig address and sign it,
+//the other signers have to co-sign it with CoSignTransaction
+func (acc Account) ProduceMultisigTx(from string, to string, amount int) (*Transaction, error) {
+	redeemScript, ok := acc.RedeemScripts[from]
+	if !ok {
+		return nil, ErrInvalidMultisig
+	}
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewMultisigTransaction(redeemScript, to, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err = acc.CoSignTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//create a P2SH address paying to the account once the absolute lock time
+//(block height or unix time) is reached, e.g. for vesting
+func (acc Account) NewVestingAddress(lockTime uint32) string {
+	redeemScript := VestingScript(lockTime, HashPubKey(acc.PubKeyBytes))
+	address := GetScriptAddress(redeemScript)
+	acc.RedeemScripts[address] = redeemScript
+	return address
+}
+
+//create a P2SH address paying to the account once the received outputs
+//are old enough, the sequence is built with RelativeLockBlocks or RelativeLockSeconds
+func (acc Account) NewRelativeLockAddress(sequence uint32) string {
+	redeemScript := RelativeTimelockScript(sequence, HashPubKey(acc.PubKeyBytes))
+	address := GetScriptAddress(redeemScript)
+	acc.RedeemScripts[address] = redeemScript
+	return address
+}
+
+//create a transaction spending from a timelocked address of the account
+//and sign it, it can be mined once the lock time is reached
+func (acc Account) ProduceTimelockedSpendTx(from string, to string, amount int) (*Transaction, error) {
+	redeemScript, ok := acc.RedeemScripts[from]
+	if !ok {
+		return nil, ErrInvalidScript
+	}
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewP2SHTransaction(redeemScript, to, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//create a transfer transaction which cannot be mined before the
+//absolute lock time (block height or unix time) and sign it
+func (acc Account) ProduceLockedTransferTx(to string, amount int, lockTime uint32) (*Transaction, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewFundedTransaction(acc.PubKeyBytes, to, amount, utxos, acc.Funding)
+	if err != nil {
+		return nil, err
+	}
+	tx.SetLockTime(lockTime)
+	err = acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+//add the signature of the account to a multisig transaction
+func (acc Account) CoSignTransaction(tx *Transaction) error {
+	return acc.Blockchain.SignTransaction(tx, acc.PrivateKey)
+}
+
+//get balance of a P2SH address known by the account
+func (acc Account) GetMultisigBalance(address string) int {
+	redeemScript, ok := acc.RedeemScripts[address]
+	if !ok {
+		return 0
+	}
+	balance, _ := acc.Blockchain.FindUTXOSet().FindScriptOutputs(redeemScript)
+	return balance
+}
+
+//sign the inputs of a collaborative transaction spending the coins of the account
+func (acc Account) SignOwnInputs(tx *Transaction) error {
+	prevTXs, err := acc.Blockchain.GetInputTXsOf(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.SignOwnInputs(acc.PrivateKey, prevTXs)
+	return err
+}
+
+//create an unsigned partial transaction, only the public key of the
+//account is used so that it can be built by a watch-only wallet
+func (acc Account) CreatePartialTransaction(to string, amount int) (*PartialTransaction, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	tx, err := NewFundedTransaction(acc.PubKeyBytes, to, amount, utxos, acc.Funding)
+	if err != nil {
+		return nil, err
+	}
+	prevTXs, err := acc.Blockchain.GetInputTXsOf(tx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPartialTransaction(tx, prevTXs)
+	if err != nil {
+		return nil, err
+	}
+	//tell the signers the derivation paths of the keys of the wallet
+	if acc.HDWallet != nil {
+		if err := p.AddKeyPaths(acc.HDWallet); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+//sign a partial transaction with the private key of the account,
+//without the blockchain. Only SigHashAll inputs are signed.
+func (acc Account) SignPartialTransaction(p *PartialTransaction) error {
+	_, err := p.Sign(acc.PrivateKey, SigHashAll)
+	return err
+}
+
+//initiate an atomic swap: lock the amount in a contract redeemable by the
+//participant with a new secret, or refunded to the account after the lock time.
+//The initiator lock time must be later than the participant one.
+func (acc Account) InitiateSwap(participant string, amount int, lockTime uint32) (*SwapContract, error) {
+	secret, secretHash, err := NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	swap, err := acc.ParticipateSwap(participant, secretHash, amount, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	swap.Secret = secret
+	return swap, nil
+}
+
+//participate in an atomic swap: lock the amount in a contract redeemable by
+//the initiator with the secret of the hash found in the audited initiator contract
+func (acc Account) ParticipateSwap(initiator string, secretHash []byte, amount int, lockTime uint32) (*SwapContract, error) {
+	if !ValidateAddress(initiator) || IsScriptAddress(initiator) {
+		return nil, ErrInvalidHTLC
+	}
+	contract := HTLC{
+		SecretHash:          secretHash,
+		RecipientPubKeyHash: GetPubKeyHashFromAddress(initiator),
+		RefundPubKeyHash:    HashPubKey(acc.PubKeyBytes),
+		LockTime:            lockTime,
+	}
+	contractTx, err := acc.ProduceTransferTx(contract.Address(), amount)
+	if err != nil {
+		return nil, err
+	}
+	return &SwapContract{Contract: contract.Script(), ContractTx: contractTx, SecretHash: secretHash}, nil
+}
+
+//check the contract of the counterparty: it must be mined in the blockchain
+//of the account, unspent, and redeemable by the account
+func (acc Account) AuditSwap(contract Script, contractTx *Transaction) (*ContractAudit, error) {
+	audit, err := AuditContract(contract, contractTx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := acc.Blockchain.FindTransaction(contractTx.ID); err != nil {
+		return nil, err
+	}
+	if _, ok := acc.Blockchain.FindUTXOSet()[Bytes2Hex(contractTx.ID)][audit.OutIdx]; !ok {
+		return nil, ErrContractNotFound
+	}
+	if !bytes.Equal(audit.RecipientPubKeyHash, HashPubKey(acc.PubKeyBytes)) {
+		return nil, ErrInvalidHTLC
+	}
+	return audit, nil
+}
+
+//redeem the contract of the counterparty with the secret, revealing it
+func (acc Account) RedeemSwap(contract Script, contractTx *Transaction, secret []byte) (*Transaction, error) {
+	return NewHTLCRedeemTransaction(contract, contractTx, secret, acc.Address, acc.PrivateKey)
+}
+
+//get back the coins of an own contract which was not redeemed before its lock time
+func (acc Account) RefundSwap(swap *SwapContract) (*Transaction, error) {
+	return NewHTLCRefundTransaction(swap.Contract, swap.ContractTx, acc.Address, acc.PrivateKey)
+}
+
+//open a payment channel with the owner of the public key, funded with localAmount
+//by the account and remoteAmount by the counterparty (bidirectional channels only).
+//The dispute period of the unilateral closes is delay blocks.
+func (acc Account) OpenChannel(remotePubKey []byte, localAmount int, remoteAmount int, delay uint32, bidirectional bool) (*PaymentChannel, *ChannelOpen, error) {
+	utxos := acc.Blockchain.FindUTXOSet()
+	fundingTx, err := NewChannelFundingTransaction(acc.PubKeyBytes, remotePubKey, localAmount, remoteAmount, utxos)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewPaymentChannel(acc.PrivateKey, remotePubKey, fundingTx, localAmount, remoteAmount, delay, bidirectional)
+}
+
+//accept a payment channel, checking the amount paid by the account
+//and signing its inputs of the funding transaction
+func (acc Account) AcceptChannel(open *ChannelOpen) (*PaymentChannel, *ChannelAccept, error) {
+	pubKeyHash := HashPubKey(acc.PubKeyBytes)
+	paid := 0
+	prevTXs, err := acc.Blockchain.GetInputTXsOf(open.FundingTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, input := range open.FundingTx.Vin {
+		output, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if output.IsLockedWithKey(pubKeyHash) {
+			paid += output.Value
+		}
+	}
+	for _, output := range open.FundingTx.Vout {
+		if output.IsLockedWithKey(pubKeyHash) {
+			paid -= output.Value
+		}
+	}
+	if paid != open.AcceptorAmount {
+		return nil, nil, ErrChannelFunding
+	}
+	ch, accept, err := AcceptPaymentChannel(acc.PrivateKey, open)
+	if err != nil {
+		return nil, nil, err
+	}
+	if open.AcceptorAmount > 0 {
+		fundingTx := *open.FundingTx
+		fundingTx.Vin = append([]TXInput{}, open.FundingTx.Vin...)
+		if _, err := fundingTx.SignOwnInputs(acc.PrivateKey, prevTXs); err != nil {
+			return nil, nil, err
+		}
+		accept.FundingTx = &fundingTx
+	}
+	return ch, accept, nil
+}
+
+//complete the opening of a payment channel by signing the inputs of the
+//account in the funding transaction, which can then be mined
+func (acc Account) CompleteChannelOpen(ch *PaymentChannel, accept *ChannelAccept) (*ChannelFunded, error) {
+	funded, err := ch.CompleteOpen(accept)
+	if err != nil {
+		return nil, err
+	}
+	prevTXs, err := acc.Blockchain.GetInputTXsOf(funded.FundingTx)
+	if err != nil {
+		return nil, err
+	}
+	fundingTx := *funded.FundingTx
+	fundingTx.Vin = append([]TXInput{}, funded.FundingTx.Vin...)
+	if _, err := fundingTx.SignOwnInputs(acc.PrivateKey, prevTXs); err != nil {
+		return nil, err
+	}
+	if err := fundingTx.Finalize(prevTXs); err != nil {
+		return nil, err
+	}
+	ch.FundingTx, funded.FundingTx = &fundingTx, &fundingTx
+	return funded, nil
+}
+
+//check that the funding transaction of a payment channel is fully signed
+//before opening the channel
+func (acc Account) ReceiveChannelFunded(ch *PaymentChannel, funded *ChannelFunded) error {
+	if !acc.Blockchain.VerifyTransaction(funded.FundingTx) {
+		return ErrChannelFunding
+	}
+	return ch.ReceiveFunded(funded)
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestMineTransactionCollectsFee(t *testing.T) {
+	privKey, _ := newKeyPair()
+	_, recipientPubKey := newKeyPair()
+	m, acc := newTestMempool(t, "alice", privKey)
+	tx := sendTestPayment(t, m, acc, GetStringAddress(GetAddress(recipientPubKey)), 1, FundingOptions{FeeRate: 5})
+	fee, err := m.Fee(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee == 0 {
+		t.Fatal("transaction pays no fee")
+	}
+	block := acc.MineTransaction(tx)
+	if block == nil {
+		t.Fatal("transaction not mined")
+	}
+	diff(t, netParams.BlockSubsidy(len(acc.Blockchain.blocks)-1)+fee, block.Transactions[0].Vout[0].Value, "coinbase value")
+}
+
+func TestMultisigTransaction(t *testing.T) {
+	alicePrivKey, alicePubKey := newKeyPair()
+	bobPrivKey, bobPubKey := newKeyPair()
+	_, carolPubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, alicePubKey)
+	alice := newTestSwapAccount("alice", alicePrivKey, bc)
+	bob := newTestSwapAccount("bob", bobPrivKey, bc)
+	pubKeys := [][]byte{alicePubKey, bobPubKey, carolPubKey}
+	if _, err := alice.NewMultisigAddress(4, pubKeys); err != ErrInvalidMultisig {
+		t.Errorf("4-of-3 multisig: got %v, want %v", err, ErrInvalidMultisig)
+	}
+	address, err := alice.NewMultisigAddress(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsScriptAddress(address) {
+		t.Errorf("%s is not a script address", address)
+	}
+	if _, err := bob.NewMultisigAddress(2, pubKeys); err != nil {
+		t.Fatal(err)
+	}
+	funding := newTestSpend(t, alicePrivKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value, address)})
+	mineTestBlock(t, bc, alicePubKey, funding)
+	diff(t, coinbaseTX.Vout[0].Value, alice.GetMultisigBalance(address), "multisig balance")
+
+	carol := GetStringAddress(GetAddress(carolPubKey))
+	if _, err := alice.ProduceMultisigTx(carol, carol, 7); err != ErrInvalidMultisig {
+		t.Errorf("spending from an unknown multisig address: got %v, want %v", err, ErrInvalidMultisig)
+	}
+	tx, err := alice.ProduceMultisigTx(address, carol, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.VerifyTransaction(tx) {
+		t.Error("transaction with 1 of 2 signatures accepted")
+	}
+	if err := bob.CoSignTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, alicePubKey, tx)
+	diff(t, coinbaseTX.Vout[0].Value-7, bob.GetMultisigBalance(address), "multisig balance after spending")
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/manifoldco/promptui"
 )
@@ -16,6 +19,26 @@ var OperationTypes=[]string{
 							"Print-balance for all users",
 							"Print-block Chain length",
 							"Print-current block",
+							"Joint transfer coins 'a' + 'b' -> 'c'",
+							"Publish data from 'a'",
+							"Find published data by prefix",
+							"Issue token from 'a'",
+							"Transfer token 'a' -> 'b'",
+							"Print-token balances for all users",
+							"Mint NFT from 'a'",
+							"Transfer NFT 'a' -> 'b'",
+							"Print-NFTs for all users",
+							"Scan HD wallets for all users",
+							"Save keys of all users to a keystore",
+							"Fund MuSig address of 'a' + 'b' from 'a'",
+							"MuSig transfer coins 'a' + 'b' -> 'c'",
+							"Print-addresses for all users",
+							"Print-transaction history of a user",
+							"Send coins from 'a' to many addresses",
+							"Mine the mempool transactions by 'a'",
+							"Bump the fee of a mempool transaction of a user",
+							"Pay the fee of a mempool transaction by a child from a user",
+							"Estimate the fee rate to confirm within a number of blocks",
 							}
 
 
@@ -85,6 +108,197 @@ func ClientLoop(users *Users) {
 			block:=users.UsersMap["a"].Blockchain.CurrentBlock()
 			fmt.Println(block.StringDetail())
 			break
+		case "8":
+			var amountB int
+			fmt.Println("Enter the amount 'a' and 'b' want to transfer: ")
+			fmt.Scanln(&amount, &amountB)
+			err:=users.JointTransfer(map[string]int{"a":amount,"b":amountB},"c","a")
+			PrintErr(err)
+			break
+		case "9":
+			var data string
+			fmt.Println("Enter the data to publish: ")
+			fmt.Scanln(&data)
+			err:=users.PublishData("a","a",[]byte(data))
+			PrintErr(err)
+			break
+		case "10":
+			var prefix string
+			fmt.Println("Enter the prefix of the data: ")
+			fmt.Scanln(&prefix)
+			for _, entry := range users.UsersMap["a"].FindData([]byte(prefix)) {
+				fmt.Printf("Block %d, TxID %x, Output %d: %q\n", entry.Height, entry.TxID, entry.OutIdx, entry.Data)
+			}
+			break
+		case "11":
+			var name string
+			var supply, decimals int
+			fmt.Println("Enter the name, supply and decimals of the token: ")
+			fmt.Scanln(&name, &supply, &decimals)
+			token, err:=users.IssueToken("a","a",name,supply,decimals)
+			PrintErr(err)
+			if err == nil {
+				fmt.Println(token)
+			}
+			break
+		case "12":
+			var tokenID string
+			fmt.Println("Enter the token ID and the amount you want to transfer: ")
+			fmt.Scanln(&tokenID, &amount)
+			err:=users.TransferToken("a","b","a",Hex2Bytes(tokenID),amount)
+			PrintErr(err)
+			break
+		case "13":
+			for _, name := range []string{"a", "b", "c"} {
+				balances:=users.UsersMap[name].GetTokenBalances()
+				for _, tokenID := range sortedTokenIDs(balances) {
+					fmt.Printf("User: '%s'. Token %s balance: %d\n", name, tokenID, balances[tokenID])
+				}
+			}
+			break
+		case "14":
+			var metadata string
+			fmt.Println("Enter the metadata of the NFT: ")
+			fmt.Scanln(&metadata)
+			nft, err:=users.MintNFT("a","a",[]byte(metadata))
+			PrintErr(err)
+			if err == nil {
+				fmt.Printf("Minted NFT %x\n", nft.ID)
+			}
+			break
+		case "15":
+			var assetID string
+			fmt.Println("Enter the ID of the NFT you want to transfer: ")
+			fmt.Scanln(&assetID)
+			err:=users.TransferNFT("a","b","a",Hex2Bytes(assetID))
+			PrintErr(err)
+			break
+		case "16":
+			for _, name := range []string{"a", "b", "c"} {
+				for _, entry := range users.UsersMap[name].ListNFTs() {
+					fmt.Printf("User: '%s'. %s\n", name, entry)
+				}
+			}
+			break
+		case "17":
+			for _, name := range []string{"a", "b", "c"} {
+				addresses, err:=users.UsersMap[name].ScanHDWallet()
+				PrintErr(err)
+				for _, addr := range addresses {
+					fmt.Printf("User: '%s'. %s %s balance: %d\n", name, addr.Path, addr.Address, addr.Balance)
+				}
+			}
+			break
+		case "18":
+			var path string
+			fmt.Println("Enter the path of the keystore file: ")
+			fmt.Scanln(&path)
+			passphrase, err:=(&promptui.Prompt{Label: "Passphrase", Mask: '*'}).Run()
+			if err != nil {
+				PrintErr(err)
+				break
+			}
+			err=users.SaveKeystore(path, passphrase)
+			PrintErr(err)
+			break
+		case "19":
+			fmt.Println("Enter the amount 'a' wants to pay to the MuSig address: ")
+			fmt.Scanln(&amount)
+			err:=users.FundMuSig("a",[]string{"a","b"},"a",amount)
+			PrintErr(err)
+			break
+		case "20":
+			fmt.Println("Enter the amount 'a' and 'b' want to transfer: ")
+			fmt.Scanln(&amount)
+			err:=users.MuSigTransfer([]string{"a","b"},"c","a",amount)
+			PrintErr(err)
+			break
+		case "21":
+			for _, name := range []string{"a", "b", "c"} {
+				acc:=users.UsersMap[name]
+				fmt.Printf("User: '%s'. Address: %s, witness address: %s, schnorr address: %s\n", name, acc.Address, acc.WitnessAddress(), acc.SchnorrAddress())
+			}
+			break
+		case "22":
+			fmt.Println("Enter the name of user to show its transaction history: ")
+			fmt.Scanln(&user)
+			acc:=users.UsersMap[user]
+			if acc.Blockchain == nil {
+				fmt.Println("unknown user")
+				break
+			}
+			history,err:=acc.ListTransactions()
+			PrintErr(err)
+			for _, tx := range history {
+				fmt.Println(tx)
+				for _, address := range tx.Counterparties {
+					if label:=acc.Labels.Address(address); label != "" {
+						fmt.Printf("  %s: %s\n", label, address)
+					}
+				}
+			}
+			break
+		case "23":
+			fmt.Println("Enter one payment per line as '<address or label> <amount>', then an empty line: ")
+			acc:=users.UsersMap["a"]
+			request:=PaymentRequest{}
+			reader:=bufio.NewReader(os.Stdin)
+			for {
+				line, _:=reader.ReadString('\n')
+				if strings.TrimSpace(line) == "" {
+					break
+				}
+				payment, err:=ParsePayment(line)
+				if err != nil {
+					PrintErr(err)
+					continue
+				}
+				if address, err:=acc.Labels.FindAddress(payment.Address); err == nil {
+					payment.Address=address
+				}
+				request=append(request, payment)
+			}
+			err:=users.SendMany("a","a",request)
+			PrintErr(err)
+			break
+		case "24":
+			block, err:=users.MineMempool()
+			PrintErr(err)
+			if err == nil {
+				fmt.Printf("Mined %d transactions\n", len(block.Transactions)-1)
+			}
+			break
+		case "25", "26":
+			var txID string
+			var feeRate int
+			fmt.Println("Enter the name of user, the ID of the transaction and the new fee rate (coins per 1000 bytes): ")
+			fmt.Scanln(&user, &txID, &feeRate)
+			acc:=users.UsersMap[user]
+			if acc.Blockchain == nil {
+				fmt.Println("unknown user")
+				break
+			}
+			bump:=acc.BumpFee
+			if result == "26" {
+				bump=acc.BumpFeeCPFP
+			}
+			tx, err:=bump(users.Mempool, Hex2Bytes(txID), feeRate)
+			PrintErr(err)
+			if err == nil {
+				fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+			}
+			break
+		case "27":
+			var target int
+			confidence:=DefaultFeeConfidence
+			fmt.Printf("Enter the number of blocks (at most %d) and the confidence (default %.2f): \n", MaxConfirmTarget, confidence)
+			fmt.Scanln(&target, &confidence)
+			feeRate, err:=users.UsersMap["a"].EstimateFeeRate(target, confidence)
+			PrintErr(err)
+			if err == nil {
+				fmt.Printf("Fee rate: %d coins per 1000 bytes\n", feeRate)
+			}
+			break
 		default:
 			break
 		}
@@ -1,12 +1,54 @@
 package main
 
-import "os"
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
 
 
 func main() {
+	network := flag.String("network", MainnetParams.Name, "network to join: mainnet, testnet or regtest")
+	mineGenesis := flag.Bool("mine-genesis", false, "mine the genesis block of a custom network based on -network and exit")
+	genesisData := flag.String("genesis-data", "", "coinbase data of the mined genesis block")
+	genesisTime := flag.Int64("genesis-time", time.Now().Unix(), "timestamp of the mined genesis block")
+	rpc := flag.Bool("rpc", false, "serve the wallet of 'a' to JSON-RPC clients on the RPC port of the network")
+	flag.Parse()
+	params, err := NetworkByName(*network)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *mineGenesis {
+		if *genesisData != "" {
+			params.GenesisCoinbaseData = *genesisData
+		}
+		params.GenesisTimestamp = *genesisTime
+		genesis := MineGenesisBlock(params)
+		fmt.Printf("GenesisCoinbaseData: %q,\nGenesisTimestamp: %d,\nGenesisNonce: %d,\nGenesisHash: \"%x\",\n",
+			params.GenesisCoinbaseData, genesis.Timestamp, genesis.Nonce, genesis.Hash)
+		return
+	}
+	SetNetworkParams(params)
+	if err := VerifyGenesisBlock(params); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	
 	deadsig := make(chan os.Signal, 1)
-	users:=NewUsers()
+	users, err:=NewUsers()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *rpc {
+		server:=NewWalletServer(users.UsersMap["a"], users.Mempool, users.Calls)
+		if err := server.Listen("127.0.0.1:"+params.RPCPort); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 	go ClientLoop(users)
 	go users.HandleChannel()
 	<-deadsig
@@ -2,36 +2,88 @@ package main
 
 type Users struct {
 	UsersMap map[string]Account
+	Mempool  *Mempool // transactions submitted to 'a', e.g. by RPC
+	Calls    chan func() // wallet calls of RPC clients, run by HandleChannel
 }
 
 func CopyBlockchain(bc *Blockchain) *Blockchain {
-	blocksCopy := []*Block{}
+	bcCopy := &Blockchain{}
 	for _, block := range bc.blocks {
 		blockCopy := *block
-		blocksCopy = append(blocksCopy, &blockCopy)
+		bcCopy.appendBlock(&blockCopy)
 	}
-	return &Blockchain{blocks: blocksCopy}
+	return bcCopy
 }
 
-func NewUsers() *Users {
-	userA := NewAccount("a")
-	userB := NewAccount("b")
-	userC := NewAccount("c")
-	userA.AddressMap = map[string]string{"b": userB.Address, "c": userC.Address}
-	userB.AddressMap = map[string]string{"a": userA.Address, "c": userC.Address}
-	userC.AddressMap = map[string]string{"b": userB.Address, "a": userA.Address}
+func NewUsers() (*Users, error) {
+	userA, err := NewAccount("a")
+	if err != nil {
+		return nil, err
+	}
+	userB, err := NewAccount("b")
+	if err != nil {
+		return nil, err
+	}
+	userC, err := NewAccount("c")
+	if err != nil {
+		return nil, err
+	}
+	for _, acc := range []Account{userA, userB, userC} {
+		for _, contact := range []Account{userA, userB, userC} {
+			if contact.Name != acc.Name {
+				PrintErr(acc.Labels.SetAddress(contact.Address, contact.Name))
+			}
+		}
+	}
 	userA.ChannelMap = map[string]chan *Block{"b": userB.BlockIn, "c": userC.BlockIn}
 	userB.ChannelMap = map[string]chan *Block{"a": userA.BlockIn, "c": userC.BlockIn}
 	userC.ChannelMap = map[string]chan *Block{"b": userB.BlockIn, "a": userA.BlockIn}
-	genesisBC, err := NewBlockchain(userA.Address)
-	PrintErr(err)
+	genesisBC, err := NewBlockchain()
+	if err != nil {
+		return nil, err
+	}
+	//the genesis output is unspendable, 'a' mines the first block
+	coinbaseTX, err := NewCoinbaseTX(userA.Address, "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := genesisBC.MineBlock([]*Transaction{coinbaseTX}); err != nil {
+		return nil, err
+	}
 
 	userA.Blockchain = CopyBlockchain(genesisBC)
 	userB.Blockchain = CopyBlockchain(genesisBC)
 	userC.Blockchain = CopyBlockchain(genesisBC)
+	//the wallets estimate their fee rate from the mempool of 'a'
+	mempool := NewMempool(userA.Blockchain)
+	userA.Funding.Estimator = mempool.FeeEstimator()
+	userB.Funding.Estimator = mempool.FeeEstimator()
+	userC.Funding.Estimator = mempool.FeeEstimator()
 	return &Users{
 		UsersMap: map[string]Account{"a": userA, "b": userB, "c": userC},
+		Mempool:  mempool,
+		Calls:    make(chan func()),
+	}, nil
+}
+
+//store the keys of all users in a new keystore file
+//encrypted with the passphrase
+func (u Users) SaveKeystore(path string, passphrase string) error {
+	kdf, err := ScryptParams()
+	if err != nil {
+		return err
 	}
+	ks, err := CreateKeystore(path, passphrase, kdf)
+	if err != nil {
+		return err
+	}
+	defer ks.Lock()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := u.UsersMap[name].SaveToKeystore(ks); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //the sender produce transfer tx, miner mine it,
@@ -46,18 +98,232 @@ func (u Users) Transfer(from string, to string, miner string, amount int) error
 	return nil
 }
 
+//the sender pays all the payments of the request in one
+//transaction, miner mine it, add to its own blockchain and
+//broadcast to other users
+func (u Users) SendMany(from string, miner string, request PaymentRequest) error {
+	tx, err := u.UsersMap[from].ProduceBatchTransferTx(request)
+	if err != nil {
+		return err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
+//'a' mines the transactions of the mempool paying the highest
+//fee rates, with their fees, add the block to its own blockchain
+//and broadcast it to other users
+func (u Users) MineMempool() (*Block, error) {
+	miner := u.UsersMap["a"]
+	txs, fees := u.Mempool.BlockTransactions(MaxBlockSize)
+	coinbaseTX, err := NewFeeCoinbaseTX(miner.Address, "", len(miner.Blockchain.blocks), fees)
+	if err != nil {
+		return nil, err
+	}
+	minedBlock, err := miner.Blockchain.MineBlock(append([]*Transaction{coinbaseTX}, txs...))
+	if err != nil {
+		return nil, err
+	}
+	u.Mempool.Remove(minedBlock.Transactions)
+	miner.BroadcastBlock(minedBlock)
+	return minedBlock, nil
+}
+
+//the sender publishes the data, miner mine it,
+//add to its own blockchain and broadcast to other users
+func (u Users) PublishData(from string, miner string, data []byte) error {
+	tx, err := u.UsersMap[from].ProduceDataTx(data)
+	if err != nil {
+		return err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
+//the issuer issues a token, miner mine it,
+//add to its own blockchain and broadcast to other users
+func (u Users) IssueToken(from string, miner string, name string, supply int, decimals int) (*Token, error) {
+	tx, token, err := u.UsersMap[from].ProduceTokenIssuanceTx(name, supply, decimals)
+	if err != nil {
+		return nil, err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return token, nil
+}
+
+//the sender transfers tokens, miner mine it,
+//add to its own blockchain and broadcast to other users
+func (u Users) TransferToken(from string, to string, miner string, tokenID []byte, amount int) error {
+	tx, err := u.UsersMap[from].ProduceTokenTransferTx(tokenID, u.UsersMap[to].Address, amount)
+	if err != nil {
+		return err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
+//the issuer mints an NFT, miner mine it,
+//add to its own blockchain and broadcast to other users
+func (u Users) MintNFT(from string, miner string, metadata []byte) (*NFT, error) {
+	tx, nft, err := u.UsersMap[from].ProduceNFTMintTx(metadata)
+	if err != nil {
+		return nil, err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nft, nil
+}
+
+//the owner transfers an NFT, miner mine it,
+//add to its own blockchain and broadcast to other users
+func (u Users) TransferNFT(from string, to string, miner string, assetID []byte) error {
+	tx, err := u.UsersMap[from].ProduceNFTTransferTx(assetID, u.UsersMap[to].Address)
+	if err != nil {
+		return err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
+//the payers build a collaborative transaction paying the given amounts,
+//pass it around to sign their own inputs, then the miner mines it
+//and broadcasts it to other users
+func (u Users) JointTransfer(from map[string]int, to string, miner string) error {
+	contributions := []Contribution{}
+	amount := 0
+	for name, value := range from {
+		contributions = append(contributions, Contribution{PubKey: u.UsersMap[name].PubKeyBytes, Amount: value})
+		amount += value
+	}
+	payments := []Payment{{Address: u.UsersMap[to].Address, Amount: amount}}
+	tx, err := NewCollaborativeTransaction(contributions, payments, u.UsersMap[miner].Blockchain.FindUTXOSet())
+	if err != nil {
+		return err
+	}
+	for name := range from {
+		if err := u.UsersMap[name].SignOwnInputs(tx); err != nil {
+			return err
+		}
+	}
+	prevTXs, err := u.UsersMap[miner].Blockchain.GetInputTXsOf(tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Finalize(prevTXs); err != nil {
+		return err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
+//aggregate the schnorr keys of the signers into a MuSig key,
+//its address looks like the address of a single key
+func (u Users) MuSigKey(signers []string) (*MuSigKeyAgg, error) {
+	pubKeys := [][]byte{}
+	for _, name := range signers {
+		pubKeys = append(pubKeys, u.UsersMap[name].SchnorrPubKey())
+	}
+	return NewMuSigKeyAgg(pubKeys)
+}
+
+//the sender pays the MuSig address of the signers, miner mine it,
+//add to its own blockchain and broadcast to other users
+func (u Users) FundMuSig(from string, signers []string, miner string, amount int) error {
+	keyAgg, err := u.MuSigKey(signers)
+	if err != nil {
+		return err
+	}
+	tx, err := u.UsersMap[from].ProduceTransferTx(keyAgg.Address(), amount)
+	if err != nil {
+		return err
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
+//the signers spend from their MuSig address: for each input they exchange
+//their nonces, then their partial signatures, which are aggregated into a
+//single schnorr signature, then the miner mines the transaction and
+//broadcasts it to other users
+func (u Users) MuSigTransfer(signers []string, to string, miner string, amount int) error {
+	keyAgg, err := u.MuSigKey(signers)
+	if err != nil {
+		return err
+	}
+	bc := u.UsersMap[miner].Blockchain
+	tx, err := NewUTXOTransaction(keyAgg.PubKey(), u.UsersMap[to].Address, amount, bc.FindUTXOSet())
+	if err != nil {
+		return err
+	}
+	prevTXs, err := bc.GetInputTXsOf(tx)
+	if err != nil {
+		return err
+	}
+	digests, err := tx.SchnorrDigests(prevTXs)
+	if err != nil {
+		return err
+	}
+	for idx, digest := range digests {
+		nonces := []*MuSigNonce{}
+		pubNonces := [][]byte{}
+		for range signers {
+			nonce, err := NewMuSigNonce()
+			if err != nil {
+				return err
+			}
+			nonces = append(nonces, nonce)
+			pubNonces = append(pubNonces, nonce.Public)
+		}
+		aggNonce, err := AggregateMuSigNonces(pubNonces)
+		if err != nil {
+			return err
+		}
+		partials := [][]byte{}
+		for i, name := range signers {
+			partial, err := u.UsersMap[name].MuSigPartialSign(keyAgg, nonces[i], aggNonce, digest)
+			if err != nil {
+				return err
+			}
+			partials = append(partials, partial)
+		}
+		signature, err := keyAgg.AggregateSignatures(aggNonce, digest, partials)
+		if err != nil {
+			return err
+		}
+		if err := tx.SignSchnorrInput(idx, signature); err != nil {
+			return err
+		}
+	}
+	minedBlock := u.UsersMap[miner].MineTransaction(tx)
+	u.UsersMap[miner].BroadcastBlock(minedBlock)
+	return nil
+}
+
 func (u *Users) HandleChannel() {
 	for {
 		select {
 		case minedBlock := <-u.UsersMap["a"].BlockIn:
 			err := u.UsersMap["a"].HandleMinedBlockIn(minedBlock)
 			PrintErr(err)
+			if err == nil {
+				u.Mempool.Remove(minedBlock.Transactions)
+			}
 		case minedBlock := <-u.UsersMap["b"].BlockIn:
 			err := u.UsersMap["b"].HandleMinedBlockIn(minedBlock)
 			PrintErr(err)
 		case minedBlock := <-u.UsersMap["c"].BlockIn:
 			err := u.UsersMap["c"].HandleMinedBlockIn(minedBlock)
 			PrintErr(err)
+		case call := <-u.Calls:
+			//between two blocks, so that the call sees a stable blockchain
+			call()
 		}
 	}
 }
\ No newline at end of file
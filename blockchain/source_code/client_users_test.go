@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestNewUsers(t *testing.T) {
+	users, err := NewUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := users.UsersMap["a"]
+	for _, name := range []string{"a", "b", "c"} {
+		acc, ok := users.UsersMap[name]
+		if !ok {
+			t.Fatalf("no account %s", name)
+		}
+		if acc.HDWallet == nil || acc.Blockchain == nil {
+			t.Fatalf("account %s not initialized", name)
+		}
+		if label := a.Labels.Address(acc.Address); name != "a" && label != name {
+			t.Errorf("label of %s: got %q", name, label)
+		}
+	}
+	// 'a' mines the first block
+	if balance := a.GetBalance(); balance != netParams.BlockSubsidy(1) {
+		t.Errorf("balance of a: got %d, want %d", balance, netParams.BlockSubsidy(1))
+	}
+}
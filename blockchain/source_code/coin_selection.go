@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// bnbMaxTries bounds the number of selections explored by BranchAndBound
+const bnbMaxTries = 100000
+
+var ErrNoExactMatch = errors.New("no selection of coins pays the amount without change")
+
+// Coin is an unspent output that can fund a transaction
+type Coin struct {
+	TxID   []byte
+	OutIdx int
+	Output TXOutput
+}
+
+// Value returns the value of the coin
+func (c Coin) Value() int {
+	return c.Output.Value
+}
+
+// coinsValue returns the value of the coins
+func coinsValue(coins []Coin) int {
+	total := 0
+	for _, c := range coins {
+		total += c.Value()
+	}
+	return total
+}
+
+// sortCoins sorts the coins by value, ascending or descending, then by
+// outpoint, so that the selections do not depend on the map order of
+// the UTXO set
+func sortCoins(coins []Coin, descending bool) {
+	sort.Slice(coins, func(i, j int) bool {
+		if coins[i].Value() != coins[j].Value() {
+			return (coins[i].Value() > coins[j].Value()) == descending
+		}
+		if c := bytes.Compare(coins[i].TxID, coins[j].TxID); c != 0 {
+			return c < 0
+		}
+		return coins[i].OutIdx < coins[j].OutIdx
+	})
+}
+
+// CoinSelectionParams describe the payment funded by the selected coins
+type CoinSelectionParams struct {
+	Target     int // value paid to the recipients
+	NumOutputs int // number of outputs paying the recipients
+	FeeRate    int // coins per 1000 bytes
+	DustLimit  int // change below the limit is given to the fee instead
+}
+
+// fee returns the fee of a transaction spending n coins, with or without change
+func (p CoinSelectionParams) fee(n int, change bool) int {
+	outputs := p.NumOutputs
+	if change {
+		outputs++
+	}
+	return TxFee(EstimateTxSize(n, outputs), p.FeeRate)
+}
+
+// changeCost returns the fee of adding a change output
+func (p CoinSelectionParams) changeCost() int {
+	return TxFee(P2PKHOutputSize, p.FeeRate)
+}
+
+// minChange returns the smallest change output
+func (p CoinSelectionParams) minChange() int {
+	if p.DustLimit > 1 {
+		return p.DustLimit
+	}
+	return 1
+}
+
+// complete returns the selection of the coins if they pay the target and
+// the fee. The excess is sent back as change, unless the change would be
+// dust: it is then given to the fee.
+func (p CoinSelectionParams) complete(coins []Coin) (*CoinSelection, bool) {
+	total := coinsValue(coins)
+	fee := p.fee(len(coins), false)
+	if len(coins) == 0 || total < p.Target+fee {
+		return nil, false
+	}
+	feeWithChange := p.fee(len(coins), true)
+	if change := total - p.Target - feeWithChange; change >= p.minChange() {
+		return &CoinSelection{Coins: coins, Fee: feeWithChange, Change: change}, true
+	}
+	return &CoinSelection{Coins: coins, Fee: total - p.Target}, true
+}
+
+// accumulate selects the coins in order until they pay the target and the fee
+func (p CoinSelectionParams) accumulate(coins []Coin) (*CoinSelection, error) {
+	for n := 1; n <= len(coins); n++ {
+		if selection, ok := p.complete(coins[:n]); ok {
+			return selection, nil
+		}
+	}
+	return nil, ErrNoFunds
+}
+
+// CoinSelection is the result of a coin selection
+type CoinSelection struct {
+	Coins  []Coin
+	Fee    int
+	Change int // value of the change output, 0 without change
+}
+
+// Total returns the value of the selected coins
+func (s *CoinSelection) Total() int {
+	return coinsValue(s.Coins)
+}
+
+// inputs returns the unsigned inputs spending the selected coins with the key
+func (s *CoinSelection) inputs(pubKey []byte, sequence uint32) []TXInput {
+	vin := []TXInput{}
+	for _, c := range s.Coins {
+		vin = append(vin, TXInput{Txid: c.TxID, OutIdx: c.OutIdx, PubKey: pubKey, Sequence: sequence})
+	}
+	return vin
+}
+
+// CoinSelector chooses the coins funding a payment
+type CoinSelector interface {
+	SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error)
+}
+
+// DefaultCoinSelector looks for a selection without change, then spends
+// the largest coins first
+var DefaultCoinSelector CoinSelector = FallbackSelector{BranchAndBound{}, LargestFirst{}}
+
+// LargestFirst spends the largest coins first, minimizing the number of inputs
+type LargestFirst struct{}
+
+// SelectCoins implements CoinSelector
+func (LargestFirst) SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	sorted := append([]Coin{}, coins...)
+	sortCoins(sorted, true)
+	return params.accumulate(sorted)
+}
+
+// SmallestFirst spends the smallest coins first, consolidating the UTXO set
+type SmallestFirst struct{}
+
+// SelectCoins implements CoinSelector
+func (SmallestFirst) SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	sorted := append([]Coin{}, coins...)
+	sortCoins(sorted, false)
+	return params.accumulate(sorted)
+}
+
+// BranchAndBound searches the coins paying the target and the fee with
+// an excess too small for a change output, given to the fee. Avoiding
+// change saves its fee and does not link a new output to the payment.
+// It fails with ErrNoExactMatch if there is no such selection.
+type BranchAndBound struct {
+	MaxTries int // bnbMaxTries if zero
+}
+
+// SelectCoins implements CoinSelector
+func (s BranchAndBound) SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	maxTries := s.MaxTries
+	if maxTries <= 0 {
+		maxTries = bnbMaxTries
+	}
+	// only the coins worth more than the fee of spending them
+	candidates := []Coin{}
+	for _, c := range coins {
+		if c.Value() > TxFee(P2PKHInputSize, params.FeeRate) {
+			candidates = append(candidates, c)
+		}
+	}
+	sortCoins(candidates, true)
+	if coinsValue(candidates) < params.Target+params.fee(1, false) {
+		return nil, ErrNoFunds
+	}
+	remaining := make([]int, len(candidates)+1)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + candidates[i].Value()
+	}
+	var best []Coin
+	bestExcess, tries := 0, 0
+	// search explores the selections including or excluding the coin i,
+	// returning true to stop the search
+	var search func(i int, selected []Coin, total int) bool
+	search = func(i int, selected []Coin, total int) bool {
+		if tries++; tries > maxTries {
+			return true
+		}
+		low := params.Target + params.fee(len(selected), false)
+		if total >= low {
+			excess := total - low
+			if len(selected) > 0 && excess < params.changeCost()+params.minChange() {
+				if best == nil || excess < bestExcess {
+					best, bestExcess = append([]Coin{}, selected...), excess
+				}
+				return excess == 0
+			}
+			// more coins would only add to the excess
+			return false
+		}
+		if i == len(candidates) || total+remaining[i] < low {
+			return false
+		}
+		if search(i+1, append(selected, candidates[i]), total+candidates[i].Value()) {
+			return true
+		}
+		return search(i+1, selected, total)
+	}
+	search(0, []Coin{}, 0)
+	if best == nil {
+		return nil, ErrNoExactMatch
+	}
+	selection, _ := params.complete(best)
+	return selection, nil
+}
+
+// RandomImprove selects random coins until they pay the target, then
+// adds random coins while they bring the change closer to the target,
+// so that change outputs look like payments and the UTXO set keeps coins
+// of the size of the payments. The selections are repeatable with a
+// seeded Rand.
+type RandomImprove struct {
+	Rand *rand.Rand // seeded with the time if nil
+}
+
+// SelectCoins implements CoinSelector
+func (s RandomImprove) SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	r := s.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	// only the coins worth more than the fee of spending them
+	shuffled := []Coin{}
+	for _, c := range coins {
+		if c.Value() > TxFee(P2PKHInputSize, params.FeeRate) {
+			shuffled = append(shuffled, c)
+		}
+	}
+	sortCoins(shuffled, true)
+	r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	selection, err := params.accumulate(shuffled)
+	if err != nil {
+		return nil, err
+	}
+	selected := selection.Coins
+	ideal, limit := 2*params.Target, 3*params.Target
+	for _, c := range shuffled[len(selected):] {
+		total := coinsValue(selected)
+		improved := total + c.Value() - TxFee(P2PKHInputSize, params.FeeRate)
+		if total >= ideal || improved > limit || ideal-total <= improved-ideal {
+			continue
+		}
+		candidate := append(append([]Coin{}, selected...), c)
+		if improvedSelection, ok := params.complete(candidate); ok {
+			selected, selection = candidate, improvedSelection
+		}
+	}
+	return selection, nil
+}
+
+// PrivacyPreserving spends together all the coins paid to the same
+// locking script, so that the addresses of the wallet are not linked by
+// later transactions spending their remaining coins. It spends the
+// smallest address paying the target alone, or the largest ones first.
+type PrivacyPreserving struct{}
+
+// SelectCoins implements CoinSelector
+func (PrivacyPreserving) SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	byScript := make(map[string][]Coin)
+	for _, c := range coins {
+		script := Bytes2Hex(c.Output.LockingScript())
+		byScript[script] = append(byScript[script], c)
+	}
+	groups := make([][]Coin, 0, len(byScript))
+	for _, group := range byScript {
+		sortCoins(group, true)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		vi, vj := coinsValue(groups[i]), coinsValue(groups[j])
+		if vi != vj {
+			return vi < vj
+		}
+		return bytes.Compare(groups[i][0].Output.LockingScript(), groups[j][0].Output.LockingScript()) < 0
+	})
+	for _, group := range groups {
+		if selection, ok := params.complete(group); ok {
+			return selection, nil
+		}
+	}
+	selected := []Coin{}
+	for i := len(groups) - 1; i >= 0; i-- {
+		selected = append(selected, groups[i]...)
+		if selection, ok := params.complete(selected); ok {
+			return selection, nil
+		}
+	}
+	return nil, ErrNoFunds
+}
+
+// FallbackSelector tries each selector in turn, returning the first
+// selection found or the error of the last selector
+type FallbackSelector []CoinSelector
+
+// SelectCoins implements CoinSelector
+func (f FallbackSelector) SelectCoins(coins []Coin, params CoinSelectionParams) (*CoinSelection, error) {
+	err := ErrNoFunds
+	for _, selector := range f {
+		var selection *CoinSelection
+		if selection, err = selector.SelectCoins(coins, params); err == nil {
+			return selection, nil
+		}
+	}
+	return nil, err
+}
+
+// Coins returns the unspent outputs locked to the public key hash which
+// carry no token nor NFT, sorted by outpoint
+func (u UTXOSet) Coins(pubKeyHash []byte) []Coin {
+	return u.coins(func(out TXOutput) bool { return out.IsLockedWithKey(pubKeyHash) })
+}
+
+// ScriptCoins returns the unspent outputs locked to the hash of the
+// redeem script which carry no token nor NFT, sorted by outpoint
+func (u UTXOSet) ScriptCoins(redeemScript Script) []Coin {
+	return u.coins(func(out TXOutput) bool { return out.IsLockedWithScript(redeemScript) })
+}
+
+// coins returns the unspent outputs matching the lock which carry no
+// token nor NFT, sorted by outpoint
+func (u UTXOSet) coins(locked func(out TXOutput) bool) []Coin {
+	coins := []Coin{}
+	for txID, outputs := range u {
+		for outIdx, out := range outputs {
+			if locked(out) && !out.HasToken() && out.NFT == nil {
+				coins = append(coins, Coin{TxID: Hex2Bytes(txID), OutIdx: outIdx, Output: out})
+			}
+		}
+	}
+	sort.Slice(coins, func(i, j int) bool {
+		if c := bytes.Compare(coins[i].TxID, coins[j].TxID); c != 0 {
+			return c < 0
+		}
+		return coins[i].OutIdx < coins[j].OutIdx
+	})
+	return coins
+}
+
+// FundingOptions choose the coins funding a transaction and its fee
+type FundingOptions struct {
+	Selector      CoinSelector  // DefaultCoinSelector if nil
+	FeeRate       int           // coins per 1000 bytes, estimated if 0 and Estimator is set
+	DustLimit     int           // smallest change output, DustLimit(FeeRate) if larger
+	Replaceable   bool          // signal that the transaction can be replaced by fee
+	Estimator     *FeeEstimator // estimates the fee rate if FeeRate is 0
+	ConfirmTarget int           // blocks to confirm within, DefaultConfirmTarget if 0
+}
+
+// feeRate returns the fee rate of the funded transactions: the one of the
+// options, or the one confirming within the target, if it can be estimated
+func (o FundingOptions) feeRate() int {
+	if o.FeeRate != 0 || o.Estimator == nil {
+		return o.FeeRate
+	}
+	target := o.ConfirmTarget
+	if target == 0 {
+		target = DefaultConfirmTarget
+	}
+	feeRate, err := o.Estimator.EstimateFeeRate(target, DefaultFeeConfidence)
+	if err != nil {
+		return 0
+	}
+	return feeRate
+}
+
+// sequence returns the sequence of the inputs of the funded transactions
+func (o FundingOptions) sequence() uint32 {
+	if o.Replaceable {
+		return SequenceReplaceable
+	}
+	return SequenceFinal
+}
+
+// selectCoins selects the coins of the key paying the outputs and the fee
+func (o FundingOptions) selectCoins(pubKeyHash []byte, target, numOutputs int, utxos UTXOSet) (*CoinSelection, error) {
+	selector := o.Selector
+	if selector == nil {
+		selector = DefaultCoinSelector
+	}
+	feeRate := o.feeRate()
+	dustLimit := DustLimit(feeRate)
+	if o.DustLimit > dustLimit {
+		dustLimit = o.DustLimit
+	}
+	params := CoinSelectionParams{Target: target, NumOutputs: numOutputs, FeeRate: feeRate, DustLimit: dustLimit}
+	return selector.SelectCoins(utxos.Coins(pubKeyHash), params)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// newTestCoins returns coins of the values locked to the public key hash,
+// the outpoint of each coin being its index
+func newTestCoins(pubKeyHash []byte, values ...int) []Coin {
+	coins := []Coin{}
+	for i, value := range values {
+		out := TXOutput{Value: value, PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)}
+		coins = append(coins, Coin{TxID: []byte{pubKeyHash[0], byte(i)}, OutIdx: i, Output: out})
+	}
+	return coins
+}
+
+// coinValues returns the values of the coins
+func coinValues(coins []Coin) []int {
+	values := []int{}
+	for _, c := range coins {
+		values = append(values, c.Value())
+	}
+	return values
+}
+
+func TestSelectCoins(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{1}, 20)
+	otherPubKeyHash := bytes.Repeat([]byte{2}, 20)
+	coins := newTestCoins(pubKeyHash, 1, 5, 10, 3)
+	// an input costs 149 at the fee rate 1000
+	feeCoins := newTestCoins(pubKeyHash, 100, 1000, 1000)
+	privacyCoins := append(newTestCoins(pubKeyHash, 5, 5), newTestCoins(otherPubKeyHash, 20)...)
+	tests := []struct {
+		name     string
+		selector CoinSelector
+		coins    []Coin
+		params   CoinSelectionParams
+		want     []int // values of the selected coins
+		change   int
+		fee      int
+		err      error
+	}{
+		{"largest first", LargestFirst{}, coins, CoinSelectionParams{Target: 6, NumOutputs: 1}, []int{10}, 4, 0, nil},
+		{"largest first dust change", LargestFirst{}, coins, CoinSelectionParams{Target: 6, NumOutputs: 1, DustLimit: 5}, []int{10}, 0, 4, nil},
+		{"largest first not enough", LargestFirst{}, coins, CoinSelectionParams{Target: 20, NumOutputs: 1}, nil, 0, 0, ErrNoFunds},
+		{"smallest first", SmallestFirst{}, coins, CoinSelectionParams{Target: 6, NumOutputs: 1}, []int{1, 3, 5}, 3, 0, nil},
+		{"smallest first with fee", SmallestFirst{}, feeCoins, CoinSelectionParams{Target: 500, NumOutputs: 1, FeeRate: 1000}, []int{100, 1000}, 226, 374, nil},
+		{"branch and bound exact", BranchAndBound{}, coins, CoinSelectionParams{Target: 14, NumOutputs: 1}, []int{10, 3, 1}, 0, 0, nil},
+		{"branch and bound excess below change cost", BranchAndBound{}, feeCoins, CoinSelectionParams{Target: 700, NumOutputs: 1, FeeRate: 1000, DustLimit: DustLimit(1000)}, []int{1000}, 0, 300, nil},
+		{"branch and bound no match", BranchAndBound{}, newTestCoins(pubKeyHash, 3, 9), CoinSelectionParams{Target: 10, NumOutputs: 1}, nil, 0, 0, ErrNoExactMatch},
+		{"branch and bound coins worth less than their fee", BranchAndBound{}, feeCoins[:1], CoinSelectionParams{Target: 1, NumOutputs: 1, FeeRate: 1000}, nil, 0, 0, ErrNoFunds},
+		{"privacy preserving smallest address", PrivacyPreserving{}, privacyCoins, CoinSelectionParams{Target: 8, NumOutputs: 1}, []int{5, 5}, 2, 0, nil},
+		{"privacy preserving other address", PrivacyPreserving{}, privacyCoins, CoinSelectionParams{Target: 15, NumOutputs: 1}, []int{20}, 5, 0, nil},
+		{"privacy preserving all addresses", PrivacyPreserving{}, privacyCoins, CoinSelectionParams{Target: 25, NumOutputs: 1}, []int{20, 5, 5}, 5, 0, nil},
+		{"fallback not enough funds", DefaultCoinSelector, coins, CoinSelectionParams{Target: 20, NumOutputs: 1, DustLimit: 100}, nil, 0, 0, ErrNoFunds},
+		{"fallback exact match", DefaultCoinSelector, coins, CoinSelectionParams{Target: 8, NumOutputs: 1}, []int{5, 3}, 0, 0, nil},
+		{"fallback without match", DefaultCoinSelector, coins, CoinSelectionParams{Target: 7, NumOutputs: 1}, []int{10}, 3, 0, nil},
+		{"fallback error of the last selector", FallbackSelector{BranchAndBound{}}, newTestCoins(pubKeyHash, 3, 9), CoinSelectionParams{Target: 10, NumOutputs: 1}, nil, 0, 0, ErrNoExactMatch},
+	}
+	for _, test := range tests {
+		selection, err := test.selector.SelectCoins(test.coins, test.params)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		diff(t, test.want, coinValues(selection.Coins), test.name+": selected coins")
+		diff(t, test.change, selection.Change, test.name+": change")
+		diff(t, test.fee, selection.Fee, test.name+": fee")
+	}
+}
+
+func TestRandomImprove(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{1}, 20)
+	coins := newTestCoins(pubKeyHash, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	params := CoinSelectionParams{Target: 10, NumOutputs: 1}
+	for seed := int64(0); seed < 20; seed++ {
+		selection, err := RandomImprove{Rand: rand.New(rand.NewSource(seed))}.SelectCoins(coins, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a seeded selection is repeatable
+		again, _ := RandomImprove{Rand: rand.New(rand.NewSource(seed))}.SelectCoins(coins, params)
+		diff(t, coinValues(selection.Coins), coinValues(again.Coins), "selected coins")
+		if total := selection.Total(); total < params.Target || total > 3*params.Target {
+			t.Errorf("seed %d: selected %d, want between %d and %d", seed, total, params.Target, 3*params.Target)
+		}
+	}
+
+	// the coins worth less than the fee of spending them are never added
+	coins = newTestCoins(pubKeyHash, 1000, 1000, 10, 10, 10, 10, 10, 10)
+	params = CoinSelectionParams{Target: 1500, NumOutputs: 1, FeeRate: 1000, DustLimit: DustLimit(1000)}
+	for seed := int64(0); seed < 200; seed++ {
+		selection, err := RandomImprove{Rand: rand.New(rand.NewSource(seed))}.SelectCoins(coins, params)
+		if err != nil || selection == nil {
+			t.Fatalf("seed %d: got %v, %v", seed, selection, err)
+		}
+		diff(t, []int{1000, 1000}, coinValues(selection.Coins), "selected coins")
+	}
+	if _, err := (RandomImprove{}).SelectCoins(coins, CoinSelectionParams{Target: 5000, NumOutputs: 1}); err != ErrNoFunds {
+		t.Errorf("got %v, want %v", err, ErrNoFunds)
+	}
+}
+
+func TestUTXOSetCoins(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{1}, 20)
+	redeemScript := Script{OP_1}
+	scriptOut := *NewTXOutput(7, GetScriptAddress(redeemScript))
+	keyOut := TXOutput{Value: 5, PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)}
+	tokenOut := keyOut
+	tokenOut.TokenID, tokenOut.TokenAmount = []byte{1}, 1
+	utxos := UTXOSet{
+		"02": {1: keyOut, 0: keyOut},
+		"01": {3: keyOut, 2: tokenOut, 4: scriptOut},
+	}
+	coins := utxos.Coins(pubKeyHash)
+	outpoints := []string{}
+	for _, c := range coins {
+		outpoints = append(outpoints, outpoint(TXInput{Txid: c.TxID, OutIdx: c.OutIdx}))
+	}
+	diff(t, []string{"01:3", "02:0", "02:1"}, outpoints, "coins of the key")
+	diff(t, []int{7}, coinValues(utxos.ScriptCoins(redeemScript)), "coins of the script")
+}
@@ -1,8 +1,157 @@
 package main
 
+import "errors"
+
+var ErrUnknownNetwork = errors.New("unknown network")
+
 // BlockReward represents the reward given by mining a new block
+//
+// Deprecated: the reward depends on the network and the height of the
+// block, see NetworkParams.BlockSubsidy.
 const BlockReward = 10
 
 // GenesisCoinbaseData contains the message of the genesis transaction.
-// Historically: https://en.bitcoin.it/wiki/File:Jonny1000thetimes.png
+//
+// Deprecated: it is the one of the main network, see
+// NetworkParams.GenesisCoinbaseData.
 const GenesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+
+// NetworkParams are the parameters of a network. Nodes of different
+// networks never accept the blocks, addresses or messages of each other.
+type NetworkParams struct {
+	Name  string
+	Magic [4]byte // prefixes the messages between the nodes of the network
+
+	// ports of the node, its RPC server and its mining pool server
+	DefaultPort string
+	RPCPort     string
+	StratumPort string
+
+	// GenesisCoinbaseData contains the message of the genesis transaction.
+	// Historically: https://en.bitcoin.it/wiki/File:Jonny1000thetimes.png
+	GenesisCoinbaseData string
+	// fixed genesis block, see MineGenesisBlock
+	GenesisTimestamp int64
+	GenesisNonce     int
+	GenesisHash      string // hex encoded
+
+	// address prefixes
+	PubKeyHashAddrID byte    // Base58Check version of the P2PKH addresses
+	ScriptHashAddrID byte    // Base58Check version of the P2SH addresses
+	Bech32HRP        string  // human-readable part of the Bech32 addresses
+	HDPrivateKeyID   [4]byte // version of the serialized extended private keys
+	HDPublicKeyID    [4]byte // version of the serialized extended public keys
+	HDCoinType       uint32  // BIP44 coin type of the account paths
+
+	KeyParams KeyParams
+
+	// TargetBits define the mining difficulty, 0 mining any nonce
+	TargetBits int
+
+	// subsidy schedule: the block reward is halved every SubsidyHalvingInterval blocks
+	BaseSubsidy            int
+	SubsidyHalvingInterval int
+}
+
+var (
+	// MainnetParams are the parameters of the main network
+	MainnetParams = NetworkParams{
+		Name:                   "mainnet",
+		Magic:                  [4]byte{0xf9, 0xbe, 0xb4, 0xd9},
+		DefaultPort:            "8333",
+		RPCPort:                "8332",
+		StratumPort:            "3333",
+		GenesisCoinbaseData:    "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+		GenesisTimestamp:       1231006505,
+		GenesisNonce:           389,
+		GenesisHash:            "00e6f2ff8136855da76493ea36ce3ec7037dd9bd8381f62c126fba8fd22805dc",
+		PubKeyHashAddrID:       0x00,
+		ScriptHashAddrID:       0x05,
+		Bech32HRP:              MainnetBech32HRP,
+		HDPrivateKeyID:         [4]byte{0x04, 0x88, 0xad, 0xe4}, // xprv
+		HDPublicKeyID:          [4]byte{0x04, 0x88, 0xb2, 0x1e}, // xpub
+		HDCoinType:             0,
+		KeyParams:              Secp256k1KeyParams,
+		TargetBits:             8,
+		BaseSubsidy:            10,
+		SubsidyHalvingInterval: 210000,
+	}
+	// TestnetParams are the parameters of the long-running test network
+	TestnetParams = NetworkParams{
+		Name:                   "testnet",
+		Magic:                  [4]byte{0x0b, 0x11, 0x09, 0x07},
+		DefaultPort:            "18333",
+		RPCPort:                "18332",
+		StratumPort:            "13333",
+		GenesisCoinbaseData:    "Testnet: The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+		GenesisTimestamp:       1296688602,
+		GenesisNonce:           1244,
+		GenesisHash:            "005e488c88ad9822bc768fc7149481e7b8a70bbc5703494c6f8497c146219aeb",
+		PubKeyHashAddrID:       0x6f,
+		ScriptHashAddrID:       0xc4,
+		Bech32HRP:              TestnetBech32HRP,
+		HDPrivateKeyID:         [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+		HDPublicKeyID:          [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+		HDCoinType:             1,
+		KeyParams:              Secp256k1KeyParams,
+		TargetBits:             8,
+		BaseSubsidy:            10,
+		SubsidyHalvingInterval: 210000,
+	}
+	// RegtestParams are the parameters of local test networks, whose
+	// blocks are mined instantly
+	RegtestParams = NetworkParams{
+		Name:                   "regtest",
+		Magic:                  [4]byte{0xfa, 0xbf, 0xb5, 0xda},
+		DefaultPort:            "18444",
+		RPCPort:                "18443",
+		StratumPort:            "18445",
+		GenesisCoinbaseData:    "Regtest",
+		GenesisTimestamp:       1296688602,
+		GenesisNonce:           0,
+		GenesisHash:            "90d916351ff1fd2c883fdb604f440c3ea05491f7bd72ac436114c81040646894",
+		PubKeyHashAddrID:       0x6f,
+		ScriptHashAddrID:       0xc4,
+		Bech32HRP:              RegtestBech32HRP,
+		HDPrivateKeyID:         [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+		HDPublicKeyID:          [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+		HDCoinType:             1,
+		KeyParams:              Secp256k1KeyParams,
+		TargetBits:             0,
+		BaseSubsidy:            10,
+		SubsidyHalvingInterval: 150,
+	}
+)
+
+// netParams are the parameters of the network in use
+var netParams = MainnetParams
+
+// SetNetworkParams selects the network in use, with its key parameters.
+// It must be called before creating any key, address or blockchain.
+func SetNetworkParams(params NetworkParams) {
+	netParams = params
+	SetKeyParams(params.KeyParams)
+	setAddressVersions(params)
+}
+
+// NetworkByName returns the parameters of a predefined network
+func NetworkByName(name string) (NetworkParams, error) {
+	for _, params := range []NetworkParams{MainnetParams, TestnetParams, RegtestParams} {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+	return NetworkParams{}, ErrUnknownNetwork
+}
+
+// BlockSubsidy returns the reward of the coinbase of the block at the height
+func (p NetworkParams) BlockSubsidy(height int) int {
+	if p.SubsidyHalvingInterval <= 0 {
+		return p.BaseSubsidy
+	}
+	halvings := height / p.SubsidyHalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return p.BaseSubsidy >> uint(halvings)
+}
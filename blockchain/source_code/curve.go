@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// SignatureEncoding is the encoding of the ECDSA signatures
+type SignatureEncoding int
+
+const (
+	SigEncodingFixed SignatureEncoding = iota // R and S, each padded to the size of the curve order
+	SigEncodingDER                            // strict ASN.1 DER sequence of R and S (BIP66)
+)
+
+const (
+	pubKeyCompressedEven = 0x02
+	pubKeyCompressedOdd  = 0x03
+	pubKeyUncompressed   = 0x04
+)
+
+var (
+	ErrInvalidPubKey    = errors.New("invalid public key encoding")
+	ErrInvalidSignature = errors.New("invalid signature encoding")
+)
+
+// KeyParams are the curve of the keys and the encodings of the public
+// keys and signatures of a network
+type KeyParams struct {
+	Name              string
+	Curve             elliptic.Curve
+	CompressedPubKeys bool // SEC1 compressed (33 bytes) or uncompressed (65 bytes) public keys
+	SigEncoding       SignatureEncoding
+	HDSeedKey         []byte // HMAC key deriving the HD master keys (BIP32, SLIP-0010)
+}
+
+var (
+	// Secp256k1KeyParams are the keys of Bitcoin
+	Secp256k1KeyParams = KeyParams{
+		Name:              "secp256k1",
+		Curve:             S256(),
+		CompressedPubKeys: true,
+		SigEncoding:       SigEncodingDER,
+		HDSeedKey:         []byte("Bitcoin seed"),
+	}
+	// P256KeyParams are NIST P-256 keys with uncompressed public keys and
+	// fixed size signatures
+	P256KeyParams = KeyParams{
+		Name:              "P-256",
+		Curve:             elliptic.P256(),
+		CompressedPubKeys: false,
+		SigEncoding:       SigEncodingFixed,
+		HDSeedKey:         []byte("Nist256p1 seed"),
+	}
+)
+
+// keyParams are the key parameters of the network in use
+var keyParams = Secp256k1KeyParams
+
+// SetKeyParams selects the key parameters of the network in use
+func SetKeyParams(params KeyParams) {
+	keyParams = params
+}
+
+// byteLen returns the size in bytes of the field elements and scalars of the curve
+func byteLen(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// marshalPubKey returns the SEC1 encoding of the point, compressed or not
+func marshalPubKey(curve elliptic.Curve, x, y *big.Int, compressed bool) []byte {
+	size := byteLen(curve)
+	if compressed {
+		data := make([]byte, 1+size)
+		data[0] = pubKeyCompressedEven + byte(y.Bit(0))
+		x.FillBytes(data[1:])
+		return data
+	}
+	data := make([]byte, 1+2*size)
+	data[0] = pubKeyUncompressed
+	x.FillBytes(data[1 : 1+size])
+	y.FillBytes(data[1+size:])
+	return data
+}
+
+// unmarshalPubKey returns the point of a SEC1 encoded public key
+func unmarshalPubKey(curve elliptic.Curve, data []byte) (*big.Int, *big.Int, error) {
+	size := byteLen(curve)
+	switch {
+	case len(data) == 1+size && (data[0] == pubKeyCompressedEven || data[0] == pubKeyCompressedOdd):
+		var x, y *big.Int
+		if curve.Params() == S256().Params() {
+			x, y = secp256k1.decompress(new(big.Int).SetBytes(data[1:]), data[0] == pubKeyCompressedOdd)
+		} else {
+			x, y = elliptic.UnmarshalCompressed(curve, data)
+		}
+		if x == nil {
+			return nil, nil, ErrInvalidPubKey
+		}
+		return x, y, nil
+	case len(data) == 1+2*size && data[0] == pubKeyUncompressed:
+		x := new(big.Int).SetBytes(data[1 : 1+size])
+		y := new(big.Int).SetBytes(data[1+size:])
+		if !curve.IsOnCurve(x, y) {
+			return nil, nil, ErrInvalidPubKey
+		}
+		return x, y, nil
+	}
+	return nil, nil, ErrInvalidPubKey
+}
+
+// ParsePubKey returns the public key of its encoding
+func ParsePubKey(data []byte) (*ecdsa.PublicKey, error) {
+	x, y, err := unmarshalPubKey(keyParams.Curve, data)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: keyParams.Curve, X: x, Y: y}, nil
+}
+
+// ecdsaSignature is the ASN.1 structure of the DER signatures
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// encodeSignature encodes R and S with the encoding
+func encodeSignature(curve elliptic.Curve, r, s *big.Int, encoding SignatureEncoding) ([]byte, error) {
+	if encoding == SigEncodingDER {
+		return asn1.Marshal(ecdsaSignature{r, s})
+	}
+	size := byteLen(curve)
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature, nil
+}
+
+// decodeSignature returns R and S of an encoded signature. DER signatures
+// must be strictly encoded, so that they cannot be altered.
+func decodeSignature(curve elliptic.Curve, signature []byte, encoding SignatureEncoding) (*big.Int, *big.Int, error) {
+	if encoding == SigEncodingDER {
+		var sig ecdsaSignature
+		rest, err := asn1.Unmarshal(signature, &sig)
+		if err != nil || len(rest) != 0 || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+			return nil, nil, ErrInvalidSignature
+		}
+		if strict, err := asn1.Marshal(sig); err != nil || !bytes.Equal(strict, signature) {
+			return nil, nil, ErrInvalidSignature
+		}
+		return sig.R, sig.S, nil
+	}
+	size := byteLen(curve)
+	if len(signature) != 2*size {
+		return nil, nil, ErrInvalidSignature
+	}
+	return new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:]), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+var ErrInvalidDataOutput = errors.New("data carrier output must have no value")
+
+// NewDataTransaction creates a transaction publishing the data in a data
+// carrier output. The sender outputs are spent and sent back as change.
+// NOTE: The returned tx is NOT signed!
+func NewDataTransaction(pubKey []byte, data []byte, utxos UTXOSet) (*Transaction, error) {
+	dataOutput, err := NewDataOutput(data)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := HashPubKey(pubKey)
+	// at least one input is needed, the data itself costs nothing
+	selection := &CoinSelection{Coins: utxos.Coins(pubKeyHash)}
+	if selection.Total() <= 0 {
+		return nil, ErrNoFunds
+	}
+	change := TXOutput{Value: selection.Total(), PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)}
+	tx := &Transaction{Vin: selection.inputs(pubKey, SequenceFinal), Vout: []TXOutput{*dataOutput, change}}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
+
+// CheckDataOutputs checks the size and value of the data carrier outputs
+func (tx *Transaction) CheckDataOutputs() error {
+	for _, out := range tx.Vout {
+		if !out.LockingScript().IsNullData() {
+			continue
+		}
+		if out.Value != 0 {
+			return ErrInvalidDataOutput
+		}
+		if len(out.Data()) > MaxDataCarrierSize {
+			return ErrDataTooLarge
+		}
+	}
+	return nil
+}
+
+// DataEntry locates data published in a data carrier output
+type DataEntry struct {
+	Data   []byte
+	TxID   []byte
+	OutIdx int
+	Height int // height of the block containing the transaction
+}
+
+// DataIndex indexes the data carrier outputs of a blockchain by their data,
+// to look up the transactions anchoring data starting with a prefix
+type DataIndex struct {
+	entries []DataEntry // sorted by data
+	height  int         // number of indexed blocks
+}
+
+// NewDataIndex creates the index of the data published in the blockchain
+func NewDataIndex(bc *Blockchain) *DataIndex {
+	idx := &DataIndex{}
+	idx.Update(bc)
+	return idx
+}
+
+// Update indexes the blocks added to the blockchain since the last update
+func (idx *DataIndex) Update(bc *Blockchain) {
+	for ; idx.height < len(bc.blocks); idx.height++ {
+		for _, tx := range bc.blocks[idx.height].Transactions {
+			for outIdx, out := range tx.Vout {
+				if out.IsDataCarrier() {
+					idx.add(DataEntry{Data: out.Data(), TxID: tx.ID, OutIdx: outIdx, Height: idx.height})
+				}
+			}
+		}
+	}
+}
+
+// add inserts an entry keeping the entries sorted by data
+func (idx *DataIndex) add(entry DataEntry) {
+	i := sort.Search(len(idx.entries), func(i int) bool {
+		return bytes.Compare(idx.entries[i].Data, entry.Data) > 0
+	})
+	idx.entries = append(idx.entries, DataEntry{})
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = entry
+}
+
+// FindByPrefix returns the entries whose data starts with the prefix
+func (idx *DataIndex) FindByPrefix(prefix []byte) []DataEntry {
+	i := sort.Search(len(idx.entries), func(i int) bool {
+		return bytes.Compare(idx.entries[i].Data, prefix) >= 0
+	})
+	found := []DataEntry{}
+	for ; i < len(idx.entries) && bytes.HasPrefix(idx.entries[i].Data, prefix); i++ {
+		found = append(found, idx.entries[i])
+	}
+	return found
+}
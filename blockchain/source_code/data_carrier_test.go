@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDataCarrier(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, _ := newTestChain(t, pubKey)
+	acc := newTestSwapAccount("alice", privKey, bc)
+	if _, err := NewDataTransaction(pubKey, make([]byte, MaxDataCarrierSize+1), bc.FindUTXOSet()); err != ErrDataTooLarge {
+		t.Errorf("oversized data: got %v, want %v", err, ErrDataTooLarge)
+	}
+	_, otherPubKey := newKeyPair()
+	if _, err := NewDataTransaction(otherPubKey, []byte("doc"), bc.FindUTXOSet()); err != ErrNoFunds {
+		t.Errorf("data of a key without coins: got %v, want %v", err, ErrNoFunds)
+	}
+
+	for _, data := range []string{"doc:b", "doc:a", "other"} {
+		tx, err := NewDataTransaction(pubKey, []byte(data), bc.FindUTXOSet())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.SignTransaction(tx, privKey); err != nil {
+			t.Fatal(err)
+		}
+		mineTestBlock(t, bc, otherPubKey, tx)
+	}
+	found := [][]byte{}
+	for _, entry := range acc.FindData([]byte("doc:")) {
+		found = append(found, entry.Data)
+	}
+	diff(t, [][]byte{[]byte("doc:a"), []byte("doc:b")}, found, "data of the prefix")
+	diff(t, 0, len(acc.FindData([]byte("none"))), "data of an unknown prefix")
+
+	// the data outputs are not spendable
+	for _, outputs := range bc.FindUTXOSet() {
+		for _, out := range outputs {
+			if out.IsDataCarrier() {
+				t.Errorf("data output %x in the UTXO set", out.Data())
+			}
+		}
+	}
+	diff(t, netParams.BlockSubsidy(1), acc.GetBalance(), "balance")
+
+	valued := &Transaction{Vout: []TXOutput{{Value: 1, ScriptPubKey: NullDataScript([]byte("doc"))}}}
+	if err := valued.CheckDataOutputs(); err != ErrInvalidDataOutput {
+		t.Errorf("data output with a value: got %v, want %v", err, ErrInvalidDataOutput)
+	}
+	large := &Transaction{Vout: []TXOutput{{ScriptPubKey: NullDataScript(bytes.Repeat([]byte{1}, MaxDataCarrierSize+1))}}}
+	if err := large.CheckDataOutputs(); err != ErrDataTooLarge {
+		t.Errorf("oversized data output: got %v, want %v", err, ErrDataTooLarge)
+	}
+}
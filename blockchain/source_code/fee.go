@@ -0,0 +1,85 @@
+package main
+
+import "errors"
+
+// Fees are paid in coins per 1000 bytes of transaction. The size of a
+// transaction is the size of its Bitcoin serialization, estimated before
+// signing from the size of the unlocking scripts of P2PKH inputs.
+const (
+	txOverheadSize     = 10  // version, locktime and input and output counts
+	txInputBaseSize    = 41  // outpoint, sequence and script length
+	txOutputBaseSize   = 9   // value and script length
+	p2pkhScriptSigSize = 107 // <signature> <public key>
+	p2pkhScriptSize    = 25
+	P2PKHInputSize     = txInputBaseSize + p2pkhScriptSigSize
+	P2PKHOutputSize    = txOutputBaseSize + p2pkhScriptSize
+)
+
+var ErrNegativeFee = errors.New("transaction outputs exceed its inputs")
+
+// TxFee returns the fee of a transaction of the size at the fee rate,
+// rounded up
+func TxFee(size int, feeRate int) int {
+	if feeRate <= 0 {
+		return 0
+	}
+	return (size*feeRate + 999) / 1000
+}
+
+// EstimateTxSize returns the size of a transaction spending P2PKH inputs
+// to P2PKH outputs
+func EstimateTxSize(numInputs, numOutputs int) int {
+	return txOverheadSize + numInputs*P2PKHInputSize + numOutputs*P2PKHOutputSize
+}
+
+// DustLimit returns the value below which a P2PKH output costs more to
+// spend than it is worth at the fee rate
+func DustLimit(feeRate int) int {
+	return TxFee(P2PKHInputSize+P2PKHOutputSize, feeRate)
+}
+
+// Size returns the size of the transaction, the inputs not signed yet
+// counting as signed P2PKH inputs
+func (tx *Transaction) Size() int {
+	size := txOverheadSize
+	for _, in := range tx.Vin {
+		if len(in.ScriptSig) == 0 {
+			size += P2PKHInputSize
+		} else {
+			size += txInputBaseSize + len(in.ScriptSig)
+		}
+	}
+	for _, out := range tx.Vout {
+		size += txOutputBaseSize + len(out.LockingScript())
+	}
+	return size
+}
+
+// Fee returns the value of the spent outputs not paid to the outputs of
+// the transaction
+func (tx *Transaction) Fee(prevTXs map[string]*Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+	prevOuts, err := tx.spentOutputs(prevTXs)
+	if err != nil {
+		return 0, err
+	}
+	fee := 0
+	for _, out := range prevOuts {
+		fee += out.Value
+	}
+	for _, out := range tx.Vout {
+		fee -= out.Value
+	}
+	if fee < 0 {
+		return 0, ErrNegativeFee
+	}
+	return fee, nil
+}
+
+// FeeRate returns the fee rate of a transaction paying the fee, in coins
+// per 1000 bytes
+func (tx *Transaction) FeeRate(fee int) int {
+	return fee * 1000 / tx.Size()
+}
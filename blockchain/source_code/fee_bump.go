@@ -0,0 +1,108 @@
+package main
+
+import "errors"
+
+var (
+	ErrFeeRateTooLow  = errors.New("fee rate does not increase the fee of the transaction")
+	ErrNoChildOutputs = errors.New("transaction has no output of the key to spend")
+)
+
+// NewBumpFeeTransaction creates a replacement of a transaction of the key
+// paying the fee rate, at least the fee of the original transaction and
+// the incremental relay fee. It spends the same inputs to the same
+// recipients, the additional fee being taken from the change, dropped
+// if it becomes dust, then from the largest coins of the UTXO set.
+func NewBumpFeeTransaction(pubKey []byte, orig *Transaction, prevTXs map[string]*Transaction, feeRate int, utxos UTXOSet) (*Transaction, error) {
+	if !orig.SignalsReplacement() {
+		return nil, ErrTxNotReplaceable
+	}
+	origFee, err := orig.Fee(prevTXs)
+	if err != nil {
+		return nil, err
+	}
+	if feeRate <= orig.FeeRate(origFee) {
+		return nil, ErrFeeRateTooLow
+	}
+	pubKeyHash := HashPubKey(pubKey)
+	change := TXOutput{PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)}
+	recipients := []TXOutput{}
+	for _, out := range orig.Vout {
+		// the change is the output of the key, the last one
+		if out.IsLockedWithKey(pubKeyHash) {
+			change = out
+		} else {
+			recipients = append(recipients, out)
+		}
+	}
+	vin := []TXInput{}
+	available := 0
+	for _, in := range orig.Vin {
+		out, err := prevOutput(prevTXs, in)
+		if err != nil {
+			return nil, err
+		}
+		available += out.Value
+		vin = append(vin, TXInput{Txid: in.Txid, OutIdx: in.OutIdx, PubKey: pubKey, Sequence: SequenceReplaceable})
+	}
+	for _, out := range recipients {
+		available -= out.Value
+	}
+	requiredFee := func(tx *Transaction) int {
+		fee := TxFee(tx.Size(), feeRate)
+		if minFee := origFee + TxFee(tx.Size(), IncrementalRelayFee); fee < minFee {
+			fee = minFee
+		}
+		return fee
+	}
+	coins := utxos.Coins(pubKeyHash)
+	sortCoins(coins, true)
+	for {
+		tx := &Transaction{Vin: vin, Vout: append(append([]TXOutput{}, recipients...), change), LockTime: orig.LockTime}
+		if value := available - requiredFee(tx); value >= DustLimit(feeRate) && value > 0 {
+			tx.Vout[len(tx.Vout)-1].Value = value
+			tx.ID = tx.Hash()
+			return tx, nil
+		}
+		tx.Vout = tx.Vout[:len(tx.Vout)-1]
+		if len(tx.Vout) > 0 && available >= requiredFee(tx) {
+			// the change is dust, left to the miners
+			tx.ID = tx.Hash()
+			return tx, nil
+		}
+		if len(coins) == 0 {
+			return nil, ErrNoFunds
+		}
+		vin = append(vin, TXInput{Txid: coins[0].TxID, OutIdx: coins[0].OutIdx, PubKey: pubKey, Sequence: SequenceReplaceable})
+		available += coins[0].Value()
+		coins = coins[1:]
+	}
+}
+
+// NewChildPaysForParentTransaction creates a transaction spending the
+// outputs of the key of an unconfirmed parent transaction paying the fee,
+// back to the key, so that both transactions pay the fee rate together
+func NewChildPaysForParentTransaction(pubKey []byte, parent *Transaction, parentFee int, feeRate int) (*Transaction, error) {
+	pubKeyHash := HashPubKey(pubKey)
+	vin := []TXInput{}
+	value := 0
+	for outIdx, out := range parent.Vout {
+		if out.IsLockedWithKey(pubKeyHash) && !out.HasToken() && out.NFT == nil {
+			vin = append(vin, TXInput{Txid: parent.ID, OutIdx: outIdx, PubKey: pubKey, Sequence: SequenceReplaceable})
+			value += out.Value
+		}
+	}
+	if len(vin) == 0 {
+		return nil, ErrNoChildOutputs
+	}
+	tx := &Transaction{Vin: vin, Vout: []TXOutput{{PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)}}}
+	fee := TxFee(parent.Size()+tx.Size(), feeRate) - parentFee
+	if fee <= 0 {
+		return nil, ErrFeeRateTooLow
+	}
+	if value-fee < DustLimit(feeRate) || value <= fee {
+		return nil, ErrNoFunds
+	}
+	tx.Vout[0].Value = value - fee
+	tx.ID = tx.Hash()
+	return tx, nil
+}
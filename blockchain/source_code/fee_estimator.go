@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+// Fee estimation, after the estimator of Bitcoin Core: the transactions
+// entering the mempool are tracked by fee rate bucket, and the number of
+// blocks they took to be mined is recorded, the history decaying with
+// each block. The transactions still waiting in the mempool count as
+// not confirmed within the blocks they have been waiting for.
+// https://github.com/bitcoin/bitcoin/blob/master/src/policy/fees.h
+const (
+	// MaxConfirmTarget is the largest number of blocks estimated
+	MaxConfirmTarget = 25
+	// DefaultConfirmTarget is the number of blocks the wallets target
+	DefaultConfirmTarget = 6
+	// DefaultFeeConfidence is the probability of confirmation the
+	// wallets target
+	DefaultFeeConfidence = 0.85
+	// FeeEstimatorDecay is the weight of the history at each new block
+	FeeEstimatorDecay = 0.998
+	// MinFeeSamples is the weight of transactions needed to estimate
+	MinFeeSamples = 1.0
+	// maxFeeRateBucket is the lower bound of the highest fee rate bucket
+	maxFeeRateBucket = 10000
+)
+
+var (
+	ErrNoFeeEstimate    = errors.New("not enough transactions confirmed to estimate the fee rate")
+	ErrInvalidEstimate  = errors.New("confirmation target or confidence out of range")
+	feeRateBucketBounds = newFeeRateBuckets()
+)
+
+// newFeeRateBuckets returns the lower bounds of the fee rate buckets,
+// in coins per 1000 bytes, growing by half
+func newFeeRateBuckets() []int {
+	bounds := []int{0, 1}
+	for last := 1; last < maxFeeRateBucket; {
+		last += (last + 1) / 2
+		bounds = append(bounds, last)
+	}
+	return bounds
+}
+
+// feeRateBucket returns the index of the bucket of the fee rate
+func feeRateBucket(feeRate int) int {
+	bucket := 0
+	for i, bound := range feeRateBucketBounds {
+		if feeRate >= bound {
+			bucket = i
+		}
+	}
+	return bucket
+}
+
+// trackedTx is a transaction of the mempool waiting to be mined
+type trackedTx struct {
+	height  int // height of the next block when it entered the mempool
+	feeRate int
+}
+
+// FeeEstimator estimates the fee rate confirming a transaction within a
+// number of blocks with a given confidence
+type FeeEstimator struct {
+	mu        sync.Mutex
+	tracked   map[string]trackedTx // hex ID -> transaction waiting in the mempool
+	height    int                  // height of the last processed block
+	confirmed [][]float64          // bucket -> blocks to confirm - 1 -> decayed count
+	total     []float64            // bucket -> decayed count of the confirmed transactions
+	feeRates  []float64            // bucket -> decayed sum of the fee rates of the confirmed transactions
+}
+
+// NewFeeEstimator creates an estimator without history
+func NewFeeEstimator() *FeeEstimator {
+	confirmed := make([][]float64, len(feeRateBucketBounds))
+	for i := range confirmed {
+		confirmed[i] = make([]float64, MaxConfirmTarget)
+	}
+	return &FeeEstimator{
+		tracked:   make(map[string]trackedTx),
+		confirmed: confirmed,
+		total:     make([]float64, len(feeRateBucketBounds)),
+		feeRates:  make([]float64, len(feeRateBucketBounds)),
+	}
+}
+
+// AddTransaction tracks a transaction entering the mempool at the fee
+// rate, to be mined from the block at the height
+func (e *FeeEstimator) AddTransaction(ID []byte, feeRate int, height int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tracked[Bytes2Hex(ID)] = trackedTx{height: height, feeRate: feeRate}
+}
+
+// RemoveTransaction stops tracking a transaction leaving the mempool
+// without being mined, e.g. replaced
+func (e *FeeEstimator) RemoveTransaction(ID []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.tracked, Bytes2Hex(ID))
+}
+
+// ProcessBlock records the number of blocks the tracked transactions of
+// the block at the height took to be mined
+func (e *FeeEstimator) ProcessBlock(height int, transactions []*Transaction) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if height <= e.height {
+		return
+	}
+	e.height = height
+	for bucket := range e.total {
+		e.total[bucket] *= FeeEstimatorDecay
+		e.feeRates[bucket] *= FeeEstimatorDecay
+		for i := range e.confirmed[bucket] {
+			e.confirmed[bucket][i] *= FeeEstimatorDecay
+		}
+	}
+	for _, tx := range transactions {
+		id := Bytes2Hex(tx.ID)
+		entry, ok := e.tracked[id]
+		if !ok {
+			continue
+		}
+		delete(e.tracked, id)
+		blocks := height - entry.height + 1
+		if blocks < 1 {
+			blocks = 1
+		}
+		bucket := feeRateBucket(entry.feeRate)
+		e.total[bucket]++
+		e.feeRates[bucket] += float64(entry.feeRate)
+		// confirmed within any target of at least the blocks
+		for target := blocks; target <= MaxConfirmTarget; target++ {
+			e.confirmed[bucket][target-1]++
+		}
+	}
+}
+
+// EstimateFeeRate returns the lowest fee rate, in coins per 1000 bytes,
+// at which the transactions were mined within the target number of
+// blocks with the confidence, between 0 and 1. The buckets are grouped
+// from the highest fee rate until they have enough transactions, the
+// estimate being the average fee rate of the lowest group meeting the
+// confidence, rounded up.
+func (e *FeeEstimator) EstimateFeeRate(target int, confidence float64) (int, error) {
+	if target < 1 || target > MaxConfirmTarget || confidence <= 0 || confidence > 1 {
+		return 0, ErrInvalidEstimate
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// the transactions of the mempool waiting for longer than the target
+	waiting := make([]float64, len(feeRateBucketBounds))
+	for _, entry := range e.tracked {
+		if e.height+1-entry.height >= target {
+			waiting[feeRateBucket(entry.feeRate)]++
+		}
+	}
+	estimate := -1
+	confirmed, total, feeRates, mined := 0.0, 0.0, 0.0, 0.0
+	for bucket := len(feeRateBucketBounds) - 1; bucket >= 0; bucket-- {
+		confirmed += e.confirmed[bucket][target-1]
+		total += e.total[bucket] + waiting[bucket]
+		feeRates += e.feeRates[bucket]
+		mined += e.total[bucket]
+		if total < MinFeeSamples {
+			continue
+		}
+		if confirmed/total < confidence {
+			break
+		}
+		estimate = int(math.Ceil(feeRates/mined - 1e-9))
+		confirmed, total, feeRates, mined = 0, 0, 0, 0
+	}
+	if estimate < 0 {
+		return 0, ErrNoFeeEstimate
+	}
+	return estimate, nil
+}
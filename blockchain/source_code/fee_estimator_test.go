@@ -0,0 +1,98 @@
+package main
+
+import "testing"
+
+func TestFeeRateBuckets(t *testing.T) {
+	diff(t, []int{0, 1, 2, 3, 5, 8, 12, 18, 27, 41}, feeRateBucketBounds[:10], "bucket bounds")
+	tests := map[int]int{0: 0, 1: 1, 4: 3, 5: 4, 17: 6, 18: 7, 1 << 30: len(feeRateBucketBounds) - 1}
+	for feeRate, bucket := range tests {
+		diff(t, bucket, feeRateBucket(feeRate), "bucket of the fee rate")
+	}
+}
+
+func TestEstimateFeeRate(t *testing.T) {
+	e := NewFeeEstimator()
+	if _, err := e.EstimateFeeRate(1, DefaultFeeConfidence); err != ErrNoFeeEstimate {
+		t.Errorf("empty estimator: got %v, want %v", err, ErrNoFeeEstimate)
+	}
+	for _, target := range []int{0, MaxConfirmTarget + 1} {
+		if _, err := e.EstimateFeeRate(target, DefaultFeeConfidence); err != ErrInvalidEstimate {
+			t.Errorf("target %d: got %v, want %v", target, err, ErrInvalidEstimate)
+		}
+	}
+	for _, confidence := range []float64{0, 1.5} {
+		if _, err := e.EstimateFeeRate(1, confidence); err != ErrInvalidEstimate {
+			t.Errorf("confidence %v: got %v, want %v", confidence, err, ErrInvalidEstimate)
+		}
+	}
+
+	// at each block, a transaction paying 50 is mined in the next block,
+	// and one paying 5 four blocks later
+	id := func(i int) []byte { return []byte{byte(i), byte(i >> 8)} }
+	n := 0
+	for height := 10; height < 60; height++ {
+		e.AddTransaction(id(n), 50, height)
+		e.AddTransaction(id(n+1), 5, height)
+		mined := []*Transaction{{ID: id(n)}}
+		if n >= 8 {
+			mined = append(mined, &Transaction{ID: id(n - 7)})
+		}
+		e.ProcessBlock(height, mined)
+		n += 2
+	}
+	if feeRate, err := e.EstimateFeeRate(1, DefaultFeeConfidence); err != nil || feeRate != 50 {
+		t.Errorf("next block: got %d, %v, want 50", feeRate, err)
+	}
+	if feeRate, err := e.EstimateFeeRate(5, DefaultFeeConfidence); err != nil || feeRate != 5 {
+		t.Errorf("five blocks: got %d, %v, want 5", feeRate, err)
+	}
+	// a block processed twice is ignored
+	e.ProcessBlock(59, []*Transaction{{ID: id(n - 1)}})
+	if feeRate, err := e.EstimateFeeRate(5, DefaultFeeConfidence); err != nil || feeRate != 5 {
+		t.Errorf("five blocks after a processed block: got %d, %v, want 5", feeRate, err)
+	}
+}
+
+func TestEstimateFeeRateWaiting(t *testing.T) {
+	e := NewFeeEstimator()
+	// the transactions paying 5 are mined in the next block until the
+	// height 5, then stay in the mempool
+	id := func(i int) []byte { return []byte{byte(i), byte(i >> 8)} }
+	for height := 1; height <= 20; height++ {
+		e.AddTransaction(id(2*height), 50, height)
+		e.AddTransaction(id(2*height+1), 5, height)
+		mined := []*Transaction{{ID: id(2 * height)}}
+		if height <= 5 {
+			mined = append(mined, &Transaction{ID: id(2*height + 1)})
+		}
+		e.ProcessBlock(height, mined)
+	}
+	if feeRate, err := e.EstimateFeeRate(1, DefaultFeeConfidence); err != nil || feeRate != 50 {
+		t.Errorf("got %d, %v, want 50", feeRate, err)
+	}
+	// once replaced, they do not count anymore
+	for height := 6; height <= 20; height++ {
+		e.RemoveTransaction(id(2*height + 1))
+	}
+	if feeRate, err := e.EstimateFeeRate(1, DefaultFeeConfidence); err != nil || feeRate != 5 {
+		t.Errorf("after removal: got %d, %v, want 5", feeRate, err)
+	}
+}
+
+func TestMempoolFeeEstimator(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	_, recipientPubKey := newKeyPair()
+	m, acc := newTestMempool(t, "alice", privKey)
+	acc.Funding.Estimator = m.FeeEstimator()
+	if _, err := acc.EstimateFeeRate(1, 0.5); err != ErrNoFeeEstimate {
+		t.Errorf("got %v, want %v", err, ErrNoFeeEstimate)
+	}
+	tx := sendTestPayment(t, m, acc, GetStringAddress(GetAddress(recipientPubKey)), 1, FundingOptions{FeeRate: 4})
+	block := mineTestBlock(t, acc.Blockchain, pubKey, tx)
+	m.Remove(block.Transactions)
+	if feeRate, err := acc.EstimateFeeRate(1, 0.5); err != nil || feeRate != 4 {
+		t.Errorf("got %d, %v, want 4", feeRate, err)
+	}
+	// the wallet funds its transactions at the estimate
+	diff(t, 4, acc.Funding.feeRate(), "funding fee rate")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// genesisPubKey is the public key the genesis coinbase pays to, the one of
+// the historical genesis block. Nobody is expected to spend its output.
+const genesisPubKey = "04678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5f"
+
+var ErrGenesisMismatch = errors.New("genesis block does not match the network parameters")
+
+// GenesisCoinbaseTX returns the coinbase of the genesis block of the
+// network, built from its parameters only
+func GenesisCoinbaseTX(params NetworkParams) *Transaction {
+	pubKey, _ := hex.DecodeString(genesisPubKey)
+	pubKeyHash := HashPubKey(pubKey)
+	input := TXInput{OutIdx: -1, PubKey: []byte(params.GenesisCoinbaseData)}
+	output := TXOutput{Value: params.BlockSubsidy(0), PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)}
+	tx := &Transaction{Vin: []TXInput{input}, Vout: []TXOutput{output}}
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// GenesisBlock returns the hard-coded genesis block of the network
+func GenesisBlock(params NetworkParams) *Block {
+	block := NewGenesisBlock(params.GenesisTimestamp, GenesisCoinbaseTX(params))
+	block.Nonce = params.GenesisNonce
+	block.Hash, _ = hex.DecodeString(params.GenesisHash)
+	return block
+}
+
+// VerifyGenesisBlock checks that the genesis block of the network has a
+// valid proof-of-work and the hash of its parameters
+func VerifyGenesisBlock(params NetworkParams) error {
+	if !newProofOfWork(GenesisBlock(params), params.TargetBits).Validate() {
+		return ErrGenesisMismatch
+	}
+	return nil
+}
+
+// MineGenesisBlock mines the genesis block of a new network with the
+// given coinbase data and timestamp. Its timestamp, nonce and hash are
+// the Genesis parameters of the network.
+func MineGenesisBlock(params NetworkParams) *Block {
+	block := NewGenesisBlock(params.GenesisTimestamp, GenesisCoinbaseTX(params))
+	block.Nonce, block.Hash = newProofOfWork(block, params.TargetBits).Run()
+	return block
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// The genesis blocks are pinned: their hash covers the serialization of
+// the coinbase transaction, so changing the fields of Transaction,
+// TXInput or TXOutput changes them. Mine new ones with -mine-genesis and
+// the timestamps below if it is intended.
+var genesisVectors = []struct {
+	params     NetworkParams
+	coinbaseID string
+	nonce      int
+	hash       string
+}{
+	{MainnetParams, "ffcf79192b01613aa5085c1e5a430fc6165f0c82588b2685aac935e21f3e0f1e", 389, "00e6f2ff8136855da76493ea36ce3ec7037dd9bd8381f62c126fba8fd22805dc"},
+	{TestnetParams, "b798e313d4adb15fe4aceb81fcac0383b761a5d11ea9b6f1c7bf8429f5147400", 1244, "005e488c88ad9822bc768fc7149481e7b8a70bbc5703494c6f8497c146219aeb"},
+	{RegtestParams, "bcba91fc164b92dafc9faf044ada24603c0bf0da6f48d61fc01ec67c725d4db3", 0, "90d916351ff1fd2c883fdb604f440c3ea05491f7bd72ac436114c81040646894"},
+}
+
+func TestGenesisBlocks(t *testing.T) {
+	for _, v := range genesisVectors {
+		params := v.params
+		if err := VerifyGenesisBlock(params); err != nil {
+			t.Errorf("%s: %v", params.Name, err)
+		}
+		genesis := GenesisBlock(params)
+		diff(t, v.coinbaseID, Bytes2Hex(genesis.Transactions[0].ID), params.Name+" coinbase ID")
+		diff(t, v.hash, params.GenesisHash, params.Name+" genesis hash")
+		diff(t, v.nonce, params.GenesisNonce, params.Name+" genesis nonce")
+		// the genesis block only depends on the parameters
+		mined := MineGenesisBlock(params)
+		diff(t, v.nonce, mined.Nonce, params.Name+" mined nonce")
+		diff(t, v.hash, hex.EncodeToString(mined.Hash), params.Name+" mined hash")
+	}
+}
+
+func TestVerifyGenesisBlockMismatch(t *testing.T) {
+	for _, v := range genesisVectors {
+		tests := map[string]func(*NetworkParams){
+			"nonce":         func(p *NetworkParams) { p.GenesisNonce++ },
+			"timestamp":     func(p *NetworkParams) { p.GenesisTimestamp++ },
+			"coinbase data": func(p *NetworkParams) { p.GenesisCoinbaseData += "." },
+			"hash":          func(p *NetworkParams) { p.GenesisHash = v.hash[:62] + "00" },
+		}
+		for name, change := range tests {
+			params := v.params
+			change(&params)
+			if err := VerifyGenesisBlock(params); err != ErrGenesisMismatch {
+				t.Errorf("%s with another %s: got %v, want %v", params.Name, name, err, ErrGenesisMismatch)
+			}
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HardenedKeyStart is the index of the first hardened child key
+	HardenedKeyStart = uint32(0x80000000)
+	// ExternalChain and InternalChain are the chains of receiving and
+	// change addresses of an account
+	ExternalChain = uint32(0)
+	InternalChain = uint32(1)
+	// DefaultGapLimit is the number of consecutive unused addresses after
+	// which the scan of a chain stops
+	DefaultGapLimit = 20
+
+	extendedKeySize = 4 + 1 + 4 + 4 + 32 + 33
+	minSeedSize     = 16
+)
+
+var (
+	ErrInvalidSeed        = errors.New("seed must be 16 to 64 bytes")
+	ErrInvalidExtendedKey = errors.New("invalid extended key")
+	ErrHardenedFromPublic = errors.New("cannot derive a hardened key from a public key")
+	ErrMaxDepth           = errors.New("cannot derive a key beyond depth 255")
+	ErrInvalidPath        = errors.New("invalid derivation path")
+	ErrWatchOnly          = errors.New("watch-only wallet has no private keys")
+)
+
+// ExtendedKey is a BIP32 extended key: a private or public key with the
+// chain code deriving its children
+type ExtendedKey struct {
+	Key               []byte // 32-byte private key or 33-byte compressed public key
+	ChainCode         []byte
+	Depth             byte
+	ParentFingerprint []byte // first 4 bytes of the hash of the parent public key
+	ChildNumber       uint32
+	Private           bool
+}
+
+// NewMasterKey derives the master key of the seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < minSeedSize || len(seed) > SeedSize {
+		return nil, ErrInvalidSeed
+	}
+	mac := hmac.New(sha512.New, keyParams.HDSeedKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	// SLIP-0010: retry with the HMAC of the previous result while the key is invalid
+	for !isValidScalar(sum[:32]) {
+		mac = hmac.New(sha512.New, keyParams.HDSeedKey)
+		mac.Write(sum)
+		sum = mac.Sum(nil)
+	}
+	return &ExtendedKey{
+		Key:               sum[:32],
+		ChainCode:         sum[32:],
+		ParentFingerprint: []byte{0, 0, 0, 0},
+		Private:           true,
+	}, nil
+}
+
+// isValidScalar checks whether the 32 bytes are a private key of the curve
+func isValidScalar(data []byte) bool {
+	k := new(big.Int).SetBytes(data)
+	return k.Sign() > 0 && k.Cmp(keyParams.Curve.Params().N) < 0
+}
+
+// PubKey returns the compressed public key
+func (k *ExtendedKey) PubKey() []byte {
+	if !k.Private {
+		return k.Key
+	}
+	x, y := keyParams.Curve.ScalarBaseMult(k.Key)
+	return marshalPubKey(keyParams.Curve, x, y, true)
+}
+
+// Fingerprint returns the first 4 bytes of the hash of the public key
+func (k *ExtendedKey) Fingerprint() []byte {
+	return HashPubKey(k.PubKey())[:4]
+}
+
+// Child derives the child key of the index, hardened from HardenedKeyStart.
+// Hardened keys can only be derived from private keys.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.Depth == 255 {
+		return nil, ErrMaxDepth
+	}
+	hardened := index >= HardenedKeyStart
+	if hardened && !k.Private {
+		return nil, ErrHardenedFromPublic
+	}
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(append(data, 0), k.Key...)
+	} else {
+		data = append(data, k.PubKey()...)
+	}
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+	child := &ExtendedKey{
+		Depth:             k.Depth + 1,
+		ParentFingerprint: k.Fingerprint(),
+		ChildNumber:       index,
+		Private:           k.Private,
+	}
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		child.ChainCode = sum[32:]
+		if key, ok := k.childKey(sum[:32]); ok {
+			child.Key = key
+			return child, nil
+		}
+		// SLIP-0010: retry with 0x01 || IR || index while the key is invalid
+		data = append(append([]byte{1}, sum[32:]...), data[len(data)-4:]...)
+	}
+}
+
+// childKey adds the tweak to the key, returning false if the result is invalid
+func (k *ExtendedKey) childKey(tweak []byte) ([]byte, bool) {
+	if !isValidScalar(tweak) {
+		return nil, false
+	}
+	curve := keyParams.Curve
+	if k.Private {
+		n := curve.Params().N
+		key := new(big.Int).SetBytes(tweak)
+		key.Add(key, new(big.Int).SetBytes(k.Key)).Mod(key, n)
+		if key.Sign() == 0 {
+			return nil, false
+		}
+		return key.FillBytes(make([]byte, 32)), true
+	}
+	x, y, err := unmarshalPubKey(curve, k.Key)
+	if err != nil {
+		return nil, false
+	}
+	tx, ty := curve.ScalarBaseMult(tweak)
+	x, y = curve.Add(x, y, tx, ty)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, false
+	}
+	return marshalPubKey(curve, x, y, true), true
+}
+
+// Neuter returns the extended public key of the key
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.Private {
+		return k
+	}
+	return &ExtendedKey{
+		Key:               k.PubKey(),
+		ChainCode:         k.ChainCode,
+		Depth:             k.Depth,
+		ParentFingerprint: k.ParentFingerprint,
+		ChildNumber:       k.ChildNumber,
+	}
+}
+
+// ParsePath returns the child indexes of a derivation path such as
+// m/44'/0'/0'/0/1, hardened indexes ending with ' or h. Paths not
+// starting with m are relative.
+func ParsePath(path string) ([]uint32, bool, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	absolute := parts[0] == "m"
+	if absolute {
+		parts = parts[1:]
+	}
+	indexes := []uint32{}
+	for _, part := range parts {
+		if part == "" && len(parts) == 1 {
+			break
+		}
+		offset := uint32(0)
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedKeyStart
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyStart {
+			return nil, false, ErrInvalidPath
+		}
+		indexes = append(indexes, uint32(index)+offset)
+	}
+	return indexes, absolute, nil
+}
+
+// Derive derives the key of the path, absolute paths only from a master key
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, absolute, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if absolute && k.Depth != 0 {
+		return nil, ErrInvalidPath
+	}
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// ECDSAPrivateKey returns the private key as an ecdsa key
+func (k *ExtendedKey) ECDSAPrivateKey() (ecdsa.PrivateKey, error) {
+	if !k.Private {
+		return ecdsa.PrivateKey{}, ErrWatchOnly
+	}
+	return privateKeyFromBytes(k.Key)
+}
+
+// PublicKeyBytes returns the public key in the format of the account keys
+func (k *ExtendedKey) PublicKeyBytes() []byte {
+	x, y, _ := unmarshalPubKey(keyParams.Curve, k.PubKey())
+	return pubKeyToByte(ecdsa.PublicKey{Curve: keyParams.Curve, X: x, Y: y})
+}
+
+// Address returns the pay to public key hash address of the key
+func (k *ExtendedKey) Address() string {
+	return string(GetAddress(k.PublicKeyBytes()))
+}
+
+// String returns the Base58Check serialization of the key (xprv or xpub)
+func (k *ExtendedKey) String() string {
+	data := make([]byte, 0, extendedKeySize+addressChecksumLen)
+	if k.Private {
+		data = append(data, netParams.HDPrivateKeyID[:]...)
+	} else {
+		data = append(data, netParams.HDPublicKeyID[:]...)
+	}
+	data = append(data, k.Depth)
+	data = append(data, k.ParentFingerprint...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], k.ChildNumber)
+	data = append(data, k.ChainCode...)
+	if k.Private {
+		data = append(data, 0)
+	}
+	data = append(data, k.Key...)
+	return string(Base58Encode(append(data, checksum(data)...)))
+}
+
+// ParseExtendedKey parses a serialized extended key
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	decoded, err := Base58Decode([]byte(s))
+	if err != nil || len(decoded) != extendedKeySize+addressChecksumLen {
+		return nil, ErrInvalidExtendedKey
+	}
+	data := decoded[:extendedKeySize]
+	if !bytes.Equal(checksum(data), decoded[extendedKeySize:]) {
+		return nil, ErrInvalidExtendedKey
+	}
+	k := &ExtendedKey{
+		Depth:             data[4],
+		ParentFingerprint: data[5:9],
+		ChildNumber:       binary.BigEndian.Uint32(data[9:13]),
+		ChainCode:         data[13:45],
+	}
+	switch {
+	case bytes.Equal(data[:4], netParams.HDPrivateKeyID[:]) && data[45] == 0 && isValidScalar(data[46:]):
+		k.Key, k.Private = data[46:], true
+	case bytes.Equal(data[:4], netParams.HDPublicKeyID[:]):
+		if _, _, err := unmarshalPubKey(keyParams.Curve, data[45:]); err != nil {
+			return nil, ErrInvalidExtendedKey
+		}
+		k.Key = data[45:]
+	default:
+		return nil, ErrInvalidExtendedKey
+	}
+	return k, nil
+}
+
+// HDWallet derives the keys of an account from a mnemonic seed (BIP32,
+// BIP39 and BIP44): receiving addresses on the external chain and change
+// addresses on the internal chain. Watch-only wallets only hold the
+// extended public key of the account.
+type HDWallet struct {
+	Mnemonic    string // empty for watch-only wallets
+	AccountPath string // derivation path of the account from the master key
+	GapLimit    int
+	account     *ExtendedKey
+	next        [2]uint32 // next unused index of the external and internal chains
+}
+
+// HDAddress is an address of the wallet found used in the blockchain
+type HDAddress struct {
+	Path    string
+	Address string
+	Balance int
+}
+
+// DefaultAccountPath returns the derivation path of the first account
+// of the network (BIP44), e.g. m/44'/0'/0'
+func DefaultAccountPath() string {
+	return fmt.Sprintf("m/44'/%d'/0'", netParams.HDCoinType)
+}
+
+// NewHDWallet creates a wallet from a new random mnemonic
+func NewHDWallet(passphrase string) (*HDWallet, error) {
+	entropy, err := NewEntropy(DefaultEntropyBits)
+	if err != nil {
+		return nil, err
+	}
+	mnemonic, err := NewMnemonic(entropy)
+	if err != nil {
+		return nil, err
+	}
+	return RestoreHDWallet(mnemonic, passphrase, DefaultAccountPath())
+}
+
+// RestoreHDWallet restores the wallet of the mnemonic and passphrase,
+// deriving the account keys along the path
+func RestoreHDWallet(mnemonic, passphrase, accountPath string) (*HDWallet, error) {
+	if !ValidateMnemonic(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	master, err := NewMasterKey(NewSeed(mnemonic, passphrase))
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(accountPath)
+	if err != nil {
+		return nil, err
+	}
+	return &HDWallet{Mnemonic: mnemonic, AccountPath: accountPath, GapLimit: DefaultGapLimit, account: account}, nil
+}
+
+// NewWatchOnlyHDWallet creates a wallet from the extended public key of an account
+func NewWatchOnlyHDWallet(xpub string) (*HDWallet, error) {
+	account, err := ParseExtendedKey(xpub)
+	if err != nil {
+		return nil, err
+	}
+	return &HDWallet{GapLimit: DefaultGapLimit, account: account.Neuter()}, nil
+}
+
+// IsWatchOnly checks whether the wallet has no private keys
+func (w *HDWallet) IsWatchOnly() bool {
+	return !w.account.Private
+}
+
+// AccountXPub returns the extended public key of the account, to create
+// watch-only wallets
+func (w *HDWallet) AccountXPub() string {
+	return w.account.Neuter().String()
+}
+
+// Key derives the key of the index on the chain (ExternalChain or InternalChain)
+func (w *HDWallet) Key(chain, index uint32) (*ExtendedKey, error) {
+	if chain != ExternalChain && chain != InternalChain {
+		return nil, ErrInvalidPath
+	}
+	key, err := w.account.Child(chain)
+	if err != nil {
+		return nil, err
+	}
+	return key.Child(index)
+}
+
+// Address returns the address of the index on the chain
+func (w *HDWallet) Address(chain, index uint32) (string, error) {
+	key, err := w.Key(chain, index)
+	if err != nil {
+		return "", err
+	}
+	return key.Address(), nil
+}
+
+// PrivateKey returns the private key of the index on the chain
+func (w *HDWallet) PrivateKey(chain, index uint32) (ecdsa.PrivateKey, error) {
+	if w.IsWatchOnly() {
+		return ecdsa.PrivateKey{}, ErrWatchOnly
+	}
+	key, err := w.Key(chain, index)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	return key.ECDSAPrivateKey()
+}
+
+// NextAddress returns the next unused address of the chain
+func (w *HDWallet) NextAddress(chain uint32) (string, error) {
+	if chain != ExternalChain && chain != InternalChain {
+		return "", ErrInvalidPath
+	}
+	address, err := w.Address(chain, w.next[chain])
+	if err != nil {
+		return "", err
+	}
+	w.next[chain]++
+	return address, nil
+}
+
+// PubKeyHashes returns the public key hashes of the addresses of both
+// chains given by the wallet, before the next unused ones
+func (w *HDWallet) PubKeyHashes() ([][]byte, error) {
+	pubKeyHashes := [][]byte{}
+	for _, chain := range []uint32{ExternalChain, InternalChain} {
+		for index := uint32(0); index < w.next[chain]; index++ {
+			key, err := w.Key(chain, index)
+			if err != nil {
+				return nil, err
+			}
+			pubKeyHashes = append(pubKeyHashes, HashPubKey(key.PublicKeyBytes()))
+		}
+	}
+	return pubKeyHashes, nil
+}
+
+// KeyPath returns the derivation path of the public key among the keys
+// of both chains given by the wallet, before the next unused ones
+func (w *HDWallet) KeyPath(pubKey []byte) (string, bool, error) {
+	for _, chain := range []uint32{ExternalChain, InternalChain} {
+		for index := uint32(0); index < w.next[chain]; index++ {
+			key, err := w.Key(chain, index)
+			if err != nil {
+				return "", false, err
+			}
+			if bytes.Equal(key.PublicKeyBytes(), pubKey) {
+				return w.path(chain, index), true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// path returns the derivation path of the index on the chain
+func (w *HDWallet) path(chain, index uint32) string {
+	if w.AccountPath == "" {
+		return fmt.Sprintf("%d/%d", chain, index)
+	}
+	return fmt.Sprintf("%s/%d/%d", w.AccountPath, chain, index)
+}
+
+// Scan finds the addresses of both chains used in the blockchain, each
+// chain being scanned until GapLimit consecutive addresses are unused,
+// and moves the next addresses after the last used ones
+func (w *HDWallet) Scan(bc *Blockchain) ([]HDAddress, error) {
+	used := bc.usedPubKeyHashes()
+	utxos := bc.FindUTXOSet()
+	found := []HDAddress{}
+	for _, chain := range []uint32{ExternalChain, InternalChain} {
+		for index, gap := uint32(0), 0; gap < w.GapLimit; index++ {
+			key, err := w.Key(chain, index)
+			if err != nil {
+				return nil, err
+			}
+			pubKeyHash := HashPubKey(key.PublicKeyBytes())
+			if !used[Bytes2Hex(pubKeyHash)] {
+				gap++
+				continue
+			}
+			gap = 0
+			balance := 0
+			for _, out := range utxos.FindUTXO(pubKeyHash) {
+				balance += out.Value
+			}
+			found = append(found, HDAddress{Path: w.path(chain, index), Address: key.Address(), Balance: balance})
+			if index >= w.next[chain] {
+				w.next[chain] = index + 1
+			}
+		}
+	}
+	return found, nil
+}
+
+// usedPubKeyHashes returns the hex public key hashes paid by the outputs of the blockchain
+func (bc *Blockchain) usedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+	for _, block := range bc.blocks {
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				if pubKeyHash := out.LockingScript().PubKeyHash(); pubKeyHash != nil {
+					used[Bytes2Hex(pubKeyHash)] = true
+				}
+			}
+		}
+	}
+	return used
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SecretSize is the size of the secrets of hash time-locked contracts
+const SecretSize = 32
+
+var (
+	ErrInvalidHTLC      = errors.New("invalid hash time-locked contract")
+	ErrContractNotFound = errors.New("contract output not found in transaction")
+	ErrInvalidSecret    = errors.New("secret does not match the secret hash")
+	ErrSecretNotFound   = errors.New("secret not found in transaction")
+)
+
+// HTLC is a hash time-locked contract: the output can be spent by the
+// recipient revealing the secret of the secret hash, or by the refund key
+// once the lock time is reached. Both chains of an atomic swap lock their
+// coins with the same secret hash.
+type HTLC struct {
+	SecretHash          []byte // sha256 of the secret
+	RecipientPubKeyHash []byte // key redeeming the output with the secret
+	RefundPubKeyHash    []byte // key getting the output back after the lock time
+	LockTime            uint32 // block height or unix time of the refund
+}
+
+// NewSecret returns a random secret and its hash
+func NewSecret() ([]byte, []byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.Sum256(secret)
+	return secret, hash[:], nil
+}
+
+// Script returns the redeem script of the contract:
+//
+//	OP_IF
+//	    OP_SIZE <32> OP_EQUALVERIFY OP_SHA256 <secretHash> OP_EQUALVERIFY
+//	    OP_DUP OP_HASH160 <recipientPubKeyHash>
+//	OP_ELSE
+//	    <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP
+//	    OP_DUP OP_HASH160 <refundPubKeyHash>
+//	OP_ENDIF
+//	OP_EQUALVERIFY OP_CHECKSIG
+func (c *HTLC) Script() Script {
+	return hashLockScript(c.SecretHash, c.RecipientPubKeyHash, OP_CHECKLOCKTIMEVERIFY, int64(c.LockTime), c.RefundPubKeyHash)
+}
+
+// hashLockScript returns a script paying to hashPubKeyHash with the secret
+// of the hash, or to timeoutPubKeyHash once the lock time of the lock time
+// opcode (OP_CHECKLOCKTIMEVERIFY or OP_CHECKSEQUENCEVERIFY) is reached
+func hashLockScript(secretHash, hashPubKeyHash []byte, lockTimeOp byte, lockTime int64, timeoutPubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddOp(OP_IF).
+		AddOp(OP_SIZE).AddInt(SecretSize).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_SHA256).AddData(secretHash).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(hashPubKeyHash).
+		AddOp(OP_ELSE).
+		AddInt(lockTime).AddOp(lockTimeOp).AddOp(OP_DROP).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(timeoutPubKeyHash).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// Address returns the pay to script hash address of the contract
+func (c *HTLC) Address() string {
+	return GetScriptAddress(c.Script())
+}
+
+// ParseHTLC returns the contract of a redeem script built by HTLC.Script
+func ParseHTLC(script Script) (*HTLC, error) {
+	ops, err := script.parse()
+	if err != nil || len(ops) != 20 {
+		return nil, ErrInvalidHTLC
+	}
+	c := &HTLC{
+		SecretHash:          ops[5].data,
+		RecipientPubKeyHash: ops[9].data,
+		RefundPubKeyHash:    ops[16].data,
+	}
+	if !ops[11].isPush() {
+		return nil, ErrInvalidHTLC
+	}
+	lockTime, err := scriptNumOfSize(pushValue(ops[11]), maxLockTimeNumSize)
+	if err != nil || lockTime < 0 {
+		return nil, ErrInvalidHTLC
+	}
+	c.LockTime = uint32(lockTime)
+	if len(c.SecretHash) != sha256.Size || len(c.RecipientPubKeyHash) != 20 || len(c.RefundPubKeyHash) != 20 {
+		return nil, ErrInvalidHTLC
+	}
+	// the script must be exactly the template
+	if !bytes.Equal(c.Script(), script) {
+		return nil, ErrInvalidHTLC
+	}
+	return c, nil
+}
+
+// contractOutput returns the index of the output paying to the hash of the redeem script
+func contractOutput(contractTx *Transaction, contract Script) (int, error) {
+	for idx, out := range contractTx.Vout {
+		if out.IsLockedWithScript(contract) {
+			return idx, nil
+		}
+	}
+	return 0, ErrContractNotFound
+}
+
+// newScriptSpend creates the unsigned transaction sending the output of
+// contractTx locked to the redeem script to the address
+func newScriptSpend(contract Script, contractTx *Transaction, to string) (*Transaction, *TXOutput, error) {
+	if _, err := ParseAddress(to); err != nil {
+		return nil, nil, err
+	}
+	outIdx, err := contractOutput(contractTx, contract)
+	if err != nil {
+		return nil, nil, err
+	}
+	prevOut := contractTx.Vout[outIdx]
+	tx := &Transaction{
+		Vin:  []TXInput{{Txid: contractTx.ID, OutIdx: outIdx, Sequence: SequenceFinal}},
+		Vout: []TXOutput{*NewTXOutput(prevOut.Value, to)},
+	}
+	tx.ID = tx.Hash()
+	return tx, &prevOut, nil
+}
+
+// signScriptSpend signs the single input of a transaction spending a
+// hash lock script output and sets its unlocking script:
+// <signature> <pubKey> <branch data...> <contract>
+func (tx *Transaction) signScriptSpend(privKey ecdsa.PrivateKey, prevOut *TXOutput, contract Script, branch ...[]byte) error {
+	digest, err := tx.SignatureHash(0, prevOut, SigHashAll)
+	if err != nil {
+		return err
+	}
+	signature, err := signDigest(privKey, digest)
+	if err != nil {
+		return err
+	}
+	signature = append(signature, byte(SigHashAll))
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	b := NewScriptBuilder().AddData(signature).AddData(pubKey)
+	for _, data := range branch {
+		b.AddData(data)
+	}
+	input := &tx.Vin[0]
+	input.Signature, input.PubKey = signature, pubKey
+	input.ScriptSig = b.AddData(contract).Script()
+	return tx.VerifyInput(0, prevOut)
+}
+
+// NewHTLCRedeemTransaction creates the transaction redeeming the contract
+// output of contractTx with the secret, signed by the recipient key
+func NewHTLCRedeemTransaction(contract Script, contractTx *Transaction, secret []byte, to string, privKey ecdsa.PrivateKey) (*Transaction, error) {
+	c, err := ParseHTLC(contract)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(secret)
+	if !bytes.Equal(hash[:], c.SecretHash) {
+		return nil, ErrInvalidSecret
+	}
+	tx, prevOut, err := newScriptSpend(contract, contractTx, to)
+	if err != nil {
+		return nil, err
+	}
+	// OP_1 selects the secret branch
+	if err := tx.signScriptSpend(privKey, prevOut, contract, secret, []byte{1}); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// NewHTLCRefundTransaction creates the transaction getting back the
+// contract output of contractTx, signed by the refund key. It can only
+// be mined once the lock time of the contract is reached.
+func NewHTLCRefundTransaction(contract Script, contractTx *Transaction, to string, privKey ecdsa.PrivateKey) (*Transaction, error) {
+	c, err := ParseHTLC(contract)
+	if err != nil {
+		return nil, err
+	}
+	tx, prevOut, err := newScriptSpend(contract, contractTx, to)
+	if err != nil {
+		return nil, err
+	}
+	tx.SetLockTime(c.LockTime)
+	// an empty push (false) selects the refund branch
+	if err := tx.signScriptSpend(privKey, prevOut, contract, []byte{}); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// ExtractSecret returns the secret revealed by a transaction redeeming
+// a contract with the given secret hash
+func ExtractSecret(redeemTx *Transaction, secretHash []byte) ([]byte, error) {
+	for _, input := range redeemTx.Vin {
+		pushed, err := input.ScriptSig.PushedData()
+		if err != nil {
+			continue
+		}
+		for _, data := range pushed {
+			hash := sha256.Sum256(data)
+			if len(data) == SecretSize && bytes.Equal(hash[:], secretHash) {
+				return data, nil
+			}
+		}
+	}
+	return nil, ErrSecretNotFound
+}
+
+// ContractAudit describes the contract of a counterparty, to be checked
+// before locking coins on the other chain
+type ContractAudit struct {
+	HTLC
+	Address          string // P2SH address of the contract
+	OutIdx           int    // contract output in the contract transaction
+	Value            int    // amount locked in the contract
+	RecipientAddress string
+	RefundAddress    string
+}
+
+// AuditContract checks that the contract transaction pays to the contract
+// and returns its terms
+func AuditContract(contract Script, contractTx *Transaction) (*ContractAudit, error) {
+	c, err := ParseHTLC(contract)
+	if err != nil {
+		return nil, err
+	}
+	outIdx, err := contractOutput(contractTx, contract)
+	if err != nil {
+		return nil, err
+	}
+	return &ContractAudit{
+		HTLC:             *c,
+		Address:          c.Address(),
+		OutIdx:           outIdx,
+		Value:            contractTx.Vout[outIdx].Value,
+		RecipientAddress: string(encodeAddress(netParams.PubKeyHashAddrID, c.RecipientPubKeyHash)),
+		RefundAddress:    string(encodeAddress(netParams.PubKeyHashAddrID, c.RefundPubKeyHash)),
+	}, nil
+}
+
+func (a ContractAudit) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("--- Contract %s :", a.Address))
+	lines = append(lines, fmt.Sprintf("     Value:       %d", a.Value))
+	lines = append(lines, fmt.Sprintf("     Recipient:   %s", a.RecipientAddress))
+	lines = append(lines, fmt.Sprintf("     Refund:      %s", a.RefundAddress))
+	lines = append(lines, fmt.Sprintf("     Secret hash: %x", a.SecretHash))
+	lines = append(lines, fmt.Sprintf("     Lock time:   %d", a.LockTime))
+	return strings.Join(lines, "\n")
+}
+
+// SwapContract is one side of an atomic swap: the contract and the
+// transaction funding it. Only the initiator knows the secret until
+// it is revealed by the redeem transaction of the participant.
+type SwapContract struct {
+	Contract   Script
+	ContractTx *Transaction
+	SecretHash []byte
+	Secret     []byte // set for the initiator only
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+)
+
+// newTestSwapChain returns a blockchain starting with the genesis block
+// of the network, whose block 1 pays the subsidy to the key
+func newTestSwapChain(t *testing.T, params NetworkParams, pubKey []byte) *Blockchain {
+	t.Helper()
+	bc := &Blockchain{}
+	bc.appendBlock(GenesisBlock(params))
+	mineTestBlock(t, bc, pubKey)
+	return bc
+}
+
+// newTestSwapAccount returns the account of the key on the blockchain
+func newTestSwapAccount(name string, privKey ecdsa.PrivateKey, bc *Blockchain) Account {
+	acc := newKeyAccount(name, privKey)
+	acc.Blockchain = bc
+	return acc
+}
+
+func TestAtomicSwap(t *testing.T) {
+	alicePrivKey, alicePubKey := newKeyPair()
+	bobPrivKey, bobPubKey := newKeyPair()
+	// alice has coins on the first chain, bob on the second one
+	chainA := newTestSwapChain(t, MainnetParams, alicePubKey)
+	chainB := newTestSwapChain(t, TestnetParams, bobPubKey)
+	if bytes.Equal(chainA.GetGenesisBlock().Hash, chainB.GetGenesisBlock().Hash) {
+		t.Fatal("the chains have the same genesis block")
+	}
+	aliceA := newTestSwapAccount("alice", alicePrivKey, chainA)
+	aliceB := newTestSwapAccount("alice", alicePrivKey, chainB)
+	bobA := newTestSwapAccount("bob", bobPrivKey, chainA)
+	bobB := newTestSwapAccount("bob", bobPrivKey, chainB)
+	const amount = 10
+
+	// alice locks coins on the first chain for bob, with the later lock time
+	initiated, err := aliceA.InitiateSwap(bobA.Address, amount, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, chainA, alicePubKey, initiated.ContractTx)
+
+	// bob audits the contract and locks coins on the second chain for alice
+	audit, err := bobA.AuditSwap(initiated.Contract, initiated.ContractTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audit.Value != amount || audit.LockTime != 100 || audit.RecipientAddress != bobA.Address {
+		t.Fatalf("unexpected contract terms:\n%v", audit)
+	}
+	participated, err := bobB.ParticipateSwap(aliceB.Address, audit.SecretHash, amount, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, chainB, bobPubKey, participated.ContractTx)
+	if _, err := bobA.AuditSwap(participated.Contract, participated.ContractTx); err == nil {
+		t.Error("contract of the second chain accepted on the first one")
+	}
+
+	// alice audits bob's contract and redeems it, revealing the secret
+	if _, err := aliceB.AuditSwap(participated.Contract, participated.ContractTx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aliceB.RedeemSwap(participated.Contract, participated.ContractTx, make([]byte, SecretSize)); err != ErrInvalidSecret {
+		t.Errorf("wrong secret: got %v, want %v", err, ErrInvalidSecret)
+	}
+	aliceRedeem, err := aliceB.RedeemSwap(participated.Contract, participated.ContractTx, initiated.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, chainB, bobPubKey, aliceRedeem)
+	if balance := aliceB.GetBalance(); balance != amount {
+		t.Errorf("alice balance on the second chain: got %d, want %d", balance, amount)
+	}
+
+	// bob learns the secret from alice's redeem transaction and redeems alice's contract
+	secret, err := ExtractSecret(aliceRedeem, audit.SecretHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobRedeem, err := bobA.RedeemSwap(initiated.Contract, initiated.ContractTx, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, chainA, alicePubKey, bobRedeem)
+	if balance := bobA.GetBalance(); balance != amount {
+		t.Errorf("bob balance on the first chain: got %d, want %d", balance, amount)
+	}
+}
+
+func TestAtomicSwapRefund(t *testing.T) {
+	alicePrivKey, alicePubKey := newKeyPair()
+	_, bobPubKey := newKeyPair()
+	bc := newTestSwapChain(t, MainnetParams, alicePubKey)
+	alice := newTestSwapAccount("alice", alicePrivKey, bc)
+	const lockTime = 4
+
+	swap, err := alice.InitiateSwap(GetStringAddress(GetAddress(bobPubKey)), 10, lockTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, alicePubKey, swap.ContractTx)
+	refund, err := alice.RefundSwap(swap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the refund is not final before the block following the lock time
+	for height := len(bc.blocks); height <= lockTime; height++ {
+		if err := bc.CheckTransactionLocks(refund, height); err != ErrNonFinalTx {
+			t.Errorf("height %d: got %v, want %v", height, err, ErrNonFinalTx)
+		}
+		mineTestBlock(t, bc, bobPubKey)
+	}
+	mineTestBlock(t, bc, bobPubKey, refund)
+}
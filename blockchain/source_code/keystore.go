@@ -0,0 +1,521 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	keystoreKeySize = 32 // AES-256
+	keystoreSaltLen = 16
+
+	// KDFScrypt and KDFArgon2id are the functions deriving the encryption
+	// key of a keystore from its passphrase
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+
+	// KeyTypePrivateKey entries hold a private key, KeyTypeMnemonic
+	// entries the mnemonic of an HD wallet
+	KeyTypePrivateKey = "private-key"
+	KeyTypeMnemonic   = "mnemonic"
+)
+
+var (
+	ErrKeystoreExists  = errors.New("keystore file already exists")
+	ErrKeystoreVersion = errors.New("unsupported keystore version")
+	ErrKeystoreLocked  = errors.New("keystore is locked")
+	ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+	ErrUnsupportedKDF  = errors.New("unsupported key derivation function")
+	ErrKeyExists       = errors.New("keystore already holds a key with this name")
+	ErrKeyNotFound     = errors.New("key not found in keystore")
+	ErrKeyType         = errors.New("keystore entry has another type")
+	ErrKeystoreAltered = errors.New("keystore entry was altered")
+)
+
+// KDFParams are the parameters deriving the encryption key of a keystore
+type KDFParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n,omitempty"`       // scrypt CPU/memory cost
+	R       int    `json:"r,omitempty"`       // scrypt block size
+	P       int    `json:"p,omitempty"`       // scrypt parallelism
+	Time    uint32 `json:"time,omitempty"`    // argon2id passes
+	Memory  uint32 `json:"memory,omitempty"`  // argon2id memory in KiB
+	Threads uint8  `json:"threads,omitempty"` // argon2id parallelism
+}
+
+// ScryptParams returns scrypt parameters with a new random salt
+func ScryptParams() (KDFParams, error) {
+	return newKDFParams(KDFParams{Name: KDFScrypt, N: 1 << 15, R: 8, P: 1})
+}
+
+// Argon2idParams returns argon2id parameters with a new random salt
+func Argon2idParams() (KDFParams, error) {
+	return newKDFParams(KDFParams{Name: KDFArgon2id, Time: 1, Memory: 64 * 1024, Threads: 4})
+}
+
+// newKDFParams returns the parameters with a new random salt
+func newKDFParams(params KDFParams) (KDFParams, error) {
+	params.Salt = make([]byte, keystoreSaltLen)
+	if _, err := rand.Read(params.Salt); err != nil {
+		return KDFParams{}, err
+	}
+	return params, nil
+}
+
+// deriveKey derives the encryption key of the passphrase
+func (p KDFParams) deriveKey(passphrase string) ([]byte, error) {
+	switch p.Name {
+	case KDFScrypt:
+		return scrypt.Key([]byte(passphrase), p.Salt, p.N, p.R, p.P, keystoreKeySize)
+	case KDFArgon2id:
+		if p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+			return nil, ErrUnsupportedKDF
+		}
+		return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, keystoreKeySize), nil
+	}
+	return nil, ErrUnsupportedKDF
+}
+
+// KeystoreEntry is a key of a keystore. Its metadata is stored in clear
+// and authenticated with the encrypted secret.
+type KeystoreEntry struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`    // KeyTypePrivateKey or KeyTypeMnemonic
+	Address    string    `json:"address"` // address of the key, or of the first key of the HD wallet
+	Created    time.Time `json:"created"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	Labels     *Labels   `json:"labels,omitempty"` // labels of the wallet of the key, not encrypted
+}
+
+// additionalData returns the metadata authenticated with the secret: the
+// JSON encoding of the entry without its nonce and ciphertext
+func (e *KeystoreEntry) additionalData() ([]byte, error) {
+	metadata := *e
+	metadata.Nonce, metadata.Ciphertext = nil, nil
+	return json.Marshal(metadata)
+}
+
+// seal encrypts the secret in the entry, authenticating its metadata
+func (e *KeystoreEntry) seal(key, secret []byte) error {
+	additionalData, err := e.additionalData()
+	if err != nil {
+		return err
+	}
+	e.Nonce, e.Ciphertext, err = sealSecret(key, secret, additionalData)
+	return err
+}
+
+// open decrypts the secret of the entry and checks its metadata
+func (e *KeystoreEntry) open(key []byte) ([]byte, error) {
+	additionalData, err := e.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := openSecret(key, e.Nonce, e.Ciphertext, additionalData)
+	if err == ErrWrongPassphrase {
+		// the key opened the passphrase check
+		return nil, ErrKeystoreAltered
+	}
+	return secret, err
+}
+
+// keystoreFile is the content of a keystore file
+type keystoreFile struct {
+	Version int       `json:"version"`
+	KDF     KDFParams `json:"kdf"`
+	// encryption of nothing, verifying the passphrase
+	CheckNonce []byte          `json:"check_nonce"`
+	Check      []byte          `json:"check"`
+	Entries    []KeystoreEntry `json:"entries"`
+}
+
+// Keystore is a file of keys encrypted with AES-GCM under a key derived
+// from a passphrase. It must be unlocked to add or read keys; the
+// derived key is then kept in memory until it is locked again.
+type Keystore struct {
+	mu        sync.Mutex
+	path      string
+	file      keystoreFile
+	key       []byte // derived encryption key, nil while locked
+	lockTimer *time.Timer
+	unlocks   int // number of unlocks, so that an expired timer only locks its own unlock
+}
+
+// CreateKeystore creates an empty keystore file encrypted with the
+// passphrase. The keystore is returned unlocked.
+func CreateKeystore(path string, passphrase string, kdf KDFParams) (*Keystore, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, ErrKeystoreExists
+	}
+	key, err := kdf.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	checkNonce, check, err := sealSecret(key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		path: path,
+		file: keystoreFile{Version: keystoreVersion, KDF: kdf, CheckNonce: checkNonce, Check: check, Entries: []KeystoreEntry{}},
+		key:  key,
+	}
+	if err := ks.save(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// OpenKeystore reads a keystore file. The keystore is returned locked.
+func OpenKeystore(path string) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{path: path}
+	if err := json.Unmarshal(data, &ks.file); err != nil {
+		return nil, err
+	}
+	if ks.file.Version != keystoreVersion {
+		return nil, ErrKeystoreVersion
+	}
+	return ks, nil
+}
+
+// sealSecret encrypts the plaintext with AES-GCM under a new random nonce
+func sealSecret(key, plaintext, additionalData []byte) ([]byte, []byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// openSecret decrypts the ciphertext sealed by sealSecret. Authentication failures
+// mean the key was derived from a wrong passphrase or the file was altered.
+func openSecret(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// save writes the keystore file, replacing the previous one atomically
+func (ks *Keystore) save() error {
+	data, err := json.MarshalIndent(ks.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := ks.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
+
+// Unlock derives the encryption key of the passphrase and keeps it until
+// Lock is called or, if timeout is positive, until the timeout expires
+func (ks *Keystore) Unlock(passphrase string, timeout time.Duration) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, err := ks.file.KDF.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := openSecret(key, ks.file.CheckNonce, ks.file.Check, nil); err != nil {
+		return err
+	}
+	ks.setKey(key)
+	if timeout > 0 {
+		unlock := ks.unlocks
+		ks.lockTimer = time.AfterFunc(timeout, func() {
+			ks.mu.Lock()
+			defer ks.mu.Unlock()
+			if ks.unlocks == unlock {
+				ks.setKey(nil)
+			}
+		})
+	}
+	return nil
+}
+
+// Lock forgets the encryption key
+func (ks *Keystore) Lock() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.setKey(nil)
+}
+
+// setKey replaces the encryption key, zeroing the previous one and
+// stopping its lock timer
+func (ks *Keystore) setKey(key []byte) {
+	if ks.lockTimer != nil {
+		ks.lockTimer.Stop()
+		ks.lockTimer = nil
+	}
+	for i := range ks.key {
+		ks.key[i] = 0
+	}
+	ks.key = key
+	ks.unlocks++
+}
+
+// IsLocked checks whether the keystore must be unlocked to access the keys
+func (ks *Keystore) IsLocked() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.key == nil
+}
+
+// Entries returns the metadata of the keys sorted by name, without their
+// secrets. It does not need the keystore to be unlocked, so the metadata
+// is only checked when reading the secrets or labels.
+func (ks *Keystore) Entries() []KeystoreEntry {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	entries := make([]KeystoreEntry, len(ks.file.Entries))
+	for i, entry := range ks.file.Entries {
+		entry.Nonce, entry.Ciphertext = nil, nil
+		entries[i] = entry
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// find returns the index of the entry of the name, or -1
+func (ks *Keystore) find(name string) int {
+	for i, entry := range ks.file.Entries {
+		if entry.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// add encrypts the secret in a new entry and saves the keystore
+func (ks *Keystore) add(name, keyType, address string, secret []byte) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.key == nil {
+		return ErrKeystoreLocked
+	}
+	if ks.find(name) >= 0 {
+		return ErrKeyExists
+	}
+	entry := KeystoreEntry{Name: name, Type: keyType, Address: address, Created: time.Now().UTC()}
+	if err := entry.seal(ks.key, secret); err != nil {
+		return err
+	}
+	ks.file.Entries = append(ks.file.Entries, entry)
+	if err := ks.save(); err != nil {
+		ks.file.Entries = ks.file.Entries[:len(ks.file.Entries)-1]
+		return err
+	}
+	return nil
+}
+
+// secret decrypts the secret of the entry of the name
+func (ks *Keystore) secret(name, keyType string) ([]byte, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.key == nil {
+		return nil, ErrKeystoreLocked
+	}
+	i := ks.find(name)
+	if i < 0 {
+		return nil, ErrKeyNotFound
+	}
+	entry := ks.file.Entries[i]
+	if entry.Type != keyType {
+		return nil, ErrKeyType
+	}
+	return entry.open(ks.key)
+}
+
+// AddKey stores the private key under the name
+func (ks *Keystore) AddKey(name string, privKey ecdsa.PrivateKey) error {
+	address := string(GetAddress(pubKeyToByte(privKey.PublicKey)))
+	return ks.add(name, KeyTypePrivateKey, address, privKey.D.FillBytes(make([]byte, 32)))
+}
+
+// AddMnemonic stores the mnemonic of an HD wallet under the name
+func (ks *Keystore) AddMnemonic(name string, mnemonic string) error {
+	wallet, err := RestoreHDWallet(mnemonic, "", DefaultAccountPath())
+	if err != nil {
+		return err
+	}
+	address, err := wallet.Address(ExternalChain, 0)
+	if err != nil {
+		return err
+	}
+	return ks.add(name, KeyTypeMnemonic, address, []byte(mnemonic))
+}
+
+// Key returns the private key stored under the name
+func (ks *Keystore) Key(name string) (ecdsa.PrivateKey, error) {
+	secret, err := ks.secret(name, KeyTypePrivateKey)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	return privateKeyFromBytes(secret)
+}
+
+// Mnemonic returns the mnemonic stored under the name
+func (ks *Keystore) Mnemonic(name string) (string, error) {
+	secret, err := ks.secret(name, KeyTypeMnemonic)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// SetLabels stores the labels of the wallet of the key of the name. The
+// secret of the key is sealed again to authenticate them.
+func (ks *Keystore) SetLabels(name string, labels *Labels) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.key == nil {
+		return ErrKeystoreLocked
+	}
+	i := ks.find(name)
+	if i < 0 {
+		return ErrKeyNotFound
+	}
+	previous := ks.file.Entries[i]
+	secret, err := previous.open(ks.key)
+	if err != nil {
+		return err
+	}
+	entry := previous
+	entry.Labels = labels
+	if err := entry.seal(ks.key, secret); err != nil {
+		return err
+	}
+	ks.file.Entries[i] = entry
+	if err := ks.save(); err != nil {
+		ks.file.Entries[i] = previous
+		return err
+	}
+	return nil
+}
+
+// Labels returns the labels of the wallet of the key of the name, checked
+// with the secret of the key
+func (ks *Keystore) Labels(name string) (*Labels, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.key == nil {
+		return nil, ErrKeystoreLocked
+	}
+	i := ks.find(name)
+	if i < 0 {
+		return nil, ErrKeyNotFound
+	}
+	entry := ks.file.Entries[i]
+	if _, err := entry.open(ks.key); err != nil {
+		return nil, err
+	}
+	if entry.Labels == nil {
+		return NewLabels(), nil
+	}
+	return entry.Labels, nil
+}
+
+// Remove deletes the key stored under the name
+func (ks *Keystore) Remove(name string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.key == nil {
+		return ErrKeystoreLocked
+	}
+	i := ks.find(name)
+	if i < 0 {
+		return ErrKeyNotFound
+	}
+	entries := ks.file.Entries
+	ks.file.Entries = append(append([]KeystoreEntry{}, entries[:i]...), entries[i+1:]...)
+	if err := ks.save(); err != nil {
+		ks.file.Entries = entries
+		return err
+	}
+	return nil
+}
+
+// ChangePassphrase re-encrypts all the keys under a key derived from the
+// new passphrase with a new salt. The keystore is left locked, to be
+// unlocked with the new passphrase.
+func (ks *Keystore) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	oldKey, err := ks.file.KDF.deriveKey(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := openSecret(oldKey, ks.file.CheckNonce, ks.file.Check, nil); err != nil {
+		return err
+	}
+	kdf, err := newKDFParams(ks.file.KDF)
+	if err != nil {
+		return err
+	}
+	newKey, err := kdf.deriveKey(newPassphrase)
+	if err != nil {
+		return err
+	}
+	file := keystoreFile{Version: keystoreVersion, KDF: kdf, Entries: make([]KeystoreEntry, len(ks.file.Entries))}
+	if file.CheckNonce, file.Check, err = sealSecret(newKey, nil, nil); err != nil {
+		return err
+	}
+	for i, entry := range ks.file.Entries {
+		secret, err := entry.open(oldKey)
+		if err != nil {
+			return err
+		}
+		if err := entry.seal(newKey, secret); err != nil {
+			return err
+		}
+		file.Entries[i] = entry
+	}
+	previous := ks.file
+	ks.file = file
+	if err := ks.save(); err != nil {
+		ks.file = previous
+		return err
+	}
+	ks.setKey(nil)
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestKeystore creates a keystore with cheap scrypt parameters
+func newTestKeystore(t *testing.T, passphrase string) (*Keystore, string) {
+	t.Helper()
+	kdf, err := newKDFParams(KDFParams{Name: KDFScrypt, N: 1 << 10, R: 8, P: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := CreateKeystore(path, passphrase, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks, path
+}
+
+func TestKeystore(t *testing.T) {
+	ks, path := newTestKeystore(t, "passphrase")
+	privKey, _ := newKeyPair()
+	if err := ks.AddKey("alice", privKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.AddKey("alice", privKey); err != ErrKeyExists {
+		t.Errorf("adding a key twice: got %v, want %v", err, ErrKeyExists)
+	}
+	wallet, err := NewHDWallet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.AddMnemonic("bob", wallet.Mnemonic); err != nil {
+		t.Fatal(err)
+	}
+	ks.Lock()
+	if _, err := ks.Key("alice"); err != ErrKeystoreLocked {
+		t.Errorf("reading a locked keystore: got %v, want %v", err, ErrKeystoreLocked)
+	}
+
+	ks, err = OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ks.IsLocked() {
+		t.Fatal("opened keystore is unlocked")
+	}
+	diff(t, 2, len(ks.Entries()), "entries of the locked keystore")
+	if err := ks.Unlock("wrong passphrase", 0); err != ErrWrongPassphrase {
+		t.Errorf("wrong passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := ks.Unlock("passphrase", 0); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.Key("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, privKey.D.Bytes(), key.D.Bytes(), "private key")
+	mnemonic, err := ks.Mnemonic("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, wallet.Mnemonic, mnemonic, "mnemonic")
+	if _, err := ks.Key("bob"); err != ErrKeyType {
+		t.Errorf("key of a mnemonic entry: got %v, want %v", err, ErrKeyType)
+	}
+	if _, err := ks.Key("carol"); err != ErrKeyNotFound {
+		t.Errorf("unknown key: got %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestKeystoreLabels(t *testing.T) {
+	ks, path := newTestKeystore(t, "passphrase")
+	privKey, pubKey := newKeyPair()
+	if err := ks.AddKey("alice", privKey); err != nil {
+		t.Fatal(err)
+	}
+	labels := NewLabels()
+	address := GetStringAddress(GetAddress(pubKey))
+	if err := labels.SetAddress(address, "savings"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SetLabels("alice", labels); err != nil {
+		t.Fatal(err)
+	}
+	ks.Lock()
+	if _, err := ks.Labels("alice"); err != ErrKeystoreLocked {
+		t.Errorf("labels of a locked keystore: got %v, want %v", err, ErrKeystoreLocked)
+	}
+	if err := ks.Unlock("passphrase", 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ks.Labels("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, "savings", got.Address(address), "label")
+
+	// relabel the address in the file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.Entries[0].Labels.Addresses[address] = "attacker"
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ks, err = OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock("passphrase", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Labels("alice"); err != ErrKeystoreAltered {
+		t.Errorf("altered labels: got %v, want %v", err, ErrKeystoreAltered)
+	}
+	if _, err := ks.Key("alice"); err != ErrKeystoreAltered {
+		t.Errorf("key of altered labels: got %v, want %v", err, ErrKeystoreAltered)
+	}
+}
+
+func TestKeystoreChangePassphrase(t *testing.T) {
+	ks, path := newTestKeystore(t, "old passphrase")
+	privKey, _ := newKeyPair()
+	if err := ks.AddKey("alice", privKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.ChangePassphrase("wrong passphrase", "new passphrase"); err != ErrWrongPassphrase {
+		t.Errorf("wrong old passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := ks.ChangePassphrase("old passphrase", "new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if !ks.IsLocked() {
+		t.Error("keystore unlocked after changing the passphrase")
+	}
+
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock("old passphrase", 0); err != ErrWrongPassphrase {
+		t.Errorf("old passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := ks.Unlock("new passphrase", 0); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.Key("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, privKey.D.Bytes(), key.D.Bytes(), "private key")
+}
+
+func TestKeystoreLockTimeout(t *testing.T) {
+	ks, _ := newTestKeystore(t, "passphrase")
+	ks.Lock()
+	if err := ks.Unlock("passphrase", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if ks.IsLocked() {
+		t.Fatal("keystore locked before the timeout")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !ks.IsLocked() {
+		if time.Now().After(deadline) {
+			t.Fatal("keystore still unlocked after the timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the timer of a previous unlock does not lock a later one
+	if err := ks.Unlock("passphrase", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	ks.Lock()
+	if err := ks.Unlock("passphrase", 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if ks.IsLocked() {
+		t.Error("keystore locked by the timer of a previous unlock")
+	}
+}
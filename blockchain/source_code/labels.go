@@ -0,0 +1,67 @@
+package main
+
+import "errors"
+
+var ErrLabelNotFound = errors.New("label not found")
+
+// Labels are the names given by the user to addresses, e.g. of their
+// contacts, and to transactions. They are stored with the keys of the
+// wallet in the keystore.
+type Labels struct {
+	Addresses    map[string]string `json:"addresses"`    // address -> label
+	Transactions map[string]string `json:"transactions"` // hex transaction ID -> label
+}
+
+// NewLabels returns an empty set of labels
+func NewLabels() *Labels {
+	return &Labels{Addresses: make(map[string]string), Transactions: make(map[string]string)}
+}
+
+// SetAddress labels a valid address of the network, an empty label
+// removing the label of the address
+func (l *Labels) SetAddress(address, label string) error {
+	if _, err := ParseAddress(address); err != nil {
+		return err
+	}
+	if label == "" {
+		delete(l.Addresses, address)
+	} else {
+		l.Addresses[address] = label
+	}
+	return nil
+}
+
+// Address returns the label of the address, or ""
+func (l *Labels) Address(address string) string {
+	return l.Addresses[address]
+}
+
+// FindAddress returns the address of the label, the smallest one if
+// several addresses have the label
+func (l *Labels) FindAddress(label string) (string, error) {
+	found := ""
+	for address, addressLabel := range l.Addresses {
+		if addressLabel == label && (found == "" || address < found) {
+			found = address
+		}
+	}
+	if found == "" {
+		return "", ErrLabelNotFound
+	}
+	return found, nil
+}
+
+// SetTransaction labels the transaction, an empty label removing the
+// label of the transaction
+func (l *Labels) SetTransaction(txID []byte, label string) {
+	if label == "" {
+		delete(l.Transactions, Bytes2Hex(txID))
+	} else {
+		l.Transactions[Bytes2Hex(txID)] = label
+	}
+}
+
+// Transaction returns the label of the transaction, or ""
+func (l *Labels) Transaction(txID []byte) string {
+	return l.Transactions[Bytes2Hex(txID)]
+}
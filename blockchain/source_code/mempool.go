@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrTxInMempool       = errors.New("transaction already in mempool")
+	ErrMempoolConflict   = errors.New("transaction spends an output already spent in mempool")
+	ErrInvalidMempoolTx  = errors.New("transaction is not valid")
+	ErrCoinbaseInMempool = errors.New("coinbase transaction not accepted in mempool")
+)
+
+// MaxBlockSize is the size of the transactions selected by the miners
+// from the mempool for a block, in bytes
+const MaxBlockSize = 1000000
+
+// Mempool holds the valid transactions waiting to be mined.
+// A transaction is only accepted if it is standard, and if it could be
+// mined in the next block: signatures, absolute lock time and relative
+// lock times of its inputs.
+// It may spend the outputs of the transactions of the mempool, and
+// replace the conflicting ones signaling replaceability.
+type Mempool struct {
+	mu        sync.Mutex
+	bc        *Blockchain
+	txs       map[string]*Transaction // hex ID -> transaction
+	fees      map[string]int          // hex ID -> fee of the transaction
+	order     []string                // hex IDs in arrival order, parents before children
+	spent     map[string]string       // spent outpoint "txid:outIdx" -> hex ID of the spending transaction
+	estimator *FeeEstimator           // learns from the transactions of the mempool getting mined
+	policy    Policy
+}
+
+// NewMempool creates an empty mempool for the given blockchain, with the
+// default policy
+func NewMempool(bc *Blockchain) *Mempool {
+	return &Mempool{
+		bc:        bc,
+		txs:       make(map[string]*Transaction),
+		fees:      make(map[string]int),
+		spent:     make(map[string]string),
+		estimator: NewFeeEstimator(),
+		policy:    DefaultPolicy,
+	}
+}
+
+// outpoint returns the key of the output spent by an input
+func outpoint(input TXInput) string {
+	return fmt.Sprintf("%x:%d", input.Txid, input.OutIdx)
+}
+
+// Add checks a transaction against the blockchain and the other
+// transactions of the mempool and adds it. The conflicting transactions
+// are replaced, with their descendants, if the replacement rules are met.
+func (m *Mempool) Add(tx *Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tx.IsCoinbase() {
+		return ErrCoinbaseInMempool
+	}
+	if err := m.policy.CheckTransaction(tx); err != nil {
+		return err
+	}
+	id := Bytes2Hex(tx.ID)
+	if _, ok := m.txs[id]; ok {
+		return ErrTxInMempool
+	}
+	conflicts := []string{}
+	for _, input := range tx.Vin {
+		if conflict, ok := m.spent[outpoint(input)]; ok && !containsString(conflicts, conflict) {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	evicted := m.descendants(conflicts)
+	pending := m.transactionsExcept(evicted)
+	if !m.bc.verifyTransaction(tx, nil, pending) {
+		return ErrInvalidMempoolTx
+	}
+	prevTXs, err := m.bc.inputTXsOf(tx, pending)
+	if err != nil {
+		return err
+	}
+	fee, err := tx.Fee(prevTXs)
+	if err != nil {
+		return err
+	}
+	// the transaction must be minable in the next block
+	if err := m.bc.CheckTransactionLocks(tx, len(m.bc.blocks)); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		if err := m.checkReplacement(tx, fee, conflicts, evicted); err != nil {
+			return err
+		}
+		for _, evictedID := range evicted {
+			m.remove(evictedID)
+		}
+	}
+	m.txs[id] = tx
+	m.fees[id] = fee
+	m.estimator.AddTransaction(tx.ID, tx.FeeRate(fee), len(m.bc.blocks))
+	m.order = append(m.order, id)
+	for _, input := range tx.Vin {
+		m.spent[outpoint(input)] = id
+	}
+	return nil
+}
+
+// Remove removes the transactions of the last block of the blockchain,
+// and the ones spending the same outputs with their descendants, from
+// the mempool. The fee estimator learns how long they took to be mined.
+func (m *Mempool) Remove(mined []*Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.estimator.ProcessBlock(len(m.bc.blocks)-1, mined)
+	for _, tx := range mined {
+		m.remove(Bytes2Hex(tx.ID))
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, input := range tx.Vin {
+			if id, ok := m.spent[outpoint(input)]; ok {
+				for _, conflict := range m.descendants([]string{id}) {
+					m.remove(conflict)
+				}
+			}
+		}
+	}
+}
+
+// descendants returns the hex IDs of the given transactions and of the
+// transactions of the mempool spending their outputs, recursively.
+// It must be called with the lock held.
+func (m *Mempool) descendants(ids []string) []string {
+	result := append([]string{}, ids...)
+	for i := 0; i < len(result); i++ {
+		for outIdx := range m.txs[result[i]].Vout {
+			child, ok := m.spent[fmt.Sprintf("%s:%d", result[i], outIdx)]
+			if ok && !containsString(result, child) {
+				result = append(result, child)
+			}
+		}
+	}
+	return result
+}
+
+// ancestors returns the hex IDs of the transactions of the mempool whose
+// outputs are spent by the given one, recursively, and the one itself.
+// It must be called with the lock held.
+func (m *Mempool) ancestors(id string) []string {
+	result := []string{id}
+	for i := 0; i < len(result); i++ {
+		for _, input := range m.txs[result[i]].Vin {
+			parent := Bytes2Hex(input.Txid)
+			if _, ok := m.txs[parent]; ok && !containsString(result, parent) {
+				result = append(result, parent)
+			}
+		}
+	}
+	return result
+}
+
+// transactionsExcept returns the transactions of the mempool in arrival
+// order, without the excluded ones.
+// It must be called with the lock held.
+func (m *Mempool) transactionsExcept(excluded []string) []*Transaction {
+	txs := []*Transaction{}
+	for _, id := range m.order {
+		if !containsString(excluded, id) {
+			txs = append(txs, m.txs[id])
+		}
+	}
+	return txs
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes a transaction by its hex ID.
+// It must be called with the lock held.
+func (m *Mempool) remove(id string) {
+	tx, ok := m.txs[id]
+	if !ok {
+		return
+	}
+	delete(m.txs, id)
+	delete(m.fees, id)
+	m.estimator.RemoveTransaction(tx.ID)
+	for _, input := range tx.Vin {
+		delete(m.spent, outpoint(input))
+	}
+	for i, orderID := range m.order {
+		if orderID == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Transactions returns the transactions of the mempool in arrival order
+func (m *Mempool) Transactions() []*Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transactionsExcept(nil)
+}
+
+// BlockTransactions selects the transactions of the mempool for a block of
+// at most maxSize bytes of transactions, and returns them with their total
+// fee. A transaction is selected with its unconfirmed ancestors, by the fee
+// rate of the package, so that a child paying for its parent (CPFP) gets
+// both mined. The parents come before their children.
+func (m *Mempool) BlockTransactions(maxSize int) ([]*Transaction, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	selected := make(map[string]bool)
+	skipped := make(map[string]bool)
+	txs := []*Transaction{}
+	size, fees := 0, 0
+	for {
+		var best []string
+		bestSize, bestFee := 0, 0
+		for _, id := range m.order {
+			if selected[id] || skipped[id] {
+				continue
+			}
+			pkg := []string{}
+			pkgSize, pkgFee := 0, 0
+			for _, ancestor := range m.ancestors(id) {
+				if !selected[ancestor] {
+					pkg = append(pkg, ancestor)
+					pkgSize += m.txs[ancestor].Size()
+					pkgFee += m.fees[ancestor]
+				}
+			}
+			// the highest package fee rate, the first arrived on a tie
+			if best == nil || pkgFee*bestSize > bestFee*pkgSize {
+				best, bestSize, bestFee = pkg, pkgSize, pkgFee
+			}
+		}
+		if best == nil {
+			break
+		}
+		if size+bestSize > maxSize {
+			skipped[best[0]] = true
+			continue
+		}
+		for _, id := range m.order {
+			if containsString(best, id) {
+				selected[id] = true
+				txs = append(txs, m.txs[id])
+			}
+		}
+		size += bestSize
+		fees += bestFee
+	}
+	return txs, fees
+}
+
+// Get returns a transaction of the mempool by its ID
+func (m *Mempool) Get(ID []byte) (*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx, ok := m.txs[Bytes2Hex(ID)]
+	if !ok {
+		return nil, ErrTxNotFound
+	}
+	return tx, nil
+}
+
+// SetPolicy sets the policy the new transactions must follow
+func (m *Mempool) SetPolicy(policy Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+}
+
+// FeeEstimator returns the fee estimator learning from the mempool
+func (m *Mempool) FeeEstimator() *FeeEstimator {
+	return m.estimator
+}
+
+// Fee returns the fee paid by a transaction of the mempool
+func (m *Mempool) Fee(ID []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fee, ok := m.fees[Bytes2Hex(ID)]
+	if !ok {
+		return 0, ErrTxNotFound
+	}
+	return fee, nil
+}
+
+// InputTXsOf returns the transactions used as inputs in the given
+// transaction, found in the mempool or in the blockchain
+func (m *Mempool) InputTXsOf(tx *Transaction) (map[string]*Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bc.inputTXsOf(tx, m.transactionsExcept(nil))
+}
+
+// ExcludeSpent removes from the UTXO set the outputs spent by the
+// transactions of the mempool, so that they are not spent twice
+func (m *Mempool) ExcludeSpent(u UTXOSet) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tx := range m.txs {
+		for _, input := range tx.Vin {
+			txID := Bytes2Hex(input.Txid)
+			delete(u[txID], input.OutIdx)
+			if len(u[txID]) == 0 {
+				delete(u, txID)
+			}
+		}
+	}
+}
+
+// Count returns the number of transactions in the mempool
+func (m *Mempool) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.order)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// MuSig2 key aggregation and two-round signing: the signers of an M-of-M
+// output share a single x-only public key, and the output is spent with a
+// single BIP340 signature, so that it looks and costs the same as an
+// output of a single key.
+// https://github.com/bitcoin/bips/blob/master/bip-0327.mediawiki
+
+const musigPubNonceSize = 66 // two compressed points
+
+var (
+	ErrMuSigKeys      = errors.New("invalid MuSig public keys")
+	ErrMuSigNonce     = errors.New("invalid MuSig nonce")
+	ErrMuSigNonceUsed = errors.New("MuSig nonce already used")
+	ErrMuSigSigner    = errors.New("key is not a signer of the MuSig aggregate key")
+	ErrMuSigSignature = errors.New("invalid MuSig signature")
+)
+
+// MuSigKeyAgg is the aggregate Q = Σ a_i*P_i of the x-only public keys of
+// the signers, a_i being a coefficient committing to all the keys
+type MuSigKeyAgg struct {
+	PubKeys      [][]byte // sorted x-only public keys
+	coefficients []*big.Int
+	x, y         *big.Int
+}
+
+// NewMuSigKeyAgg aggregates the x-only public keys of the signers
+func NewMuSigKeyAgg(pubKeys [][]byte) (*MuSigKeyAgg, error) {
+	if len(pubKeys) == 0 || !schnorrEnabled() {
+		return nil, ErrMuSigKeys
+	}
+	sorted := make([][]byte, len(pubKeys))
+	copy(sorted, pubKeys)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	listHash := taggedHash("KeyAgg list", sorted...)
+	k := &MuSigKeyAgg{PubKeys: sorted}
+	q := jacobianPoint{}
+	for _, pubKey := range sorted {
+		if len(pubKey) != SchnorrPubKeySize {
+			return nil, ErrMuSigKeys
+		}
+		px, py := liftX(new(big.Int).SetBytes(pubKey))
+		if px == nil {
+			return nil, ErrMuSigKeys
+		}
+		a := hashToScalar(taggedHash("KeyAgg coefficient", listHash, pubKey))
+		k.coefficients = append(k.coefficients, a)
+		q = secp256k1.add(q, secp256k1.toJacobian(secp256k1.ScalarMult(px, py, scalarBytes(a))))
+	}
+	if q.Z.IsZero() {
+		return nil, ErrMuSigKeys
+	}
+	k.x, k.y = secp256k1.toAffine(q)
+	return k, nil
+}
+
+// PubKey returns the x-only aggregate public key
+func (k *MuSigKeyAgg) PubKey() []byte {
+	return scalarBytes(k.x)
+}
+
+// Address returns the address of the aggregate public key
+func (k *MuSigKeyAgg) Address() string {
+	return string(GetAddress(k.PubKey()))
+}
+
+// coefficient returns the coefficient of a signer
+func (k *MuSigKeyAgg) coefficient(pubKey []byte) (*big.Int, error) {
+	for i, key := range k.PubKeys {
+		if bytes.Equal(key, pubKey) {
+			return k.coefficients[i], nil
+		}
+	}
+	return nil, ErrMuSigSigner
+}
+
+// MuSigNonce is the secret nonce pair of a signer for one signature.
+// It must be used once and is cleared by PartialSign.
+type MuSigNonce struct {
+	k1, k2 *big.Int
+	Public []byte // public nonce sent to the other signers
+}
+
+// NewMuSigNonce returns a fresh random nonce pair
+func NewMuSigNonce() (*MuSigNonce, error) {
+	nonce := &MuSigNonce{}
+	for _, k := range []**big.Int{&nonce.k1, &nonce.k2} {
+		d, err := rand.Int(rand.Reader, new(big.Int).Sub(secp256k1.N, big.NewInt(1)))
+		if err != nil {
+			return nil, err
+		}
+		*k = d.Add(d, big.NewInt(1))
+		x, y := secp256k1.ScalarBaseMult(scalarBytes(*k))
+		nonce.Public = append(nonce.Public, marshalPubKey(secp256k1, x, y, true)...)
+	}
+	return nonce, nil
+}
+
+// parseMuSigNonce returns the two points of a public nonce
+func parseMuSigNonce(pubNonce []byte) ([2]jacobianPoint, error) {
+	var points [2]jacobianPoint
+	if len(pubNonce) != musigPubNonceSize {
+		return points, ErrMuSigNonce
+	}
+	for i := range points {
+		x, y, err := unmarshalPubKey(secp256k1, pubNonce[33*i:33*(i+1)])
+		if err != nil {
+			return points, ErrMuSigNonce
+		}
+		points[i] = secp256k1.toJacobian(x, y)
+	}
+	return points, nil
+}
+
+// AggregateMuSigNonces sums the public nonces of all the signers
+func AggregateMuSigNonces(pubNonces [][]byte) ([]byte, error) {
+	infinity := jacobianPoint{}
+	sum := [2]jacobianPoint{infinity, infinity}
+	for _, pubNonce := range pubNonces {
+		points, err := parseMuSigNonce(pubNonce)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sum {
+			sum[i] = secp256k1.add(sum[i], points[i])
+		}
+	}
+	aggNonce := []byte{}
+	for _, point := range sum {
+		if point.Z.IsZero() {
+			return nil, ErrMuSigNonce
+		}
+		x, y := secp256k1.toAffine(point)
+		aggNonce = append(aggNonce, marshalPubKey(secp256k1, x, y, true)...)
+	}
+	return aggNonce, nil
+}
+
+// sessionValues returns the nonce coefficient b, the final nonce R = R1 + b*R2
+// and the challenge e of the signature of the message
+func (k *MuSigKeyAgg) sessionValues(aggNonce, msg []byte) (b, rx, ry, e *big.Int, err error) {
+	points, err := parseMuSigNonce(aggNonce)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	b = hashToScalar(taggedHash("MuSig/noncecoef", aggNonce, k.PubKey(), msg))
+	r2x, r2y := secp256k1.toAffine(points[1])
+	r := secp256k1.add(points[0], secp256k1.toJacobian(secp256k1.ScalarMult(r2x, r2y, scalarBytes(b))))
+	if r.Z.IsZero() {
+		rx, ry = secp256k1.Gx, secp256k1.Gy
+	} else {
+		rx, ry = secp256k1.toAffine(r)
+	}
+	e = hashToScalar(taggedHash("BIP0340/challenge", scalarBytes(rx), k.PubKey(), msg))
+	return b, rx, ry, e, nil
+}
+
+// PartialSign returns the partial signature s_i = k1 + b*k2 + e*a_i*d_i of
+// a signer, the nonces and the key being negated to give an even y to R and Q
+func (k *MuSigKeyAgg) PartialSign(privKey ecdsa.PrivateKey, nonce *MuSigNonce, aggNonce, msg []byte) ([]byte, error) {
+	if nonce.k1 == nil {
+		return nil, ErrMuSigNonceUsed
+	}
+	if privKey.Curve != S256() {
+		return nil, ErrSchnorrCurve
+	}
+	a, err := k.coefficient(SchnorrPubKey(privKey.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	b, _, ry, e, err := k.sessionValues(aggNonce, msg)
+	if err != nil {
+		return nil, err
+	}
+	n := secp256k1.N
+	k1, k2 := nonce.k1, nonce.k2
+	nonce.k1, nonce.k2 = nil, nil
+	if ry.Bit(0) == 1 {
+		k1, k2 = new(big.Int).Sub(n, k1), new(big.Int).Sub(n, k2)
+	}
+	d := evenKey(privKey)
+	if k.y.Bit(0) == 1 {
+		d.Sub(n, d)
+	}
+	s := new(big.Int).Mul(e, a)
+	s.Mul(s, d).Add(s, k1).Add(s, k2.Mul(k2, b)).Mod(s, n)
+	return scalarBytes(s), nil
+}
+
+// AggregateSignatures sums the partial signatures of all the signers into
+// the BIP340 signature of the aggregate key
+func (k *MuSigKeyAgg) AggregateSignatures(aggNonce, msg []byte, partials [][]byte) ([]byte, error) {
+	_, rx, _, _, err := k.sessionValues(aggNonce, msg)
+	if err != nil {
+		return nil, err
+	}
+	s := new(big.Int)
+	for _, partial := range partials {
+		si := new(big.Int).SetBytes(partial)
+		if len(partial) != 32 || si.Cmp(secp256k1.N) >= 0 {
+			return nil, ErrMuSigSignature
+		}
+		s.Add(s, si)
+	}
+	signature := append(scalarBytes(rx), scalarBytes(s.Mod(s, secp256k1.N))...)
+	if !SchnorrVerify(k.PubKey(), msg, signature) {
+		return nil, ErrMuSigSignature
+	}
+	return signature, nil
+}
+
+// SchnorrDigests returns the SigHashAll digests of the inputs of a
+// transaction spending outputs locked to the x-only public key, to be
+// signed with SignSchnorrInput, e.g. by the MuSig signers
+func (tx *Transaction) SchnorrDigests(prevTXs map[string]*Transaction) ([][]byte, error) {
+	digests := [][]byte{}
+	for idx, input := range tx.Vin {
+		output, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(input.PubKey) != SchnorrPubKeySize || !output.IsLockedWithKey(HashPubKey(input.PubKey)) {
+			return nil, ErrTxInputNotFound
+		}
+		digest, err := tx.SignatureHash(idx, output, SigHashAll)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+// SignSchnorrInput sets the unlocking script of the input idx with the
+// Schnorr signature of its SigHashAll digest
+func (tx *Transaction) SignSchnorrInput(idx int, signature []byte) error {
+	if idx < 0 || idx >= len(tx.Vin) || len(signature) != SchnorrSignatureSize {
+		return ErrInvalidSignature
+	}
+	input := &tx.Vin[idx]
+	input.Signature = append(append([]byte{}, signature...), byte(SigHashAll))
+	input.ScriptSig = P2PKHUnlockingScript(input.Signature, input.PubKey)
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrInvalidNFT    = errors.New("invalid non-fungible token")
+	ErrNFTNotFound   = errors.New("non-fungible token not found")
+	ErrNFTNotOwned   = errors.New("non-fungible token is not owned by this key")
+	ErrUnbalancedNFT = errors.New("non-fungible tokens of the inputs and outputs do not match")
+)
+
+// NFT is a non-fungible token carried by a single output. It is minted
+// once by the issuer, owner of the first input of the minting transaction,
+// then transferred whole from output to output: it can never be split or
+// merged with another asset. Sending it to a data carrier output burns it.
+type NFT struct {
+	ID           []byte // sha256 of the issuer, of the first outpoint spent by the mint and of the output index
+	Issuer       []byte // public key hash of the issuer
+	MetadataHash []byte // sha256 of the metadata of the asset
+}
+
+// nftID returns the ID of the asset minted in the output outIdx of a
+// transaction whose first input is given
+func nftID(issuer []byte, firstInput TXInput, outIdx int) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(firstInput.OutIdx))
+	binary.BigEndian.PutUint32(data[4:], uint32(outIdx))
+	h := sha256.New()
+	h.Write(issuer)
+	h.Write(firstInput.Txid)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Equals checks whether the two assets are the same
+func (n *NFT) Equals(other *NFT) bool {
+	return other != nil && bytes.Equal(n.ID, other.ID) && bytes.Equal(n.Issuer, other.Issuer) &&
+		bytes.Equal(n.MetadataHash, other.MetadataHash)
+}
+
+// CheckNFTs checks the non-fungible token rules of a transaction: each
+// asset of the inputs is found in exactly one output, and the new assets
+// are minted by the owner of the first input with their expected ID
+func (tx *Transaction) CheckNFTs(prevTXs map[string]*Transaction) error {
+	inputs := make(map[string]*NFT)
+	if !tx.IsCoinbase() {
+		for _, input := range tx.Vin {
+			prevOut, err := prevOutput(prevTXs, input)
+			if err != nil {
+				return err
+			}
+			if prevOut.NFT != nil {
+				inputs[Bytes2Hex(prevOut.NFT.ID)] = prevOut.NFT
+			}
+		}
+	}
+	found := make(map[string]bool)
+	for outIdx, out := range tx.Vout {
+		if out.NFT == nil {
+			continue
+		}
+		nft := out.NFT
+		id := Bytes2Hex(nft.ID)
+		if out.HasToken() || found[id] || len(nft.MetadataHash) != sha256.Size {
+			return ErrInvalidNFT
+		}
+		found[id] = true
+		if spent, ok := inputs[id]; ok {
+			if !nft.Equals(spent) {
+				return ErrUnbalancedNFT
+			}
+			continue
+		}
+		// minted: only by the owner of the first input
+		if tx.IsCoinbase() {
+			return ErrInvalidNFT
+		}
+		firstOut, _ := prevOutput(prevTXs, tx.Vin[0])
+		issuer := firstOut.LockingScript().PubKeyHash()
+		if issuer == nil || !bytes.Equal(nft.Issuer, issuer) || !bytes.Equal(nft.ID, nftID(issuer, tx.Vin[0], outIdx)) {
+			return ErrInvalidNFT
+		}
+	}
+	for id := range inputs {
+		if !found[id] {
+			return ErrUnbalancedNFT
+		}
+	}
+	return nil
+}
+
+// NewNFTMintTransaction creates a transaction minting an asset with the
+// metadata hash, owned by the issuer. The fee is paid by the coins of the
+// issuer chosen by the funding options, the excess being sent back as change.
+// NOTE: The returned tx is NOT signed!
+func NewNFTMintTransaction(pubKey []byte, metadataHash []byte, utxos UTXOSet, opts FundingOptions) (*Transaction, *NFT, error) {
+	if len(metadataHash) != sha256.Size {
+		return nil, nil, ErrInvalidNFT
+	}
+	pubKeyHash := HashPubKey(pubKey)
+	// the asset output carries no coins
+	selection, err := opts.selectCoins(pubKeyHash, 0, 1, utxos)
+	if err != nil {
+		return nil, nil, err
+	}
+	vin := selection.inputs(pubKey, opts.sequence())
+	nft := &NFT{ID: nftID(pubKeyHash, vin[0], 0), Issuer: pubKeyHash, MetadataHash: metadataHash}
+	asset := NewTXOutput(0, string(GetAddress(pubKey)))
+	asset.NFT = nft
+	vout := []TXOutput{*asset}
+	if selection.Change > 0 {
+		vout = append(vout, TXOutput{Value: selection.Change, PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)})
+	}
+	tx := &Transaction{Vin: vin, Vout: vout}
+	tx.ID = tx.Hash()
+	return tx, nft, nil
+}
+
+// NewNFTTransferTransaction creates a transaction sending the asset to the address
+// NOTE: The returned tx is NOT signed!
+func NewNFTTransferTransaction(pubKey []byte, assetID []byte, to string, utxos UTXOSet) (*Transaction, error) {
+	if _, err := ParseAddress(to); err != nil {
+		return nil, err
+	}
+	txID, outIdx, out, err := utxos.FindNFT(assetID)
+	if err != nil {
+		return nil, err
+	}
+	if !out.IsLockedWithKey(HashPubKey(pubKey)) {
+		return nil, ErrNFTNotOwned
+	}
+	asset := NewTXOutput(out.Value, to)
+	asset.NFT = out.NFT
+	tx := &Transaction{
+		Vin:  []TXInput{{Txid: Hex2Bytes(txID), OutIdx: outIdx, PubKey: pubKey, Sequence: SequenceFinal}},
+		Vout: []TXOutput{*asset},
+	}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
+
+// FindNFT finds the unspent output carrying the asset
+func (u UTXOSet) FindNFT(assetID []byte) (string, int, *TXOutput, error) {
+	for txID, outputs := range u {
+		for outIdx, out := range outputs {
+			if out.NFT != nil && bytes.Equal(out.NFT.ID, assetID) {
+				return txID, outIdx, &out, nil
+			}
+		}
+	}
+	return "", 0, nil, ErrNFTNotFound
+}
+
+// NFTEntry locates the current output carrying an asset
+type NFTEntry struct {
+	NFT
+	TxID   []byte // transaction of the output carrying the asset
+	OutIdx int
+	Owner  []byte // public key hash or script hash of the owner, nil once burned
+	Height int    // height of the block of the last transfer
+}
+
+// NFTIndex indexes the assets of a blockchain by ID, pointing to the
+// outpoint currently carrying them
+type NFTIndex struct {
+	entries map[string]*NFTEntry // hex asset ID -> current outpoint
+	height  int                  // number of indexed blocks
+}
+
+// NewNFTIndex creates the index of the assets of the blockchain
+func NewNFTIndex(bc *Blockchain) *NFTIndex {
+	idx := &NFTIndex{}
+	idx.Update(bc)
+	return idx
+}
+
+// Update indexes the blocks added to the blockchain since the last update
+func (idx *NFTIndex) Update(bc *Blockchain) {
+	if idx.entries == nil {
+		idx.entries = make(map[string]*NFTEntry)
+	}
+	for ; idx.height < len(bc.blocks); idx.height++ {
+		for _, tx := range bc.blocks[idx.height].Transactions {
+			for outIdx, out := range tx.Vout {
+				if out.NFT == nil {
+					continue
+				}
+				entry := &NFTEntry{NFT: *out.NFT, TxID: tx.ID, OutIdx: outIdx, Height: idx.height}
+				if !out.IsDataCarrier() {
+					entry.Owner = out.LockingScript().PubKeyHash()
+					if entry.Owner == nil {
+						entry.Owner = out.LockingScript().ScriptHash()
+					}
+				}
+				idx.entries[Bytes2Hex(out.NFT.ID)] = entry
+			}
+		}
+	}
+}
+
+// Find returns the current outpoint of the asset
+func (idx *NFTIndex) Find(assetID []byte) (*NFTEntry, error) {
+	entry, ok := idx.entries[Bytes2Hex(assetID)]
+	if !ok {
+		return nil, ErrNFTNotFound
+	}
+	return entry, nil
+}
+
+// Owned returns the assets owned by the public key hash, sorted by ID
+func (idx *NFTIndex) Owned(pubKeyHash []byte) []NFTEntry {
+	owned := []NFTEntry{}
+	for _, entry := range idx.entries {
+		if bytes.Equal(entry.Owner, pubKeyHash) {
+			owned = append(owned, *entry)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return bytes.Compare(owned[i].ID, owned[j].ID) < 0 })
+	return owned
+}
+
+func (e NFTEntry) String() string {
+	return fmt.Sprintf("NFT %x (metadata %x, issuer %x) at %x:%d", e.ID, e.MetadataHash, e.Issuer, e.TxID, e.OutIdx)
+}
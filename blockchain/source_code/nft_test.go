@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestNFTMintPaysFee(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	mineTestBlock(t, bc, pubKey)
+	metadataHash := make([]byte, 32)
+	const feeRate = 10
+
+	tx, nft, err := NewNFTMintTransaction(pubKey, metadataHash, bc.FindUTXOSet(), FundingOptions{FeeRate: feeRate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a single coin of the two pays the fee
+	if len(tx.Vin) != 1 || len(tx.Vout) != 2 {
+		t.Fatalf("got %d inputs and %d outputs, want 1 and 2", len(tx.Vin), len(tx.Vout))
+	}
+	if !tx.Vout[0].NFT.Equals(nft) || !tx.Vout[1].IsLockedWithKey(HashPubKey(pubKey)) {
+		t.Fatal("unexpected outputs")
+	}
+	if err := bc.SignTransaction(tx, privKey); err != nil {
+		t.Fatal(err)
+	}
+	prevTXs, err := bc.GetInputTXsOf(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee, err := tx.Fee(prevTXs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee < TxFee(tx.Size(), feeRate) || fee+tx.Vout[1].Value != coinbaseTX.Vout[0].Value {
+		t.Errorf("fee %d and change %d of a coin of %d", fee, tx.Vout[1].Value, coinbaseTX.Vout[0].Value)
+	}
+	mineTestBlock(t, bc, pubKey, tx)
+	entry, err := NewNFTIndex(bc).Find(nft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, Bytes2Hex(HashPubKey(pubKey)), Bytes2Hex(entry.Owner), "owner")
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// partialTxMagic prefixes the serialized partial transactions
+var partialTxMagic = []byte("ptx\xff")
+
+var (
+	ErrInvalidPartialTx  = errors.New("invalid partial transaction")
+	ErrPartialTxMismatch = errors.New("partial transactions are not for the same transaction")
+	ErrNotFinalized      = errors.New("partial transaction is not finalized")
+	ErrPartialTxSigHash  = errors.New("partial transaction input has another sighash type than expected")
+)
+
+// KeyHint tells a signer which of its keys signs an input
+type KeyHint struct {
+	PubKey []byte // public key expected to sign
+	Path   string // derivation path of the key in the signer wallet, if known
+}
+
+// PartialInput carries what is needed to sign an input without the blockchain
+type PartialInput struct {
+	PrevOut        TXOutput          // output spent by the input
+	RedeemScript   Script            // redeem script of an input spending a P2SH output
+	Hints          []KeyHint         // keys expected to sign the input
+	SigHashType    SigHashType       // sighash type used by the signers
+	Signatures     map[string][]byte // hex public key -> signature, sighash type included
+	FinalScriptSig Script            // unlocking script, set when finalized
+}
+
+// PartialTransaction is a portable unsigned or partially signed transaction,
+// built by a watch-only wallet and signed by the (offline) key holders.
+// Workflow: create, sign by each key holder, combine, finalize, extract.
+type PartialTransaction struct {
+	Tx     Transaction // the transaction without unlocking data
+	Inputs []PartialInput
+}
+
+// NewPartialTransaction creates a partial transaction from an unsigned
+// transaction and the previous transactions of its inputs
+func NewPartialTransaction(tx *Transaction, prevTXs map[string]*Transaction) (*PartialTransaction, error) {
+	if tx.IsCoinbase() {
+		return nil, ErrInvalidPartialTx
+	}
+	p := &PartialTransaction{Tx: tx.TrimmedCopy()}
+	for _, input := range tx.Vin {
+		prevOut, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return nil, err
+		}
+		partialInput := PartialInput{
+			PrevOut:     *prevOut,
+			SigHashType: SigHashAll,
+			Signatures:  make(map[string][]byte),
+		}
+		if prevOut.LockingScript().IsP2SH() {
+			// the redeem script is the last push of the unsigned input
+			pushed, err := input.ScriptSig.PushedData()
+			if err != nil || len(pushed) == 0 {
+				return nil, ErrInvalidMultisig
+			}
+			partialInput.RedeemScript = Script(pushed[len(pushed)-1])
+			_, pubKeys, _ := partialInput.RedeemScript.ParseMultisig()
+			for _, pubKey := range pubKeys {
+				partialInput.Hints = append(partialInput.Hints, KeyHint{PubKey: pubKey})
+			}
+		} else if len(input.PubKey) != 0 {
+			partialInput.Hints = append(partialInput.Hints, KeyHint{PubKey: input.PubKey})
+		}
+		p.Inputs = append(p.Inputs, partialInput)
+	}
+	return p, nil
+}
+
+// AddKeyPaths fills the derivation paths of the hinted keys found in
+// the wallet, so that the signers know which of their keys to use
+func (p *PartialTransaction) AddKeyPaths(w *HDWallet) error {
+	for idx := range p.Inputs {
+		for h := range p.Inputs[idx].Hints {
+			hint := &p.Inputs[idx].Hints[h]
+			path, ok, err := w.KeyPath(hint.PubKey)
+			if err != nil {
+				return err
+			}
+			if ok {
+				hint.Path = path
+			}
+		}
+	}
+	return nil
+}
+
+// Sign adds the signatures of the key to the inputs it can unlock and
+// returns the number of signed inputs. Only the data of the partial
+// transaction is used, so that it can be signed offline. As the sighash
+// type of the inputs comes with the untrusted partial transaction, the
+// inputs are only signed with the expected hash type.
+func (p *PartialTransaction) Sign(privKey ecdsa.PrivateKey, hashType SigHashType) (int, error) {
+	if !hashType.IsValid() {
+		return 0, ErrInvalidSigHashType
+	}
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	signed := 0
+	for idx := range p.Inputs {
+		in := &p.Inputs[idx]
+		if !in.canSign(pubKey) {
+			continue
+		}
+		if in.SigHashType != hashType {
+			return signed, ErrPartialTxSigHash
+		}
+		digest, err := p.Tx.SignatureHash(idx, &in.PrevOut, in.SigHashType)
+		if err != nil {
+			return signed, err
+		}
+		signature, err := signDigest(privKey, digest)
+		if err != nil {
+			return signed, err
+		}
+		in.Signatures[Bytes2Hex(pubKey)] = append(signature, byte(in.SigHashType))
+		signed++
+	}
+	if signed == 0 {
+		return 0, ErrNothingToSign
+	}
+	return signed, nil
+}
+
+// canSign checks whether the public key can unlock the input
+func (in *PartialInput) canSign(pubKey []byte) bool {
+	lockingScript := in.PrevOut.LockingScript()
+	if lockingScript.PubKeyHash() != nil {
+		return bytes.Equal(lockingScript.PubKeyHash(), HashPubKey(pubKey))
+	}
+	return lockingScript.IsP2SH() && in.PrevOut.IsLockedWithScript(in.RedeemScript) &&
+		canSignScript(in.RedeemScript, pubKey)
+}
+
+// CombinePartialTransactions merges the signatures of several copies
+// of the same partial transaction
+func CombinePartialTransactions(parts ...*PartialTransaction) (*PartialTransaction, error) {
+	if len(parts) == 0 {
+		return nil, ErrInvalidPartialTx
+	}
+	combined := parts[0].copy()
+	for _, part := range parts[1:] {
+		if !bytes.Equal(part.Tx.Hash(), combined.Tx.Hash()) || len(part.Inputs) != len(combined.Inputs) {
+			return nil, ErrPartialTxMismatch
+		}
+		for idx, in := range part.Inputs {
+			for pubKey, signature := range in.Signatures {
+				combined.Inputs[idx].Signatures[pubKey] = signature
+			}
+			if len(in.FinalScriptSig) != 0 {
+				combined.Inputs[idx].FinalScriptSig = in.FinalScriptSig
+			}
+		}
+	}
+	return combined, nil
+}
+
+// copy returns a copy of the partial transaction not sharing the signatures
+func (p *PartialTransaction) copy() *PartialTransaction {
+	c := &PartialTransaction{Tx: p.Tx, Inputs: []PartialInput{}}
+	for _, in := range p.Inputs {
+		signatures := make(map[string][]byte)
+		for pubKey, signature := range in.Signatures {
+			signatures[pubKey] = signature
+		}
+		in.Signatures = signatures
+		c.Inputs = append(c.Inputs, in)
+	}
+	return c
+}
+
+// Finalize builds the unlocking script of each input from the collected
+// signatures and checks it against the spent output
+func (p *PartialTransaction) Finalize() error {
+	tx := p.Tx
+	tx.Vin = append([]TXInput{}, p.Tx.Vin...)
+	for idx := range p.Inputs {
+		in := &p.Inputs[idx]
+		scriptSig, err := in.unlockingScript()
+		if err != nil {
+			return err
+		}
+		tx.Vin[idx].ScriptSig = scriptSig
+		if err := tx.VerifyInput(idx, &in.PrevOut); err != nil {
+			return ErrMissingSignatures
+		}
+	}
+	for idx := range p.Inputs {
+		p.Inputs[idx].FinalScriptSig = tx.Vin[idx].ScriptSig
+	}
+	return nil
+}
+
+// unlockingScript builds the unlocking script of the input from its signatures
+func (in *PartialInput) unlockingScript() (Script, error) {
+	lockingScript := in.PrevOut.LockingScript()
+	if lockingScript.PubKeyHash() != nil {
+		for pubKeyHex, signature := range in.Signatures {
+			pubKey := Hex2Bytes(pubKeyHex)
+			if bytes.Equal(lockingScript.PubKeyHash(), HashPubKey(pubKey)) {
+				return P2PKHUnlockingScript(signature, pubKey), nil
+			}
+		}
+		return nil, ErrMissingSignatures
+	}
+	if !lockingScript.IsP2SH() {
+		return nil, ErrInvalidPartialTx
+	}
+	m, pubKeys, err := in.RedeemScript.ParseMultisig()
+	if err != nil {
+		// redeem script ending like a P2PKH script
+		for pubKeyHex, signature := range in.Signatures {
+			pubKey := Hex2Bytes(pubKeyHex)
+			if bytes.Equal(in.RedeemScript.TrailingPubKeyHash(), HashPubKey(pubKey)) {
+				return NewScriptBuilder().AddData(signature).AddData(pubKey).AddData(in.RedeemScript).Script(), nil
+			}
+		}
+		return nil, ErrMissingSignatures
+	}
+	// signatures ordered as their public keys in the redeem script
+	signatures := [][]byte{}
+	for _, pubKey := range pubKeys {
+		if signature, ok := in.Signatures[Bytes2Hex(pubKey)]; ok && len(signatures) < m {
+			signatures = append(signatures, signature)
+		}
+	}
+	if len(signatures) < m {
+		return nil, ErrMissingSignatures
+	}
+	return multisigUnlockingScript(signatures, in.RedeemScript), nil
+}
+
+// Extract returns the signed transaction of a finalized partial transaction
+func (p *PartialTransaction) Extract() (*Transaction, error) {
+	tx := p.Tx
+	tx.Vin = []TXInput{}
+	for idx, input := range p.Tx.Vin {
+		in := p.Inputs[idx]
+		if len(in.FinalScriptSig) == 0 {
+			return nil, ErrNotFinalized
+		}
+		input.ScriptSig = in.FinalScriptSig
+		// keep the legacy fields of the P2PKH and P2WPKH inputs
+		if in.PrevOut.LockingScript().PubKeyHash() != nil {
+			pushed, _ := in.FinalScriptSig.PushedData()
+			input.Signature, input.PubKey = pushed[0], pushed[1]
+		}
+		tx.Vin = append(tx.Vin, input)
+	}
+	return &tx, nil
+}
+
+// Fee returns the value of the spent outputs not paid to the outputs
+func (p *PartialTransaction) Fee() int {
+	fee := 0
+	for _, in := range p.Inputs {
+		fee += in.PrevOut.Value
+	}
+	for _, out := range p.Tx.Vout {
+		fee -= out.Value
+	}
+	return fee
+}
+
+// Encode returns the partial transaction as a base64 string
+func (p *PartialTransaction) Encode() (string, error) {
+	var buf bytes.Buffer
+	buf.Write(partialTxMagic)
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodePartialTransaction decodes a partial transaction encoded with Encode
+func DecodePartialTransaction(encoded string) (*PartialTransaction, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, partialTxMagic) {
+		return nil, ErrInvalidPartialTx
+	}
+	var p PartialTransaction
+	if err := gob.NewDecoder(bytes.NewReader(data[len(partialTxMagic):])).Decode(&p); err != nil {
+		return nil, err
+	}
+	if len(p.Inputs) != len(p.Tx.Vin) {
+		return nil, ErrInvalidPartialTx
+	}
+	for idx := range p.Inputs {
+		if !p.Inputs[idx].SigHashType.IsValid() {
+			return nil, ErrInvalidPartialTx
+		}
+		if p.Inputs[idx].Signatures == nil {
+			p.Inputs[idx].Signatures = make(map[string][]byte)
+		}
+	}
+	return &p, nil
+}
+
+// Save writes the encoded partial transaction to a file
+func (p *PartialTransaction) Save(filename string) error {
+	encoded, err := p.Encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(encoded+"\n"), 0600)
+}
+
+// LoadPartialTransaction reads a partial transaction written with Save
+func LoadPartialTransaction(filename string) (*PartialTransaction, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePartialTransaction(string(data))
+}
+
+// String returns a human-readable inspection of the partial transaction
+func (p *PartialTransaction) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("--- Partial transaction %x :", p.Tx.ID))
+	for i, in := range p.Inputs {
+		input := p.Tx.Vin[i]
+		lines = append(lines, fmt.Sprintf("     Input %d: %x:%d", i, input.Txid, input.OutIdx))
+		lines = append(lines, fmt.Sprintf("       Spends:     %v %s", in.PrevOut.Value, in.PrevOut.LockingScript()))
+		lines = append(lines, fmt.Sprintf("       Signatures: %d", len(in.Signatures)))
+		for _, hint := range in.Hints {
+			lines = append(lines, fmt.Sprintf("       Signer:     %s %s", GetAddress(hint.PubKey), hint.Path))
+		}
+		lines = append(lines, fmt.Sprintf("       Finalized:  %v", len(in.FinalScriptSig) != 0))
+	}
+	for i, out := range p.Tx.Vout {
+		lines = append(lines, fmt.Sprintf("     Output %d: %d %s", i, out.Value, out.LockingScript()))
+	}
+	lines = append(lines, fmt.Sprintf("     Fee: %d", p.Fee()))
+	return strings.Join(lines, "\n")
+}
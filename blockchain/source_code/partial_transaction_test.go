@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialTransactionMultisig(t *testing.T) {
+	alicePrivKey, alicePubKey := newKeyPair()
+	bobPrivKey, bobPubKey := newKeyPair()
+	_, carolPubKey := newKeyPair()
+	davePrivKey, _ := newKeyPair()
+	redeemScript, err := MultisigScript(2, [][]byte{alicePubKey, bobPubKey, carolPubKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, coinbaseTX := newTestChain(t, alicePubKey)
+	value := coinbaseTX.Vout[0].Value
+	funding := newTestSpend(t, alicePrivKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(value, GetScriptAddress(redeemScript))})
+	mineTestBlock(t, bc, alicePubKey, funding)
+
+	tx, err := NewMultisigTransaction(redeemScript, GetStringAddress(GetAddress(carolPubKey)), value-1, bc.FindUTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevTXs, err := bc.GetInputTXsOf(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPartialTransaction(tx, prevTXs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, 3, len(p.Inputs[0].Hints), "key hints")
+	filename := filepath.Join(t.TempDir(), "multisig.ptx")
+	if err := p.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// each signer signs its own copy of the file
+	parts := []*PartialTransaction{}
+	for _, privKey := range []ecdsa.PrivateKey{alicePrivKey, bobPrivKey} {
+		part, err := LoadPartialTransaction(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signed, err := part.Sign(privKey, SigHashAll); err != nil || signed != 1 {
+			t.Fatalf("signed %d inputs: %v", signed, err)
+		}
+		parts = append(parts, part)
+	}
+	if _, err := parts[0].Sign(davePrivKey, SigHashAll); err != ErrNothingToSign {
+		t.Errorf("signing with another key: got %v, want %v", err, ErrNothingToSign)
+	}
+	if err := parts[0].Finalize(); err != ErrMissingSignatures {
+		t.Errorf("finalizing with one signature: got %v, want %v", err, ErrMissingSignatures)
+	}
+	if _, err := parts[0].Extract(); err != ErrNotFinalized {
+		t.Errorf("extracting before finalizing: got %v, want %v", err, ErrNotFinalized)
+	}
+
+	combined, err := CombinePartialTransactions(parts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := combined.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	signedTX, err := combined.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, alicePubKey, signedTX)
+}
+
+func TestPartialTransactionKeyPaths(t *testing.T) {
+	acc, err := NewAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.Blockchain, _ = newTestChain(t, acc.PubKeyBytes)
+	_, bobPubKey := newKeyPair()
+	p, err := acc.CreatePartialTransaction(GetStringAddress(GetAddress(bobPubKey)), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, []KeyHint{{PubKey: acc.PubKeyBytes, Path: DefaultAccountPath() + "/0/0"}}, p.Inputs[0].Hints, "key hints")
+	if err := acc.SignPartialTransaction(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	signedTX, err := p.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, acc.Blockchain, bobPubKey, signedTX)
+}
+
+func TestPartialTransactionTampered(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	acc := newKeyAccount("alice", privKey)
+	acc.Blockchain, _ = newTestChain(t, pubKey)
+	_, bobPubKey := newKeyPair()
+	p, err := acc.CreatePartialTransaction(GetStringAddress(GetAddress(bobPubKey)), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tamper returns the decoded copy of the partial transaction changed by f
+	tamper := func(f func(p *PartialTransaction)) (*PartialTransaction, error) {
+		c := p.copy()
+		f(c)
+		encoded, err := c.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return DecodePartialTransaction(encoded)
+	}
+
+	if _, err := DecodePartialTransaction("cHR4"); err != ErrInvalidPartialTx {
+		t.Errorf("truncated file: got %v, want %v", err, ErrInvalidPartialTx)
+	}
+	if _, err := tamper(func(p *PartialTransaction) { p.Inputs[0].SigHashType = 0x42 }); err != ErrInvalidPartialTx {
+		t.Errorf("unknown sighash type: got %v, want %v", err, ErrInvalidPartialTx)
+	}
+	sigHashNone, err := tamper(func(p *PartialTransaction) { p.Inputs[0].SigHashType = SigHashNone })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := acc.SignPartialTransaction(sigHashNone); err != ErrPartialTxSigHash {
+		t.Errorf("signing SigHashNone input: got %v, want %v", err, ErrPartialTxSigHash)
+	}
+
+	if err := acc.SignPartialTransaction(p); err != nil {
+		t.Fatal(err)
+	}
+	// an output redirected after signing
+	redirected, err := tamper(func(p *PartialTransaction) {
+		p.Tx.Vout = append([]TXOutput{}, p.Tx.Vout...)
+		p.Tx.Vout[0] = *NewTXOutput(p.Tx.Vout[0].Value, acc.Address)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redirected.Finalize(); err != ErrMissingSignatures {
+		t.Errorf("finalizing redirected output: got %v, want %v", err, ErrMissingSignatures)
+	}
+	if _, err := CombinePartialTransactions(p, redirected); err != ErrPartialTxMismatch {
+		t.Errorf("combining redirected output: got %v, want %v", err, ErrPartialTxMismatch)
+	}
+}
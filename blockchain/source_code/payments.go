@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPayment   = errors.New("invalid payment")
+	ErrDuplicatePayment = errors.New("several payments to the same address")
+)
+
+// PaymentRequest is a batch of payments paid by a single transaction,
+// e.g. a payroll run. Batching pays one fee for the shared inputs, change
+// and overhead of the transaction instead of one per payment.
+type PaymentRequest []Payment
+
+// NewPaymentRequest returns the request paying the amounts to the
+// addresses, sorted by address
+func NewPaymentRequest(amounts map[string]int) PaymentRequest {
+	request := PaymentRequest{}
+	for address, amount := range amounts {
+		request = append(request, Payment{Address: address, Amount: amount})
+	}
+	sort.Slice(request, func(i, j int) bool { return request[i].Address < request[j].Address })
+	return request
+}
+
+// ParsePayment parses a payment written as "<address> <amount>"
+func ParsePayment(s string) (Payment, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return Payment{}, ErrInvalidPayment
+	}
+	amount, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Payment{}, ErrInvalidPayment
+	}
+	return Payment{Address: fields[0], Amount: amount}, nil
+}
+
+// Validate checks that the request has payments of positive amounts to
+// distinct valid addresses
+func (r PaymentRequest) Validate() error {
+	if len(r) == 0 {
+		return ErrInvalidPayment
+	}
+	addresses := make(map[string]bool)
+	for _, p := range r {
+		if _, err := ParseAddress(p.Address); err != nil {
+			return err
+		}
+		if p.Amount <= 0 {
+			return ErrInvalidPayment
+		}
+		if addresses[p.Address] {
+			return ErrDuplicatePayment
+		}
+		addresses[p.Address] = true
+	}
+	return nil
+}
+
+// Total returns the amount paid by the request
+func (r PaymentRequest) Total() int {
+	total := 0
+	for _, p := range r {
+		total += p.Amount
+	}
+	return total
+}
+
+// NewBatchTransaction creates a transaction paying all the payments of the
+// request, in order, funded by the coins of the key chosen by the funding
+// options. The excess of the coins goes back to the key as a last change
+// output, unless it is given to the fee to avoid a dust change output.
+// NOTE: The returned tx is NOT signed!
+func NewBatchTransaction(pubKey []byte, request PaymentRequest, utxos UTXOSet, opts FundingOptions) (*Transaction, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	pubKeyHash := HashPubKey(pubKey)
+	selection, err := opts.selectCoins(pubKeyHash, request.Total(), len(request), utxos)
+	if err != nil {
+		return nil, err
+	}
+	vout := []TXOutput{}
+	for _, p := range request {
+		vout = append(vout, *NewTXOutput(p.Amount, p.Address))
+	}
+	if selection.Change > 0 {
+		vout = append(vout, TXOutput{Value: selection.Change, PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)})
+	}
+	tx := &Transaction{Vin: selection.inputs(pubKey, opts.sequence()), Vout: vout}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+// The policy decides which valid transactions the mempool relays and
+// mines, as the standardness rules of Bitcoin Core. It is not part of
+// the consensus: a block is accepted with non-standard transactions.
+// https://github.com/bitcoin/bitcoin/blob/master/src/policy/policy.h
+
+// RejectReason is the reason code of the rejection of a non-standard
+// transaction, as the reject reasons of Bitcoin Core
+type RejectReason string
+
+const (
+	RejectTxSize             RejectReason = "tx-size"
+	RejectTooManyInputs      RejectReason = "too-many-inputs"
+	RejectTooManyOutputs     RejectReason = "too-many-outputs"
+	RejectScriptSigSize      RejectReason = "scriptsig-size"
+	RejectScriptSigPushOnly  RejectReason = "scriptsig-not-pushonly"
+	RejectScriptPubKey       RejectReason = "scriptpubkey"
+	RejectBareMultisig       RejectReason = "bare-multisig"
+	RejectDust               RejectReason = "dust"
+	RejectDataCarrierSize    RejectReason = "datacarrier-size"
+	RejectMultipleDataOutput RejectReason = "multi-op-return"
+)
+
+// Error returns the reason of the rejection
+func (r RejectReason) Error() string {
+	return "non-standard transaction: " + string(r)
+}
+
+// ScriptType is the type of a locking script
+type ScriptType int
+
+const (
+	ScriptNonStandard ScriptType = iota
+	ScriptP2PKH
+	ScriptP2WPKH
+	ScriptP2SH
+	ScriptMultisig
+	ScriptNullData
+)
+
+// Type returns the type of the locking script
+func (s Script) Type() ScriptType {
+	switch {
+	case s.IsP2PKH():
+		return ScriptP2PKH
+	case s.IsP2WPKH():
+		return ScriptP2WPKH
+	case s.IsP2SH():
+		return ScriptP2SH
+	case s.IsNullData():
+		return ScriptNullData
+	}
+	if _, _, err := s.ParseMultisig(); err == nil {
+		return ScriptMultisig
+	}
+	return ScriptNonStandard
+}
+
+// Policy holds the limits of the standard transactions
+type Policy struct {
+	MaxTxSize             int          // bytes
+	MaxInputs             int          // inputs per transaction
+	MaxOutputs            int          // outputs per transaction
+	MaxScriptSigSize      int          // bytes of an unlocking script
+	AllowedScripts        []ScriptType // types of the locking scripts
+	MaxMultisigKeys       int          // public keys of a bare multisig locking script
+	DustRelayFeeRate      int          // an output spent at this fee rate costs more than its value is dust
+	MaxDataCarrierSize    int          // bytes of data of a data carrier output
+	MaxDataCarrierOutputs int          // data carrier outputs per transaction
+}
+
+// DefaultPolicy is the policy of the mempools
+var DefaultPolicy = Policy{
+	MaxTxSize:             100000,
+	MaxInputs:             1000,
+	MaxOutputs:            1000,
+	MaxScriptSigSize:      1650,
+	AllowedScripts:        []ScriptType{ScriptP2PKH, ScriptP2WPKH, ScriptP2SH, ScriptMultisig, ScriptNullData},
+	MaxMultisigKeys:       3,
+	DustRelayFeeRate:      3,
+	MaxDataCarrierSize:    MaxDataCarrierSize,
+	MaxDataCarrierOutputs: 1,
+}
+
+// allows checks whether the locking scripts of the type are standard
+func (p Policy) allows(scriptType ScriptType) bool {
+	for _, allowed := range p.AllowedScripts {
+		if allowed == scriptType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransaction checks that the transaction is standard, returning the
+// RejectReason of the first rule it breaks
+func (p Policy) CheckTransaction(tx *Transaction) error {
+	if tx.Size() > p.MaxTxSize {
+		return RejectTxSize
+	}
+	if len(tx.Vin) > p.MaxInputs {
+		return RejectTooManyInputs
+	}
+	if len(tx.Vout) > p.MaxOutputs {
+		return RejectTooManyOutputs
+	}
+	for _, in := range tx.Vin {
+		if len(in.ScriptSig) > p.MaxScriptSigSize {
+			return RejectScriptSigSize
+		}
+		if len(in.ScriptSig) != 0 && !in.ScriptSig.IsPushOnly() {
+			return RejectScriptSigPushOnly
+		}
+	}
+	dataOutputs := 0
+	for _, out := range tx.Vout {
+		script := out.LockingScript()
+		scriptType := script.Type()
+		if !p.allows(scriptType) {
+			return RejectScriptPubKey
+		}
+		switch scriptType {
+		case ScriptMultisig:
+			if _, pubKeys, _ := script.ParseMultisig(); len(pubKeys) > p.MaxMultisigKeys {
+				return RejectBareMultisig
+			}
+		case ScriptNullData:
+			dataOutputs++
+			if len(script.NullData()) > p.MaxDataCarrierSize {
+				return RejectDataCarrierSize
+			}
+			continue
+		}
+		// the outputs carrying a token or an NFT are worth more than their value
+		if !out.HasToken() && out.NFT == nil && out.Value < DustLimit(p.DustRelayFeeRate) {
+			return RejectDust
+		}
+	}
+	if dataOutputs > p.MaxDataCarrierOutputs {
+		return RejectMultipleDataOutput
+	}
+	return nil
+}
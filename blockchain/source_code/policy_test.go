@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScriptTypes(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{1}, 20)
+	multisig, err := MultisigScript(1, [][]byte{bytes.Repeat([]byte{2}, 33)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		script Script
+		want   ScriptType
+	}{
+		{P2PKHScript(pubKeyHash), ScriptP2PKH},
+		{P2WPKHScript(pubKeyHash), ScriptP2WPKH},
+		{P2SHScript(pubKeyHash), ScriptP2SH},
+		{multisig, ScriptMultisig},
+		{NullDataScript([]byte("data")), ScriptNullData},
+		{Script{OP_1}, ScriptNonStandard},
+		{Script{}, ScriptNonStandard},
+	}
+	for _, test := range tests {
+		if got := test.script.Type(); got != test.want {
+			t.Errorf("%v: got type %d, want %d", test.script, got, test.want)
+		}
+	}
+}
+
+func TestPolicyCheckTransaction(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{1}, 20)
+	pubKeys := [][]byte{}
+	for i := byte(2); i < 6; i++ {
+		pubKeys = append(pubKeys, bytes.Repeat([]byte{i}, 33))
+	}
+	multisig3, _ := MultisigScript(1, pubKeys[:3])
+	multisig4, _ := MultisigScript(1, pubKeys)
+	data, _ := NewDataOutput([]byte("data"))
+	largeData := TXOutput{ScriptPubKey: NullDataScript(make([]byte, MaxDataCarrierSize+1))}
+	output := func(value int, script Script) TXOutput {
+		return TXOutput{Value: value, ScriptPubKey: script}
+	}
+	newTx := func(vout ...TXOutput) *Transaction {
+		tx := &Transaction{
+			Vin:  []TXInput{{Txid: []byte{1}, ScriptSig: Script{OP_1}, Sequence: SequenceFinal}},
+			Vout: append([]TXOutput{output(10, P2PKHScript(pubKeyHash))}, vout...),
+		}
+		tx.ID = tx.Hash()
+		return tx
+	}
+	small := DefaultPolicy
+	small.MaxInputs, small.MaxOutputs, small.MaxScriptSigSize = 1, 2, 10
+	small.DustRelayFeeRate = 1000
+	tests := []struct {
+		name   string
+		policy Policy
+		tx     *Transaction
+		want   error
+	}{
+		{"p2pkh", DefaultPolicy, newTx(), nil},
+		{"all the standard scripts", DefaultPolicy, newTx(output(1, P2WPKHScript(pubKeyHash)), output(1, P2SHScript(pubKeyHash)), output(1, multisig3), *data), nil},
+		{"non-standard script", DefaultPolicy, newTx(output(1, Script{OP_1})), RejectScriptPubKey},
+		{"bare multisig of 4 keys", DefaultPolicy, newTx(output(1, multisig4)), RejectBareMultisig},
+		{"dust", DefaultPolicy, newTx(output(0, P2PKHScript(pubKeyHash))), RejectDust},
+		{"dust at the relay fee rate", small, newTx(output(DustLimit(1000)-1, P2PKHScript(pubKeyHash))), RejectDust},
+		{"dust carrying a token", DefaultPolicy, newTx(TXOutput{ScriptPubKey: P2PKHScript(pubKeyHash), TokenID: []byte{1}, TokenAmount: 1}), nil},
+		{"two data outputs", DefaultPolicy, newTx(*data, *data), RejectMultipleDataOutput},
+		{"data too large", DefaultPolicy, newTx(largeData), RejectDataCarrierSize},
+		{"too many outputs", small, newTx(*data, *data), RejectTooManyOutputs},
+		{"too many inputs", small, &Transaction{Vin: make([]TXInput, 2)}, RejectTooManyInputs},
+		{"unlocking script too large", small, &Transaction{Vin: []TXInput{{ScriptSig: make(Script, 11)}}}, RejectScriptSigSize},
+		{"unlocking script not push only", DefaultPolicy, &Transaction{Vin: []TXInput{{ScriptSig: Script{OP_DUP}}}}, RejectScriptSigPushOnly},
+		{"transaction too large", Policy{MaxTxSize: 10}, newTx(), RejectTxSize},
+	}
+	for _, test := range tests {
+		if err := test.policy.CheckTransaction(test.tx); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestMempoolPolicy(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	_, recipientPubKey := newKeyPair()
+	m, acc := newTestMempool(t, "alice", privKey)
+	to := GetStringAddress(GetAddress(recipientPubKey))
+	newTx := func(vout ...TXOutput) *Transaction {
+		utxos := acc.Blockchain.FindUTXOSet()
+		m.ExcludeSpent(utxos)
+		tx, err := NewBatchTransaction(acc.PubKeyBytes, PaymentRequest{{to, 1}}, utxos, FundingOptions{FeeRate: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Vout = append(tx.Vout, vout...)
+		tx.ID = tx.Hash()
+		prevTXs, err := m.InputTXsOf(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Sign(acc.PrivateKey, prevTXs); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	data, _ := NewDataOutput([]byte("data"))
+	tx := newTx(*data)
+	policy := DefaultPolicy
+	policy.MaxDataCarrierSize = 2
+	m.SetPolicy(policy)
+	if err := m.Add(tx); err != RejectDataCarrierSize {
+		t.Errorf("got %v, want %v", err, RejectDataCarrierSize)
+	}
+	m.SetPolicy(DefaultPolicy)
+	if err := m.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a non-standard transaction is not relayed, but valid in a block
+	nonStandard := newTx(TXOutput{ScriptPubKey: Script{OP_1}})
+	if err := m.Add(nonStandard); err != RejectScriptPubKey {
+		t.Errorf("got %v, want %v", err, RejectScriptPubKey)
+	}
+	mineTestBlock(t, acc.Blockchain, pubKey, nonStandard)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ShareTargetBits define the difficulty of a pool share,
+// lower than the network difficulty (NetworkParams.TargetBits)
+const ShareTargetBits = 4
+
+// PPLNSWindow is the number of last shares among which the
+// block reward is split (Pay Per Last N Shares)
+const PPLNSWindow = 100
+
+var (
+	ErrUnknownWorker      = errors.New("unknown worker")
+	ErrInvalidWorker      = errors.New("worker name and payout address are required")
+	ErrStaleJob           = errors.New("job is stale or unknown")
+	ErrDuplicateShare     = errors.New("duplicate share")
+	ErrLowShareDifficulty = errors.New("share does not meet the share target")
+	ErrInvalidPoolTx      = errors.New("transaction is not valid")
+)
+
+// Job represents a unit of work handed out to the pool workers
+type Job struct {
+	ID              string
+	Template        *BlockTemplate
+	Payouts         map[string]int // address -> value paid by the job coinbase, see Pool.SubmitShare
+	ShareTargetBits int
+	CleanJobs       bool // workers should drop their previous jobs
+}
+
+// Worker keeps the share accounting of a pool worker
+type Worker struct {
+	Name     string
+	Address  string // payout address
+	Accepted int    // number of accepted shares
+	Rejected int    // number of rejected shares
+	Blocks   int    // number of blocks found
+}
+
+// Pool hands out jobs to workers, validates their shares and
+// pays them proportionally to the last shares when a block is found
+type Pool struct {
+	mu         sync.Mutex
+	bc         *Blockchain
+	address    string             // pool address, receives the remainder of the payouts
+	workers    map[string]*Worker // worker name -> worker
+	shares     []string           // names of the workers of the last PPLNSWindow shares
+	jobs       map[string]*Job    // job ID -> job, of the current block height
+	current    *Job               // last job handed out
+	seen       map[string]bool    // submitted shares as "jobID:nonce"
+	pending    []*Transaction     // transactions to include in the next jobs
+	jobCounter int
+	notify     func(*Job)
+}
+
+// NewPool creates a mining pool working on top of the given blockchain
+func NewPool(bc *Blockchain, address string) *Pool {
+	return &Pool{
+		bc:      bc,
+		address: address,
+		workers: make(map[string]*Worker),
+		jobs:    make(map[string]*Job),
+		seen:    make(map[string]bool),
+	}
+}
+
+// OnJob registers the function called for each new job
+func (p *Pool) OnJob(notify func(*Job)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notify = notify
+}
+
+// Authorize registers a worker with its payout address
+func (p *Pool) Authorize(name, address string) error {
+	if name == "" || address == "" || !ValidateAddress(address) {
+		return ErrInvalidWorker
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w, ok := p.workers[name]; ok {
+		w.Address = address
+		return nil
+	}
+	p.workers[name] = &Worker{Name: name, Address: address}
+	return nil
+}
+
+// AddTransaction verifies a transaction and adds it to be included in
+// the next jobs. It may spend the outputs of the pending transactions.
+// The transaction is verified with the lock held, so that no conflicting
+// transaction or block is added meanwhile.
+func (p *Pool) AddTransaction(tx *Transaction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if tx.IsCoinbase() || !p.bc.verifyTransaction(tx, nil, p.pending) {
+		return ErrInvalidPoolTx
+	}
+	if err := p.bc.CheckTransactionLocks(tx, len(p.bc.blocks)); err != nil {
+		return err
+	}
+	p.pending = append(p.pending, tx)
+	return nil
+}
+
+// CurrentJob returns the current job, creating one if needed
+func (p *Pool) CurrentJob() (*Job, error) {
+	p.mu.Lock()
+	if p.current != nil && !p.isStale(p.current) {
+		job := p.current
+		p.mu.Unlock()
+		return job, nil
+	}
+	job, err := p.newJob()
+	p.mu.Unlock()
+	p.announce(job)
+	return job, err
+}
+
+// Refresh creates a new job, including the last pending
+// transactions and shares in the payouts
+func (p *Pool) Refresh() (*Job, error) {
+	p.mu.Lock()
+	job, err := p.newJob()
+	p.mu.Unlock()
+	p.announce(job)
+	return job, err
+}
+
+// announce notifies the new job, if any. It must be called without the
+// lock held, the notification writing to the workers connections.
+func (p *Pool) announce(job *Job) {
+	p.mu.Lock()
+	notify := p.notify
+	p.mu.Unlock()
+	if job != nil && notify != nil {
+		notify(job)
+	}
+}
+
+// newJob builds a new block template paying the last shares.
+// It must be called with the lock held, and the job announced
+// once the lock is released.
+func (p *Pool) newJob() (*Job, error) {
+	height := len(p.bc.blocks)
+	fees, err := p.pendingFees()
+	if err != nil {
+		return nil, err
+	}
+	payouts := p.payouts(netParams.BlockSubsidy(height) + fees)
+	coinbaseTX, err := NewPayoutCoinbaseTX(payouts, "", height, fees)
+	if err != nil {
+		return nil, err
+	}
+	template, err := p.bc.NewBlockTemplate(append([]*Transaction{coinbaseTX}, p.pending...))
+	if err != nil {
+		return nil, err
+	}
+	// drop the jobs of a previous block height
+	clean := p.current == nil || p.isStale(p.current)
+	if clean {
+		p.jobs = make(map[string]*Job)
+		p.seen = make(map[string]bool)
+	}
+	p.jobCounter++
+	job := &Job{
+		ID:              fmt.Sprintf("%x", p.jobCounter),
+		Template:        template,
+		Payouts:         payouts,
+		ShareTargetBits: shareTargetBits(),
+		CleanJobs:       clean,
+	}
+	p.jobs[job.ID] = job
+	p.current = job
+	return job, nil
+}
+
+// pendingFees returns the fees of the pending transactions, paid to the
+// workers with the subsidy. It must be called with the lock held.
+func (p *Pool) pendingFees() (int, error) {
+	fees := 0
+	for _, tx := range p.pending {
+		prevTXs, err := p.bc.inputTXsOf(tx, p.pending)
+		if err != nil {
+			return 0, err
+		}
+		fee, err := tx.Fee(prevTXs)
+		if err != nil {
+			return 0, err
+		}
+		fees += fee
+	}
+	return fees, nil
+}
+
+// shareTargetBits returns the difficulty of the shares, at most the
+// network difficulty
+func shareTargetBits() int {
+	if netParams.TargetBits < ShareTargetBits {
+		return netParams.TargetBits
+	}
+	return ShareTargetBits
+}
+
+// payouts splits the block reward proportionally to the shares of
+// the last PPLNSWindow shares. The remainder of the integer division
+// goes to the pool address. It must be called with the lock held.
+func (p *Pool) payouts(reward int) map[string]int {
+	payouts := make(map[string]int)
+	if len(p.shares) == 0 {
+		payouts[p.address] = reward
+		return payouts
+	}
+	sharesByAddress := make(map[string]int)
+	for _, name := range p.shares {
+		sharesByAddress[p.workers[name].Address]++
+	}
+	paid := 0
+	for address, shares := range sharesByAddress {
+		value := reward * shares / len(p.shares)
+		payouts[address] += value
+		paid += value
+	}
+	if paid < reward {
+		payouts[p.address] += reward - paid
+	}
+	return payouts
+}
+
+// isStale checks if the job is not on top of the current block
+func (p *Pool) isStale(job *Job) bool {
+	return !bytes.Equal(job.Template.Block.PrevBlockHash, p.bc.CurrentBlock().Hash)
+}
+
+// SubmitShare validates a share submitted by a worker and credits it.
+// If the share also meets the network target, the block is added to
+// the blockchain and returned. The coinbase of the block pays the
+// payouts of its job, fixed when the job was created: the share
+// finding the block is paid by the next blocks, while it stays among
+// the last PPLNSWindow shares.
+func (p *Pool) SubmitShare(name, jobID string, nonce int) (*Block, error) {
+	p.mu.Lock()
+	block, job, err := p.submitShare(name, jobID, nonce)
+	p.mu.Unlock()
+	p.announce(job)
+	return block, err
+}
+
+// submitShare validates and credits a share, and returns the found block
+// and the job on top of it. It must be called with the lock held.
+func (p *Pool) submitShare(name, jobID string, nonce int) (*Block, *Job, error) {
+	worker, ok := p.workers[name]
+	if !ok {
+		return nil, nil, ErrUnknownWorker
+	}
+	job, ok := p.jobs[jobID]
+	if !ok || p.isStale(job) {
+		worker.Rejected++
+		return nil, nil, ErrStaleJob
+	}
+	key := fmt.Sprintf("%s:%d", jobID, nonce)
+	if p.seen[key] {
+		worker.Rejected++
+		return nil, nil, ErrDuplicateShare
+	}
+	if !hashMeetsTarget(job.Template.Hash(nonce), targetFromBits(job.ShareTargetBits)) {
+		worker.Rejected++
+		return nil, nil, ErrLowShareDifficulty
+	}
+	p.seen[key] = true
+	worker.Accepted++
+	p.shares = append(p.shares, name)
+	if len(p.shares) > PPLNSWindow {
+		p.shares = p.shares[len(p.shares)-PPLNSWindow:]
+	}
+
+	block, found := job.Template.Solve(nonce)
+	if !found {
+		return nil, nil, nil
+	}
+	if err := p.bc.addBlock(block); err != nil {
+		return nil, nil, err
+	}
+	worker.Blocks++
+	p.removePending(block.Transactions)
+	next, err := p.newJob()
+	return block, next, err
+}
+
+// removePending removes the mined transactions from the pending ones.
+// It must be called with the lock held.
+func (p *Pool) removePending(mined []*Transaction) {
+	pending := []*Transaction{}
+	for _, tx := range p.pending {
+		included := false
+		for _, minedTx := range mined {
+			if minedTx.Equals(tx.ID) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			pending = append(pending, tx)
+		}
+	}
+	p.pending = pending
+}
+
+// Workers returns the share accounting of all workers sorted by name
+func (p *Pool) Workers() []Worker {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	workers := []Worker{}
+	for _, w := range p.workers {
+		workers = append(workers, *w)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Name < workers[j].Name })
+	return workers
+}
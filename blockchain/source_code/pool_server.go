@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+)
+
+var ErrInvalidParams = errors.New("invalid params")
+
+// stratumRequest is a line-delimited JSON-RPC message sent by a worker
+type stratumRequest struct {
+	ID     int               `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumResponse is the answer to a stratumRequest
+type stratumResponse struct {
+	ID     int         `json:"id"`
+	Result interface{} `json:"result"`
+	Error  *string     `json:"error"`
+}
+
+// stratumNotification is a message sent by the pool without request
+type stratumNotification struct {
+	ID     *int          `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// PoolServer exposes a Pool to remote workers using a Stratum-like protocol:
+//
+//	mining.subscribe []                         -> true, followed by a mining.notify
+//	mining.authorize [worker, payout address]   -> true
+//	mining.submit    [worker, job ID, nonce]    -> true if a block was found
+//
+// Jobs are pushed as:
+//
+//	mining.notify [job ID, prev. hash, header, share target bits, target bits, clean jobs]
+//
+// where a share is a nonce such that sha256(header || nonce) meets the share target,
+// the nonce being encoded as in IntToHex.
+type PoolServer struct {
+	pool     *Pool
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]*json.Encoder // subscribed connections
+	writeMu  sync.Mutex                 // serializes the messages sent to workers
+}
+
+// NewPoolServer creates a Stratum-like server for the pool
+func NewPoolServer(pool *Pool) *PoolServer {
+	s := &PoolServer{pool: pool, conns: make(map[net.Conn]*json.Encoder)}
+	pool.OnJob(s.broadcastJob)
+	return s
+}
+
+// Listen starts accepting workers on the given address
+func (s *PoolServer) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.acceptLoop()
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *PoolServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the server and disconnects all workers
+func (s *PoolServer) Close() error {
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	return s.listener.Close()
+}
+
+func (s *PoolServer) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *PoolServer) handleConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			s.send(enc, stratumResponse{Error: errorString(err)})
+			continue
+		}
+		if req.Method == "mining.subscribe" {
+			s.subscribe(conn, enc, req)
+			continue
+		}
+		result, err := s.handle(req)
+		s.send(enc, stratumResponse{ID: req.ID, Result: result, Error: errorString(err)})
+	}
+}
+
+// subscribe registers the connection for job notifications
+// and sends it the current job
+func (s *PoolServer) subscribe(conn net.Conn, enc *json.Encoder, req stratumRequest) {
+	// get the job before registering the connection, so that a newly
+	// created job is not notified twice
+	job, err := s.pool.CurrentJob()
+	if err != nil {
+		s.send(enc, stratumResponse{ID: req.ID, Error: errorString(err)})
+		return
+	}
+	s.mu.Lock()
+	s.conns[conn] = enc
+	s.mu.Unlock()
+	s.send(enc, stratumResponse{ID: req.ID, Result: true})
+	s.send(enc, jobNotification(job))
+}
+
+// handle dispatches a worker request to the pool
+func (s *PoolServer) handle(req stratumRequest) (interface{}, error) {
+	switch req.Method {
+	case "mining.authorize":
+		var name, address string
+		if len(req.Params) != 2 ||
+			json.Unmarshal(req.Params[0], &name) != nil ||
+			json.Unmarshal(req.Params[1], &address) != nil {
+			return nil, ErrInvalidParams
+		}
+		if err := s.pool.Authorize(name, address); err != nil {
+			return nil, err
+		}
+		return true, nil
+	case "mining.submit":
+		var name, jobID string
+		var nonce int
+		if len(req.Params) != 3 ||
+			json.Unmarshal(req.Params[0], &name) != nil ||
+			json.Unmarshal(req.Params[1], &jobID) != nil ||
+			json.Unmarshal(req.Params[2], &nonce) != nil {
+			return nil, ErrInvalidParams
+		}
+		block, err := s.pool.SubmitShare(name, jobID, nonce)
+		if err != nil {
+			return nil, err
+		}
+		return block != nil, nil
+	}
+	return nil, errors.New("unknown method " + req.Method)
+}
+
+// broadcastJob notifies all subscribed workers of a new job
+func (s *PoolServer) broadcastJob(job *Job) {
+	notification := jobNotification(job)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, enc := range s.conns {
+		s.send(enc, notification)
+	}
+}
+
+func (s *PoolServer) send(enc *json.Encoder, message interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	// errors are handled by the read loop of the connection
+	enc.Encode(message)
+}
+
+func jobNotification(job *Job) stratumNotification {
+	block := job.Template.Block
+	return stratumNotification{
+		Method: "mining.notify",
+		Params: []interface{}{
+			job.ID,
+			Bytes2Hex(block.PrevBlockHash),
+			Bytes2Hex(job.Template.Header()),
+			job.ShareTargetBits,
+			netParams.TargetBits,
+			job.CleanJobs,
+		},
+	}
+}
+
+func errorString(err error) *string {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	return &msg
+}
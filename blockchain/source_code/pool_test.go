@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPoolAddTransaction(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	pool := NewPool(bc, GetStringAddress(GetAddress(pubKey)))
+	_, otherPubKey := newKeyPair()
+	to := GetStringAddress(GetAddress(otherPubKey))
+	value := coinbaseTX.Vout[0].Value
+
+	tx := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(value, to)})
+	forged := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(value, to)})
+	forged.Vin[0].ScriptSig[10] ^= 1
+	if err := pool.AddTransaction(forged); err != ErrInvalidPoolTx {
+		t.Errorf("forged signature: got %v, want %v", err, ErrInvalidPoolTx)
+	}
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("valid transaction rejected: %v", err)
+	}
+	// the pending transaction already spends the output
+	doubleSpend := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(value-1, to)})
+	if err := pool.AddTransaction(doubleSpend); err != ErrInvalidPoolTx {
+		t.Errorf("double spend: got %v, want %v", err, ErrInvalidPoolTx)
+	}
+}
+
+func TestPoolNotifiesWithoutLock(t *testing.T) {
+	_, pubKey := newKeyPair()
+	bc, _ := newTestChain(t, pubKey)
+	address := GetStringAddress(GetAddress(pubKey))
+	pool := NewPool(bc, address)
+	if err := pool.Authorize("worker", address); err != nil {
+		t.Fatal(err)
+	}
+	jobs := make(chan *Job, 8)
+	pool.OnJob(func(job *Job) {
+		// the pool is usable while the job is notified
+		pool.Workers()
+		jobs <- job
+	})
+	job, err := pool.CurrentJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *Block
+	for nonce := 0; block == nil; nonce++ {
+		block, err = pool.SubmitShare("worker", job.ID, nonce)
+		if err != nil && err != ErrLowShareDifficulty {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(bc.CurrentBlock().Hash, block.Hash) {
+		t.Error("found block not added to the blockchain")
+	}
+	for _, want := range []string{job.ID, "next"} {
+		select {
+		case notified := <-jobs:
+			if want != "next" && notified.ID != want {
+				t.Errorf("notified job %s, want %s", notified.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("job not notified")
+		}
+	}
+}
+
+func TestPoolAuthorize(t *testing.T) {
+	_, pubKey := newKeyPair()
+	bc, _ := newTestChain(t, pubKey)
+	address := GetStringAddress(GetAddress(pubKey))
+	pool := NewPool(bc, address)
+	for _, payout := range []string{"", "1", address[:len(address)-1]} {
+		if err := pool.Authorize("worker", payout); err != ErrInvalidWorker {
+			t.Errorf("payout address %q: got %v, want %v", payout, err, ErrInvalidWorker)
+		}
+	}
+	if err := pool.Authorize("worker", address); err != nil {
+		t.Errorf("valid payout address rejected: %v", err)
+	}
+}
+
+func TestPoolPaysFees(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	address := GetStringAddress(GetAddress(pubKey))
+	pool := NewPool(bc, address)
+	if err := pool.Authorize("worker", address); err != nil {
+		t.Fatal(err)
+	}
+	const fee = 3
+	_, otherPubKey := newKeyPair()
+	to := GetStringAddress(GetAddress(otherPubKey))
+	tx := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value-fee, to)})
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	job, err := pool.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reward := netParams.BlockSubsidy(len(bc.blocks)) + fee
+	paid := 0
+	for _, value := range job.Payouts {
+		paid += value
+	}
+	diff(t, reward, paid, "payouts")
+	// the payouts must collect the fees
+	if _, err := NewPayoutCoinbaseTX(map[string]int{address: reward - fee}, "", len(bc.blocks), fee); err != ErrInvalidPayouts {
+		t.Errorf("payouts without the fees: got %v, want %v", err, ErrInvalidPayouts)
+	}
+	var block *Block
+	for nonce := 0; block == nil; nonce++ {
+		block, err = pool.SubmitShare("worker", job.ID, nonce)
+		if err != nil && err != ErrLowShareDifficulty {
+			t.Fatal(err)
+		}
+	}
+	diff(t, 2, len(block.Transactions), "block transactions")
+	diff(t, reward, block.Transactions[0].Vout[0].Value, "coinbase value")
+}
@@ -10,24 +10,50 @@ import (
 var maxNonce = math.MaxInt64
 
 // TARGETBITS define the mining difficulty
+//
+// Deprecated: it is the one of the main network, see
+// NetworkParams.TargetBits.
 const TARGETBITS = 8
 
 // ProofOfWork represents a block mined with a target difficulty
 type ProofOfWork struct {
 	block  *Block
+	bits   int
 	target *big.Int
 }
 
-// NewProofOfWork builds a ProofOfWork
+// NewProofOfWork builds a ProofOfWork with the difficulty of the network in use
 func NewProofOfWork(block *Block) *ProofOfWork {
-	targetDifficulty:=new(big.Int).Exp(big.NewInt(2), big.NewInt(256-TARGETBITS), nil)
-	return &ProofOfWork{block:block, target:targetDifficulty}
+	return newProofOfWork(block, netParams.TargetBits)
+}
+
+// newProofOfWork builds a ProofOfWork with the given difficulty bits
+func newProofOfWork(block *Block, bits int) *ProofOfWork {
+	return &ProofOfWork{block:block, bits:bits, target:targetFromBits(bits)}
+}
+
+// targetFromBits returns the target a hash must be below
+// to satisfy the given difficulty bits
+func targetFromBits(bits int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(2), big.NewInt(int64(256-bits)), nil)
+}
+
+// hashMeetsTarget checks whether the hash is less than the target
+func hashMeetsTarget(hash []byte, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash).Cmp(target) == -1
+}
+
+// hashHeader returns the hash of the header with the given nonce
+func hashHeader(header []byte, nonce int) []byte {
+	h := sha256.New()
+	h.Write(addNonce(nonce, header))
+	return h.Sum(nil)
 }
 
 // setupHeader prepare the header of the block
 func (pow *ProofOfWork) setupHeader() []byte {
 	block:=pow.block
-	slice:=[][]byte{block.PrevBlockHash,block.HashTransactions(),IntToHex(block.Timestamp),IntToHex(TARGETBITS)}
+	slice:=[][]byte{block.PrevBlockHash,block.HashTransactions(),IntToHex(block.Timestamp),IntToHex(int64(pow.bits))}
 	header:=[]byte{}
 	for _,value := range slice {
 		header=append(header,value...)
@@ -0,0 +1,78 @@
+package main
+
+import "errors"
+
+// Opt-in replace-by-fee, as in Bitcoin BIP125: a transaction of the
+// mempool signaling replaceability can be replaced by a conflicting
+// transaction paying a higher fee.
+// https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki
+const (
+	// SequenceReplaceable is the sequence of the inputs of the
+	// replaceable transactions: any sequence below SequenceFinal-1
+	// signals replaceability
+	SequenceReplaceable = SequenceFinal - 2
+	// MaxReplacements bounds the number of transactions evicted by a
+	// replacement, with their descendants
+	MaxReplacements = 100
+	// IncrementalRelayFee is the fee rate, in coins per 1000 bytes, a
+	// replacement pays for its own size on top of the fees it replaces
+	IncrementalRelayFee = 1
+)
+
+var (
+	ErrTxNotReplaceable          = errors.New("conflicting transaction does not signal replaceability")
+	ErrReplacementFee            = errors.New("replacement does not pay the fees of the replaced transactions and its relay fee")
+	ErrReplacementFeeRate        = errors.New("replacement fee rate is not higher than the one of the replaced transactions")
+	ErrTooManyReplacements       = errors.New("replacement evicts too many transactions")
+	ErrReplacementNewUnconfirmed = errors.New("replacement spends new unconfirmed outputs")
+)
+
+// SignalsReplacement checks whether the transaction can be replaced in
+// the mempool: one of its inputs has a sequence below SequenceFinal-1
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, in := range tx.Vin {
+		if in.Sequence < SequenceFinal-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplacement checks that the transaction paying the fee can replace
+// the conflicting transactions of the mempool, evicting them with their
+// descendants. It must be called with the lock held.
+func (m *Mempool) checkReplacement(tx *Transaction, fee int, conflicts []string, evicted []string) error {
+	replacedParents := make(map[string]bool)
+	for _, id := range conflicts {
+		conflict := m.txs[id]
+		if !conflict.SignalsReplacement() {
+			return ErrTxNotReplaceable
+		}
+		// the fee rate must be higher than the one of each replaced transaction
+		if tx.FeeRate(fee) <= conflict.FeeRate(m.fees[id]) {
+			return ErrReplacementFeeRate
+		}
+		for _, in := range conflict.Vin {
+			replacedParents[Bytes2Hex(in.Txid)] = true
+		}
+	}
+	if len(evicted) > MaxReplacements {
+		return ErrTooManyReplacements
+	}
+	// only the unconfirmed outputs already spent by the replaced transactions
+	for _, in := range tx.Vin {
+		parent := Bytes2Hex(in.Txid)
+		if _, ok := m.txs[parent]; ok && !replacedParents[parent] {
+			return ErrReplacementNewUnconfirmed
+		}
+	}
+	// the replacement pays for the bandwidth of all the evicted transactions
+	evictedFees := 0
+	for _, id := range evicted {
+		evictedFees += m.fees[id]
+	}
+	if fee < evictedFees+TxFee(tx.Size(), IncrementalRelayFee) {
+		return ErrReplacementFee
+	}
+	return nil
+}
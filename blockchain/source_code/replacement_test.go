@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"testing"
+)
+
+func TestBuildersDoNotSignalReplacement(t *testing.T) {
+	_, pubKey := newKeyPair()
+	recipientPrivKey, recipientPubKey := newKeyPair()
+	_, coinbaseTX := newTestChain(t, pubKey)
+	utxos := UTXOSet{Bytes2Hex(coinbaseTX.ID): {0: coinbaseTX.Vout[0]}}
+	to := GetStringAddress(GetAddress(recipientPubKey))
+
+	secret, secretHash, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	htlc := &HTLC{SecretHash: secretHash, RecipientPubKeyHash: HashPubKey(recipientPubKey), RefundPubKeyHash: HashPubKey(recipientPubKey), LockTime: 10}
+	contractTx := &Transaction{Vout: []TXOutput{*NewTXOutput(10, htlc.Address())}}
+	contractTx.ID = contractTx.Hash()
+
+	txs := map[string]func() (*Transaction, error){
+		"payment": func() (*Transaction, error) { return NewUTXOTransaction(pubKey, to, 1, utxos) },
+		"data":    func() (*Transaction, error) { return NewDataTransaction(pubKey, []byte("data"), utxos) },
+		"token": func() (*Transaction, error) {
+			tx, _, err := NewTokenIssuanceTransaction(pubKey, "token", 100, 0, utxos)
+			return tx, err
+		},
+		"nft": func() (*Transaction, error) {
+			tx, _, err := NewNFTMintTransaction(pubKey, make([]byte, 32), utxos, FundingOptions{})
+			return tx, err
+		},
+		"htlc redeem": func() (*Transaction, error) {
+			return NewHTLCRedeemTransaction(htlc.Script(), contractTx, secret, to, recipientPrivKey)
+		},
+		"htlc refund": func() (*Transaction, error) {
+			return NewHTLCRefundTransaction(htlc.Script(), contractTx, to, recipientPrivKey)
+		},
+	}
+	for name, newTx := range txs {
+		tx, err := newTx()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if tx.SignalsReplacement() {
+			t.Errorf("%s: transaction signals replacement without opting in", name)
+		}
+	}
+}
+
+// newTestMempool returns a mempool on a blockchain whose first four
+// blocks pay their subsidy to the account of the key
+func newTestMempool(t *testing.T, name string, privKey ecdsa.PrivateKey) (*Mempool, Account) {
+	t.Helper()
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	bc, _ := newTestChain(t, pubKey)
+	for i := 0; i < 3; i++ {
+		mineTestBlock(t, bc, pubKey)
+	}
+	acc := newKeyAccount(name, privKey)
+	acc.Blockchain = bc
+	return NewMempool(bc), acc
+}
+
+// sendTestPayment adds to the mempool a transaction of the account paying
+// the amount to the address
+func sendTestPayment(t *testing.T, m *Mempool, acc Account, to string, amount int, opts FundingOptions) *Transaction {
+	t.Helper()
+	utxos := acc.Blockchain.FindUTXOSet()
+	m.ExcludeSpent(utxos)
+	tx, err := acc.produceBatchTransferTx(PaymentRequest{{to, amount}}, utxos, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestReplaceByFee(t *testing.T) {
+	privKey, _ := newKeyPair()
+	_, recipientPubKey := newKeyPair()
+	m, alice := newTestMempool(t, "alice", privKey)
+	to := GetStringAddress(GetAddress(recipientPubKey))
+
+	orig := sendTestPayment(t, m, alice, to, 20, FundingOptions{FeeRate: 5, Replaceable: true, Selector: LargestFirst{}})
+	if !orig.SignalsReplacement() {
+		t.Fatal("replaceable transaction does not signal replacement")
+	}
+	origFee, _ := m.Fee(orig.ID)
+	if _, err := alice.BumpFee(m, orig.ID, 1); err != ErrFeeRateTooLow {
+		t.Errorf("lower fee rate: got %v, want %v", err, ErrFeeRateTooLow)
+	}
+	replacement, err := alice.BumpFee(m, orig.ID, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(orig.ID); err == nil || m.Count() != 1 {
+		t.Error("transaction not replaced")
+	}
+	if fee, _ := m.Fee(replacement.ID); fee <= origFee {
+		t.Errorf("replacement fee %d not higher than %d", fee, origFee)
+	}
+	if err := m.Add(orig); err != ErrReplacementFeeRate {
+		t.Errorf("replaced transaction added back: got %v, want %v", err, ErrReplacementFeeRate)
+	}
+
+	// a transaction without the signal cannot be replaced
+	final := sendTestPayment(t, m, alice, to, 2, FundingOptions{FeeRate: 5, Selector: LargestFirst{}})
+	if _, err := alice.BumpFee(m, final.ID, 50); err != ErrTxNotReplaceable {
+		t.Errorf("bump fee: got %v, want %v", err, ErrTxNotReplaceable)
+	}
+	prevTXs, err := m.InputTXsOf(final)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflict := &Transaction{
+		Vin:  []TXInput{{Txid: final.Vin[0].Txid, OutIdx: final.Vin[0].OutIdx, PubKey: alice.PubKeyBytes, Sequence: SequenceReplaceable}},
+		Vout: []TXOutput{*NewTXOutput(1, to)},
+	}
+	conflict.ID = conflict.Hash()
+	if err := conflict.Sign(alice.PrivateKey, prevTXs); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(conflict); err != ErrTxNotReplaceable {
+		t.Errorf("conflicting transaction: got %v, want %v", err, ErrTxNotReplaceable)
+	}
+}
+
+func TestChildPaysForParent(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bobPrivKey, _ := newKeyPair()
+	m, alice := newTestMempool(t, "alice", privKey)
+	bob := newKeyAccount("bob", bobPrivKey)
+	bob.Blockchain = alice.Blockchain
+
+	parent := sendTestPayment(t, m, alice, bob.Address, 20, FundingOptions{FeeRate: 1, Replaceable: true, Selector: LargestFirst{}})
+	final := sendTestPayment(t, m, alice, bob.Address, 2, FundingOptions{FeeRate: 5, Selector: LargestFirst{}})
+	parentFee, _ := m.Fee(parent.ID)
+	finalFee, _ := m.Fee(final.ID)
+	child, err := bob.BumpFeeCPFP(m, parent.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	childFee, _ := m.Fee(child.ID)
+	if rate := (parentFee + childFee) * 1000 / (parent.Size() + child.Size()); rate < 10 {
+		t.Errorf("package fee rate: got %d, want at least 10", rate)
+	}
+	// replacing the parent evicts the child, whose fee must be paid too
+	if _, err := alice.BumpFee(m, parent.ID, 2); err != ErrReplacementFee {
+		t.Errorf("parent replacement: got %v, want %v", err, ErrReplacementFee)
+	}
+
+	// the package is mined first, the parent before the child
+	txs, fees := m.BlockTransactions(MaxBlockSize)
+	diff(t, [][]byte{parent.ID, child.ID, final.ID}, [][]byte{txs[0].ID, txs[1].ID, txs[2].ID}, "block transactions")
+	diff(t, parentFee+childFee+finalFee, fees, "block fees")
+	txs, _ = m.BlockTransactions(parent.Size() + child.Size())
+	if len(txs) != 2 {
+		t.Errorf("%d transactions in a block fitting the package", len(txs))
+	}
+	block := mineTestBlock(t, alice.Blockchain, pubKey, txs...)
+	m.Remove(block.Transactions)
+	if m.Count() != 1 {
+		t.Errorf("%d transactions left in the mempool, want 1", m.Count())
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// BIP340 Schnorr signatures on secp256k1. Public keys are the 32-byte x
+// coordinate of the point with an even y, so that an input carrying a
+// 32-byte public key is signed with Schnorr instead of ECDSA.
+// https://github.com/bitcoin/bips/blob/master/bip-0340.mediawiki
+
+const (
+	SchnorrPubKeySize    = 32
+	SchnorrSignatureSize = 64
+)
+
+var (
+	ErrSchnorrCurve = errors.New("schnorr signatures require secp256k1 keys")
+	ErrSchnorrSign  = errors.New("schnorr signature generation failed")
+)
+
+// taggedHash returns sha256(sha256(tag) || sha256(tag) || data...)
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// schnorrEnabled checks whether the keys of the network can sign with Schnorr
+func schnorrEnabled() bool {
+	return keyParams.Curve == S256()
+}
+
+// scalarBytes returns the 32-byte big endian encoding of the integer
+func scalarBytes(k *big.Int) []byte {
+	return k.FillBytes(make([]byte, 32))
+}
+
+// liftX returns the point of the x coordinate with an even y
+func liftX(x *big.Int) (*big.Int, *big.Int) {
+	return secp256k1.decompress(x, false)
+}
+
+// hashToScalar returns the hash as an integer modulo the curve order
+func hashToScalar(hash []byte) *big.Int {
+	e := new(big.Int).SetBytes(hash)
+	return e.Mod(e, secp256k1.N)
+}
+
+// evenKey returns the private scalar whose public key has an even y
+func evenKey(privKey ecdsa.PrivateKey) *big.Int {
+	d := new(big.Int).Set(privKey.D)
+	if privKey.PublicKey.Y.Bit(0) == 1 {
+		d.Sub(secp256k1.N, d)
+	}
+	return d
+}
+
+// SchnorrPubKey returns the x-only public key of the key pair
+func SchnorrPubKey(pubKey ecdsa.PublicKey) []byte {
+	return scalarBytes(pubKey.X)
+}
+
+// SchnorrSign signs the message with fresh auxiliary randomness
+func SchnorrSign(privKey ecdsa.PrivateKey, msg []byte) ([]byte, error) {
+	auxRand := make([]byte, 32)
+	if _, err := rand.Read(auxRand); err != nil {
+		return nil, err
+	}
+	return schnorrSign(privKey, msg, auxRand)
+}
+
+// schnorrSign signs the message, the nonce being derived from the key,
+// the message and the auxiliary randomness
+func schnorrSign(privKey ecdsa.PrivateKey, msg, auxRand []byte) ([]byte, error) {
+	if privKey.Curve != S256() {
+		return nil, ErrSchnorrCurve
+	}
+	n := secp256k1.N
+	d := evenKey(privKey)
+	pubKey := SchnorrPubKey(privKey.PublicKey)
+	t := scalarBytes(d)
+	for i, b := range taggedHash("BIP0340/aux", auxRand) {
+		t[i] ^= b
+	}
+	k := hashToScalar(taggedHash("BIP0340/nonce", t, pubKey, msg))
+	if k.Sign() == 0 {
+		return nil, ErrSchnorrSign
+	}
+	rx, ry := secp256k1.ScalarBaseMult(scalarBytes(k))
+	if ry.Bit(0) == 1 {
+		k.Sub(n, k)
+	}
+	r := scalarBytes(rx)
+	e := hashToScalar(taggedHash("BIP0340/challenge", r, pubKey, msg))
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k).Mod(s, n)
+	signature := append(r, scalarBytes(s)...)
+	if !SchnorrVerify(pubKey, msg, signature) {
+		return nil, ErrSchnorrSign
+	}
+	return signature, nil
+}
+
+// parseSchnorr returns the public key point, R.x, s and the challenge
+// of a signature, checking their ranges
+func parseSchnorr(pubKey, msg, signature []byte) (px, py, r, s, e *big.Int, ok bool) {
+	if len(pubKey) != SchnorrPubKeySize || len(signature) != SchnorrSignatureSize {
+		return nil, nil, nil, nil, nil, false
+	}
+	px, py = liftX(new(big.Int).SetBytes(pubKey))
+	if px == nil {
+		return nil, nil, nil, nil, nil, false
+	}
+	r = new(big.Int).SetBytes(signature[:32])
+	s = new(big.Int).SetBytes(signature[32:])
+	if r.Cmp(secp256k1.P) >= 0 || s.Cmp(secp256k1.N) >= 0 {
+		return nil, nil, nil, nil, nil, false
+	}
+	e = hashToScalar(taggedHash("BIP0340/challenge", signature[:32], pubKey, msg))
+	return px, py, r, s, e, true
+}
+
+// SchnorrVerify verifies the signature of the message with the x-only public key
+func SchnorrVerify(pubKey, msg, signature []byte) bool {
+	px, py, r, s, e, ok := parseSchnorr(pubKey, msg, signature)
+	if !ok {
+		return false
+	}
+	// R = s*G - e*P
+	sx, sy := secp256k1.ScalarBaseMult(scalarBytes(s))
+	ex, ey := secp256k1.ScalarMult(px, py, scalarBytes(e.Sub(secp256k1.N, e)))
+	rx, ry := secp256k1.Add(sx, sy, ex, ey)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return ry.Bit(0) == 0 && rx.Cmp(r) == 0
+}
+
+// SchnorrBatch collects Schnorr signatures to verify them at once
+type SchnorrBatch struct {
+	pubKeys, msgs, signatures [][]byte
+}
+
+// NewSchnorrBatch returns an empty batch
+func NewSchnorrBatch() *SchnorrBatch {
+	return &SchnorrBatch{}
+}
+
+// Add adds a signature to the batch, it returns false if the public
+// key or the signature is malformed
+func (b *SchnorrBatch) Add(pubKey, msg, signature []byte) bool {
+	if _, _, _, _, _, ok := parseSchnorr(pubKey, msg, signature); !ok {
+		return false
+	}
+	b.pubKeys = append(b.pubKeys, pubKey)
+	b.msgs = append(b.msgs, msg)
+	b.signatures = append(b.signatures, signature)
+	return true
+}
+
+// Len returns the number of signatures of the batch
+func (b *SchnorrBatch) Len() int {
+	return len(b.signatures)
+}
+
+// Verify verifies all the signatures of the batch, checking with random
+// weights a_i that (Σ a_i*s_i)*G = Σ a_i*R_i + Σ a_i*e_i*P_i. It fails
+// if any signature is invalid, without telling which one.
+func (b *SchnorrBatch) Verify() bool {
+	if b.Len() == 0 {
+		return true
+	}
+	n := secp256k1.N
+	sum := new(big.Int)
+	acc := jacobianPoint{}
+	for i := range b.signatures {
+		px, py, r, s, e, ok := parseSchnorr(b.pubKeys[i], b.msgs[i], b.signatures[i])
+		if !ok {
+			return false
+		}
+		rx, ry := liftX(r)
+		if rx == nil {
+			return false
+		}
+		a := big.NewInt(1)
+		if i > 0 {
+			var err error
+			if a, err = rand.Int(rand.Reader, new(big.Int).Sub(n, big.NewInt(1))); err != nil {
+				return false
+			}
+			a.Add(a, big.NewInt(1))
+		}
+		sum.Add(sum, new(big.Int).Mul(a, s)).Mod(sum, n)
+		ax, ay := secp256k1.ScalarMult(rx, ry, scalarBytes(a))
+		ae := new(big.Int).Mul(a, e)
+		aex, aey := secp256k1.ScalarMult(px, py, scalarBytes(ae.Mod(ae, n)))
+		acc = secp256k1.add(acc, secp256k1.add(secp256k1.toJacobian(ax, ay), secp256k1.toJacobian(aex, aey)))
+	}
+	lx, ly := secp256k1.ScalarBaseMult(scalarBytes(sum))
+	rx, ry := secp256k1.toAffine(acc)
+	return lx.Cmp(rx) == 0 && ly.Cmp(ry) == 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Signing test vectors 0 to 3 of BIP340
+var bip340Vectors = []struct {
+	secKey, pubKey, auxRand, msg, signature string
+}{
+	{
+		"0000000000000000000000000000000000000000000000000000000000000003",
+		"F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0",
+	},
+	{
+		"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+		"DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+		"6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A",
+	},
+	{
+		"C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9",
+		"DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		"C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906",
+		"7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C",
+		"5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7",
+	},
+	{
+		"0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710",
+		"25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		"7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3",
+	},
+}
+
+func TestBIP340SignVectors(t *testing.T) {
+	for i, v := range bip340Vectors {
+		privKey, err := privateKeyFromBytes(Hex2Bytes(v.secKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff(t, v.pubKey, strings.ToUpper(Bytes2Hex(SchnorrPubKey(privKey.PublicKey))), fmt.Sprintf("public key of vector %d", i))
+		signature, err := schnorrSign(privKey, Hex2Bytes(v.msg), Hex2Bytes(v.auxRand))
+		if err != nil {
+			t.Errorf("vector %d: %v", i, err)
+			continue
+		}
+		diff(t, v.signature, strings.ToUpper(Bytes2Hex(signature)), fmt.Sprintf("signature of vector %d", i))
+	}
+}
+
+func TestBIP340VerifyVectors(t *testing.T) {
+	const (
+		pubKey = "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659"
+		msg    = "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89"
+		sig    = "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A"
+		// the order of the curve and its field size
+		n = "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141"
+		p = "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F"
+	)
+	tests := []struct {
+		name                   string
+		pubKey, msg, signature string
+		want                   bool
+	}{
+		{"valid", pubKey, msg, sig, true},
+		// vector 4: R.x with leading zero bytes
+		{"vector 4", "D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9", "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703", "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4", true},
+		// vector 5: public key not on the curve
+		{"vector 5", "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34", msg, sig, false},
+		// vector 6: R has an odd y
+		{"vector 6", pubKey, msg, "FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2", false},
+		{"other message", pubKey, "00" + msg[2:], sig, false},
+		{"r is the field size", pubKey, msg, p + sig[64:], false},
+		{"s is the curve order", pubKey, msg, sig[:64] + n, false},
+		{"public key is the field size", p, msg, sig, false},
+		{"short signature", pubKey, msg, sig[:126], false},
+	}
+	for _, test := range tests {
+		if got := SchnorrVerify(Hex2Bytes(test.pubKey), Hex2Bytes(test.msg), Hex2Bytes(test.signature)); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSchnorrBatch(t *testing.T) {
+	batch := NewSchnorrBatch()
+	for _, v := range bip340Vectors {
+		if !batch.Add(Hex2Bytes(v.pubKey), Hex2Bytes(v.msg), Hex2Bytes(v.signature)) {
+			t.Fatalf("signature of %s rejected", v.pubKey)
+		}
+	}
+	if !batch.Verify() {
+		t.Error("valid batch rejected")
+	}
+	// a valid signature of another message
+	v := bip340Vectors[0]
+	batch.Add(Hex2Bytes(v.pubKey), Hex2Bytes(bip340Vectors[1].msg), Hex2Bytes(v.signature))
+	if batch.Verify() {
+		t.Error("batch with an invalid signature accepted")
+	}
+}
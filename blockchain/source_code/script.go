@@ -0,0 +1,827 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Script opcodes, using the same values as Bitcoin
+// https://en.bitcoin.it/wiki/Script
+const (
+	OP_0                   = 0x00
+	OP_PUSHDATA1           = 0x4c // the next byte contains the number of bytes to push
+	OP_PUSHDATA2           = 0x4d // the next 2 bytes contain the number of bytes to push
+	OP_1                   = 0x51
+	OP_16                  = 0x60
+	OP_IF                  = 0x63
+	OP_NOTIF               = 0x64
+	OP_ELSE                = 0x67
+	OP_ENDIF               = 0x68
+	OP_VERIFY              = 0x69
+	OP_RETURN              = 0x6a
+	OP_DROP                = 0x75
+	OP_DUP                 = 0x76
+	OP_SIZE                = 0x82
+	OP_EQUAL               = 0x87
+	OP_EQUALVERIFY         = 0x88
+	OP_SHA256              = 0xa8
+	OP_HASH160             = 0xa9
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	OP_CHECKSEQUENCEVERIFY = 0xb2
+)
+
+const (
+	maxScriptSize      = 10000
+	maxScriptElemSize  = 520
+	maxScriptStackSize = 1000
+	maxScriptNumSize   = 4
+	maxLockTimeNumSize = 5 // lock times use 5 bytes numbers to reach 2^32-1
+	maxMultisigKeys    = 16
+)
+
+// MaxDataCarrierSize is the maximum size of the data of a data carrier output
+const MaxDataCarrierSize = 80
+
+var (
+	ErrInvalidScript       = errors.New("invalid script")
+	ErrScriptFailed        = errors.New("script evaluated to false")
+	ErrStackUnderflow      = errors.New("script stack underflow")
+	ErrStackOverflow       = errors.New("script stack overflow")
+	ErrVerifyFailed        = errors.New("script verify failed")
+	ErrOpReturn            = errors.New("script executed OP_RETURN")
+	ErrUnknownOpcode       = errors.New("unknown opcode")
+	ErrNotPushOnly         = errors.New("unlocking script is not push only")
+	ErrInvalidScriptNum    = errors.New("invalid script number")
+	ErrInvalidMultisig     = errors.New("invalid multisig")
+	ErrUnsatisfiedLockTime = errors.New("unsatisfied lock time")
+	ErrUnbalancedIf        = errors.New("unbalanced conditional")
+)
+
+var opcodeNames = map[byte]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+}
+
+// Script is a sequence of opcodes and data pushes used to
+// lock (TXOutput) and unlock (TXInput) transaction outputs
+type Script []byte
+
+// scriptOp is a parsed script operation: an opcode and the data it pushes
+type scriptOp struct {
+	opcode byte
+	data   []byte
+}
+
+// isPush checks whether the operation only pushes data on the stack
+func (op scriptOp) isPush() bool {
+	return op.opcode <= OP_PUSHDATA2 || (op.opcode >= OP_1 && op.opcode <= OP_16)
+}
+
+// P2PKHScript returns the standard locking script paying to a public key hash:
+// OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func P2PKHScript(pubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// P2PKHUnlockingScript returns the script unlocking a P2PKH output: <signature> <pubKey>
+func P2PKHUnlockingScript(signature, pubKey []byte) Script {
+	return NewScriptBuilder().AddData(signature).AddData(pubKey).Script()
+}
+
+// P2WPKHScript returns the version 0 witness program of a public key hash:
+// OP_0 <pubKeyHash>. Without a separate witness, it is unlocked like a
+// P2PKH output, by <signature> <pubKey>.
+func P2WPKHScript(pubKeyHash []byte) Script {
+	return NewScriptBuilder().AddOp(OP_0).AddData(pubKeyHash).Script()
+}
+
+// P2SHScript returns the locking script paying to the hash of a redeem script:
+// OP_HASH160 <scriptHash> OP_EQUAL
+func P2SHScript(scriptHash []byte) Script {
+	return NewScriptBuilder().AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+}
+
+// MultisigScript returns the script requiring m signatures of the n public keys:
+// OP_m <pubKey1> ... <pubKeyn> OP_n OP_CHECKMULTISIG
+func MultisigScript(m int, pubKeys [][]byte) (Script, error) {
+	n := len(pubKeys)
+	if m < 1 || m > n || n > maxMultisigKeys {
+		return nil, ErrInvalidMultisig
+	}
+	b := NewScriptBuilder().AddSmallInt(m)
+	for _, pubKey := range pubKeys {
+		if len(pubKey) == SchnorrPubKeySize {
+			return nil, ErrInvalidMultisig
+		}
+		b.AddData(pubKey)
+	}
+	return b.AddSmallInt(n).AddOp(OP_CHECKMULTISIG).Script(), nil
+}
+
+// ScriptBuilder builds scripts, taking care of the data push encoding
+type ScriptBuilder struct {
+	script Script
+}
+
+// NewScriptBuilder creates an empty script builder
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{script: Script{}}
+}
+
+// AddOp appends an opcode to the script
+func (b *ScriptBuilder) AddOp(opcode byte) *ScriptBuilder {
+	b.script = append(b.script, opcode)
+	return b
+}
+
+// AddData appends a push of the given data to the script
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	length := len(data)
+	switch {
+	case length < OP_PUSHDATA1:
+		b.script = append(b.script, byte(length))
+	case length <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(length))
+	default:
+		lengthBytes := make([]byte, 2)
+		binary.LittleEndian.PutUint16(lengthBytes, uint16(length))
+		b.script = append(b.script, OP_PUSHDATA2)
+		b.script = append(b.script, lengthBytes...)
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt appends the push of the integer n as a script number
+func (b *ScriptBuilder) AddInt(n int64) *ScriptBuilder {
+	if n >= 0 && n <= 16 {
+		return b.AddSmallInt(int(n))
+	}
+	return b.AddData(encodeScriptNum(n))
+}
+
+// AddSmallInt appends the opcode pushing the integer n (0 <= n <= 16)
+func (b *ScriptBuilder) AddSmallInt(n int) *ScriptBuilder {
+	if n == 0 {
+		return b.AddOp(OP_0)
+	}
+	return b.AddOp(byte(OP_1 + n - 1))
+}
+
+// Script returns the built script
+func (b *ScriptBuilder) Script() Script {
+	return b.script
+}
+
+// parse splits the script into its operations
+func (s Script) parse() ([]scriptOp, error) {
+	if len(s) > maxScriptSize {
+		return nil, ErrInvalidScript
+	}
+	ops := []scriptOp{}
+	for i := 0; i < len(s); {
+		opcode := s[i]
+		i++
+		length := 0
+		switch {
+		case opcode < OP_PUSHDATA1:
+			length = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i+1 > len(s) {
+				return nil, ErrInvalidScript
+			}
+			length = int(s[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i+2 > len(s) {
+				return nil, ErrInvalidScript
+			}
+			length = int(binary.LittleEndian.Uint16(s[i : i+2]))
+			i += 2
+		}
+		if i+length > len(s) {
+			return nil, ErrInvalidScript
+		}
+		op := scriptOp{opcode: opcode}
+		if opcode <= OP_PUSHDATA2 {
+			op.data = s[i : i+length]
+		}
+		ops = append(ops, op)
+		i += length
+	}
+	return ops, nil
+}
+
+// IsPushOnly checks whether the script only pushes data on the stack
+func (s Script) IsPushOnly() bool {
+	ops, err := s.parse()
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !op.isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// PushedData returns the data pushed by the script operations, if the script is push only
+func (s Script) PushedData() ([][]byte, error) {
+	ops, err := s.parse()
+	if err != nil {
+		return nil, err
+	}
+	data := [][]byte{}
+	for _, op := range ops {
+		if !op.isPush() {
+			return nil, ErrNotPushOnly
+		}
+		data = append(data, pushValue(op))
+	}
+	return data, nil
+}
+
+// IsP2PKH checks whether the script is a standard pay to public key hash script
+func (s Script) IsP2PKH() bool {
+	ops, err := s.parse()
+	return err == nil && len(ops) == 5 &&
+		ops[0].opcode == OP_DUP &&
+		ops[1].opcode == OP_HASH160 &&
+		len(ops[2].data) == 20 && ops[2].opcode == 20 &&
+		ops[3].opcode == OP_EQUALVERIFY &&
+		ops[4].opcode == OP_CHECKSIG
+}
+
+// IsP2WPKH checks whether the script is a version 0 witness program of a public key hash
+func (s Script) IsP2WPKH() bool {
+	return len(s) == 22 && s[0] == OP_0 && s[1] == 20
+}
+
+// PubKeyHash returns the public key hash of a P2PKH or P2WPKH script, or nil
+func (s Script) PubKeyHash() []byte {
+	if s.IsP2WPKH() {
+		return s[2:22]
+	}
+	if !s.IsP2PKH() {
+		return nil
+	}
+	return s[3:23]
+}
+
+// IsP2SH checks whether the script is a pay to script hash script
+func (s Script) IsP2SH() bool {
+	return len(s) == 23 && s[0] == OP_HASH160 && s[1] == 20 && s[22] == OP_EQUAL
+}
+
+// ScriptHash returns the redeem script hash of a P2SH script, or nil
+func (s Script) ScriptHash() []byte {
+	if !s.IsP2SH() {
+		return nil
+	}
+	return s[2:22]
+}
+
+// TrailingPubKeyHash returns the public key hash of a script ending
+// like a P2PKH script (e.g. a timelocked P2PKH), or nil
+func (s Script) TrailingPubKeyHash() []byte {
+	if len(s) < 25 {
+		return nil
+	}
+	return s[len(s)-25:].PubKeyHash()
+}
+
+// Timelock returns the lock time opcode (OP_CHECKLOCKTIMEVERIFY or
+// OP_CHECKSEQUENCEVERIFY) and value of a script starting with
+// <lockTime> OP_CHECKLOCKTIMEVERIFY|OP_CHECKSEQUENCEVERIFY OP_DROP
+func (s Script) Timelock() (byte, int64, bool) {
+	ops, err := s.parse()
+	if err != nil || len(ops) < 3 || !ops[0].isPush() || ops[2].opcode != OP_DROP ||
+		(ops[1].opcode != OP_CHECKLOCKTIMEVERIFY && ops[1].opcode != OP_CHECKSEQUENCEVERIFY) {
+		return 0, 0, false
+	}
+	lockTime, err := scriptNumOfSize(pushValue(ops[0]), maxLockTimeNumSize)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ops[1].opcode, lockTime, true
+}
+
+// NullDataScript returns the provably unspendable script carrying data:
+// OP_RETURN <data>
+func NullDataScript(data []byte) Script {
+	return NewScriptBuilder().AddOp(OP_RETURN).AddData(data).Script()
+}
+
+// IsNullData checks whether the script is OP_RETURN followed by at most one push
+func (s Script) IsNullData() bool {
+	ops, err := s.parse()
+	if err != nil || len(ops) == 0 || len(ops) > 2 || ops[0].opcode != OP_RETURN {
+		return false
+	}
+	return len(ops) == 1 || ops[1].opcode <= OP_PUSHDATA2
+}
+
+// NullData returns the data carried by a null data script, or nil
+func (s Script) NullData() []byte {
+	if !s.IsNullData() {
+		return nil
+	}
+	ops, _ := s.parse()
+	if len(ops) == 1 {
+		return []byte{}
+	}
+	return ops[1].data
+}
+
+// ParseMultisig returns the number of required signatures and the public
+// keys of a multisig script
+func (s Script) ParseMultisig() (int, [][]byte, error) {
+	ops, err := s.parse()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(ops) < 4 || ops[len(ops)-1].opcode != OP_CHECKMULTISIG {
+		return 0, nil, ErrInvalidMultisig
+	}
+	m, n := smallInt(ops[0].opcode), smallInt(ops[len(ops)-2].opcode)
+	pubKeys := [][]byte{}
+	for _, op := range ops[1 : len(ops)-2] {
+		if op.opcode == OP_0 || op.opcode > OP_PUSHDATA2 {
+			return 0, nil, ErrInvalidMultisig
+		}
+		pubKeys = append(pubKeys, op.data)
+	}
+	if m < 1 || n != len(pubKeys) || m > n {
+		return 0, nil, ErrInvalidMultisig
+	}
+	return m, pubKeys, nil
+}
+
+// String returns a human-readable disassembly of the script
+func (s Script) String() string {
+	ops, err := s.parse()
+	if err != nil {
+		return fmt.Sprintf("[invalid script %x]", []byte(s))
+	}
+	var words []string
+	for _, op := range ops {
+		switch {
+		case op.opcode > OP_0 && op.opcode <= OP_PUSHDATA2:
+			words = append(words, fmt.Sprintf("%x", op.data))
+		case op.opcode >= OP_1 && op.opcode <= OP_16:
+			words = append(words, fmt.Sprintf("OP_%d", op.opcode-OP_1+1))
+		case opcodeNames[op.opcode] != "":
+			words = append(words, opcodeNames[op.opcode])
+		default:
+			words = append(words, fmt.Sprintf("OP_UNKNOWN_%x", op.opcode))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// SignatureChecker checks the signatures found by OP_CHECKSIG and the
+// lock times of OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY
+// against the transaction being verified
+type SignatureChecker interface {
+	CheckSig(signature, pubKey []byte) bool
+	CheckLockTime(lockTime int64) bool
+	CheckSequence(sequence int64) bool
+}
+
+// scriptStack is the data stack of the script interpreter
+type scriptStack [][]byte
+
+func (st *scriptStack) push(data []byte) error {
+	if len(*st) >= maxScriptStackSize {
+		return ErrStackOverflow
+	}
+	*st = append(*st, data)
+	return nil
+}
+
+func (st *scriptStack) pop() ([]byte, error) {
+	if len(*st) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	top := (*st)[len(*st)-1]
+	*st = (*st)[:len(*st)-1]
+	return top, nil
+}
+
+func (st *scriptStack) top() ([]byte, error) {
+	if len(*st) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	return (*st)[len(*st)-1], nil
+}
+
+// ExecuteScripts runs the unlocking script followed by the locking script
+// and succeeds if the top of the resulting stack is true
+func ExecuteScripts(scriptSig, scriptPubKey Script, checker SignatureChecker) error {
+	if !scriptSig.IsPushOnly() {
+		return ErrNotPushOnly
+	}
+	// a witness program of a public key hash runs as a P2PKH script
+	if scriptPubKey.IsP2WPKH() {
+		scriptPubKey = P2PKHScript(scriptPubKey.PubKeyHash())
+	}
+	stack := scriptStack{}
+	if err := stack.execute(scriptSig, checker); err != nil {
+		return err
+	}
+	// keep the stack with the redeem script of a P2SH output
+	p2shStack := append(scriptStack{}, stack...)
+	if err := stack.execute(scriptPubKey, checker); err != nil {
+		return err
+	}
+	if err := stack.checkResult(); err != nil {
+		return err
+	}
+	if !scriptPubKey.IsP2SH() {
+		return nil
+	}
+	// the hash of the redeem script matches, run the redeem script
+	redeemScript, err := p2shStack.pop()
+	if err != nil {
+		return err
+	}
+	if err := p2shStack.execute(Script(redeemScript), checker); err != nil {
+		return err
+	}
+	return p2shStack.checkResult()
+}
+
+// checkResult checks that the script execution left true on the stack
+func (st *scriptStack) checkResult() error {
+	top, err := st.top()
+	if err != nil || !castToBool(top) {
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// execute runs the script operations on the stack
+func (st *scriptStack) execute(script Script, checker SignatureChecker) error {
+	ops, err := script.parse()
+	if err != nil {
+		return err
+	}
+	// conditions of the enclosing OP_IF/OP_NOTIF branches
+	conds := []bool{}
+	for _, op := range ops {
+		executing := true
+		for _, cond := range conds {
+			executing = executing && cond
+		}
+		switch op.opcode {
+		case OP_IF, OP_NOTIF:
+			cond := false
+			if executing {
+				data, err := st.pop()
+				if err != nil {
+					return err
+				}
+				cond = castToBool(data) == (op.opcode == OP_IF)
+			}
+			conds = append(conds, cond)
+			continue
+		case OP_ELSE:
+			if len(conds) == 0 {
+				return ErrUnbalancedIf
+			}
+			conds[len(conds)-1] = !conds[len(conds)-1]
+			continue
+		case OP_ENDIF:
+			if len(conds) == 0 {
+				return ErrUnbalancedIf
+			}
+			conds = conds[:len(conds)-1]
+			continue
+		}
+		if !executing {
+			continue
+		}
+		if op.isPush() {
+			if len(op.data) > maxScriptElemSize {
+				return ErrInvalidScript
+			}
+			if err := st.push(pushValue(op)); err != nil {
+				return err
+			}
+			continue
+		}
+		switch op.opcode {
+		case OP_VERIFY:
+			if err := st.verify(); err != nil {
+				return err
+			}
+		case OP_RETURN:
+			return ErrOpReturn
+		case OP_DROP:
+			if _, err := st.pop(); err != nil {
+				return err
+			}
+		case OP_DUP:
+			top, err := st.top()
+			if err != nil {
+				return err
+			}
+			if err := st.push(top); err != nil {
+				return err
+			}
+		case OP_SIZE:
+			top, err := st.top()
+			if err != nil {
+				return err
+			}
+			if err := st.push(encodeScriptNum(int64(len(top)))); err != nil {
+				return err
+			}
+		case OP_EQUAL, OP_EQUALVERIFY:
+			a, err := st.pop()
+			if err != nil {
+				return err
+			}
+			b, err := st.pop()
+			if err != nil {
+				return err
+			}
+			if err := st.push(boolToStack(bytes.Equal(a, b))); err != nil {
+				return err
+			}
+			if op.opcode == OP_EQUALVERIFY {
+				if err := st.verify(); err != nil {
+					return err
+				}
+			}
+		case OP_SHA256:
+			data, err := st.pop()
+			if err != nil {
+				return err
+			}
+			hash := sha256.Sum256(data)
+			if err := st.push(hash[:]); err != nil {
+				return err
+			}
+		case OP_HASH160:
+			data, err := st.pop()
+			if err != nil {
+				return err
+			}
+			if err := st.push(HashPubKey(data)); err != nil {
+				return err
+			}
+		case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+			pubKey, err := st.pop()
+			if err != nil {
+				return err
+			}
+			signature, err := st.pop()
+			if err != nil {
+				return err
+			}
+			if err := st.push(boolToStack(checker.CheckSig(signature, pubKey))); err != nil {
+				return err
+			}
+			if op.opcode == OP_CHECKSIGVERIFY {
+				if err := st.verify(); err != nil {
+					return err
+				}
+			}
+		case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+			if err := st.checkMultisig(checker); err != nil {
+				return err
+			}
+			if op.opcode == OP_CHECKMULTISIGVERIFY {
+				if err := st.verify(); err != nil {
+					return err
+				}
+			}
+		case OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY:
+			// the lock time is left on the stack, usually dropped by OP_DROP
+			top, err := st.top()
+			if err != nil {
+				return err
+			}
+			lockTime, err := scriptNumOfSize(top, maxLockTimeNumSize)
+			if err != nil {
+				return err
+			}
+			if lockTime < 0 {
+				return ErrUnsatisfiedLockTime
+			}
+			if op.opcode == OP_CHECKLOCKTIMEVERIFY && !checker.CheckLockTime(lockTime) {
+				return ErrUnsatisfiedLockTime
+			}
+			if op.opcode == OP_CHECKSEQUENCEVERIFY && !checker.CheckSequence(lockTime) {
+				return ErrUnsatisfiedLockTime
+			}
+		default:
+			return ErrUnknownOpcode
+		}
+	}
+	if len(conds) != 0 {
+		return ErrUnbalancedIf
+	}
+	return nil
+}
+
+// popInt pops a script number from the stack
+func (st *scriptStack) popInt() (int64, error) {
+	data, err := st.pop()
+	if err != nil {
+		return 0, err
+	}
+	return scriptNum(data)
+}
+
+// checkMultisig pops <dummy> <sig1> ... <sigm> m <pubKey1> ... <pubKeyn> n
+// and pushes whether the m signatures match m of the public keys, in order.
+// The dummy element is an artifact of the Bitcoin implementation, kept
+// for the unlocking scripts to look the same.
+func (st *scriptStack) checkMultisig(checker SignatureChecker) error {
+	n, err := st.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > maxMultisigKeys {
+		return ErrInvalidMultisig
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = st.pop(); err != nil {
+			return err
+		}
+		// M-of-M Schnorr keys are aggregated with MuSig instead
+		if len(pubKeys[i]) == SchnorrPubKeySize {
+			return ErrInvalidMultisig
+		}
+	}
+	m, err := st.popInt()
+	if err != nil {
+		return err
+	}
+	if m < 0 || m > n {
+		return ErrInvalidMultisig
+	}
+	signatures := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if signatures[i], err = st.pop(); err != nil {
+			return err
+		}
+	}
+	if _, err := st.pop(); err != nil {
+		return err
+	}
+	// each signature must match one of the remaining public keys
+	success := true
+	key := 0
+	for _, signature := range signatures {
+		for key < len(pubKeys) && !checker.CheckSig(signature, pubKeys[key]) {
+			key++
+		}
+		if key == len(pubKeys) {
+			success = false
+			break
+		}
+		key++
+	}
+	return st.push(boolToStack(success))
+}
+
+// verify pops the top of the stack and fails if it is false
+func (st *scriptStack) verify() error {
+	top, err := st.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(top) {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+// pushValue returns the value pushed on the stack by a push operation
+func pushValue(op scriptOp) []byte {
+	if op.opcode >= OP_1 && op.opcode <= OP_16 {
+		return []byte{op.opcode - OP_1 + 1}
+	}
+	return op.data
+}
+
+// smallInt returns the integer pushed by OP_0 and OP_1 to OP_16, or -1
+func smallInt(opcode byte) int {
+	if opcode == OP_0 {
+		return 0
+	}
+	if opcode >= OP_1 && opcode <= OP_16 {
+		return int(opcode - OP_1 + 1)
+	}
+	return -1
+}
+
+// scriptNum decodes a number of the stack, encoded in little endian
+// with the sign in the most significant bit
+func scriptNum(data []byte) (int64, error) {
+	return scriptNumOfSize(data, maxScriptNumSize)
+}
+
+// scriptNumOfSize decodes a number of at most size bytes
+func scriptNumOfSize(data []byte, size int) (int64, error) {
+	if len(data) > size {
+		return 0, ErrInvalidScriptNum
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << uint(8*i)
+	}
+	// negative number
+	if data[len(data)-1]&0x80 != 0 {
+		n &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		return -n, nil
+	}
+	return n, nil
+}
+
+// encodeScriptNum encodes a number as scriptNum decodes it
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	data := []byte{}
+	for n > 0 {
+		data = append(data, byte(n&0xff))
+		n >>= 8
+	}
+	// add a byte for the sign if the most significant bit is used
+	if data[len(data)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		data = append(data, extra)
+	} else if negative {
+		data[len(data)-1] |= 0x80
+	}
+	return data
+}
+
+// castToBool interprets stack data as a boolean: false is
+// an empty array, zeros or negative zero
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			// negative zero
+			if i == len(data)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func boolToStack(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+// testChecker accepts the signatures made by testSig and the lock times
+// up to its own
+type testChecker struct {
+	lockTime, sequence int64
+}
+
+// testSig returns the signature of the public key accepted by testChecker
+func testSig(pubKey []byte) []byte {
+	sig := sha256.Sum256(pubKey)
+	return sig[:]
+}
+
+func (c testChecker) CheckSig(signature, pubKey []byte) bool {
+	return bytes.Equal(signature, testSig(pubKey))
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool {
+	return lockTime <= c.lockTime
+}
+
+func (c testChecker) CheckSequence(sequence int64) bool {
+	return sequence <= c.sequence
+}
+
+func TestExecuteScripts(t *testing.T) {
+	pubKeys := [][]byte{bytes.Repeat([]byte{2}, 33), bytes.Repeat([]byte{3}, 33), bytes.Repeat([]byte{4}, 33)}
+	pubKey := pubKeys[0]
+	p2pkh := P2PKHScript(HashPubKey(pubKey))
+	multisig, err := MultisigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	secretHash := sha256.Sum256(secret)
+	hashLock := NewScriptBuilder().AddOp(OP_SHA256).AddData(secretHash[:]).AddOp(OP_EQUAL).Script()
+	// OP_IF OP_2 OP_ELSE OP_3 OP_ENDIF OP_3 OP_EQUAL
+	branches := NewScriptBuilder().AddOp(OP_IF).AddInt(2).AddOp(OP_ELSE).AddInt(3).AddOp(OP_ENDIF).AddInt(3).AddOp(OP_EQUAL).Script()
+	cltv := append(NewScriptBuilder().AddInt(100).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).Script(), p2pkh...)
+	csv := append(NewScriptBuilder().AddInt(10).AddOp(OP_CHECKSEQUENCEVERIFY).AddOp(OP_DROP).Script(), p2pkh...)
+	redeem := NewScriptBuilder().AddInt(1).Script()
+	p2sh := P2SHScript(HashPubKey(redeem))
+	unlock := P2PKHUnlockingScript(testSig(pubKey), pubKey)
+	checker := testChecker{lockTime: 100, sequence: 10}
+
+	tests := []struct {
+		name         string
+		scriptSig    Script
+		scriptPubKey Script
+		checker      testChecker
+		want         error
+	}{
+		{"p2pkh", unlock, p2pkh, checker, nil},
+		{"p2pkh wrong signature", P2PKHUnlockingScript(testSig(pubKeys[1]), pubKey), p2pkh, checker, ErrScriptFailed},
+		{"p2pkh wrong key", P2PKHUnlockingScript(testSig(pubKeys[1]), pubKeys[1]), p2pkh, checker, ErrVerifyFailed},
+		{"p2wpkh", unlock, P2WPKHScript(HashPubKey(pubKey)), checker, nil},
+		{"p2pkh without key", NewScriptBuilder().AddData(testSig(pubKey)).Script(), p2pkh, checker, ErrVerifyFailed},
+		{"multisig", NewScriptBuilder().AddOp(OP_0).AddData(testSig(pubKeys[0])).AddData(testSig(pubKeys[2])).Script(), multisig, checker, nil},
+		{"multisig out of order", NewScriptBuilder().AddOp(OP_0).AddData(testSig(pubKeys[2])).AddData(testSig(pubKeys[0])).Script(), multisig, checker, ErrScriptFailed},
+		{"multisig same key twice", NewScriptBuilder().AddOp(OP_0).AddData(testSig(pubKeys[1])).AddData(testSig(pubKeys[1])).Script(), multisig, checker, ErrScriptFailed},
+		{"hash lock", NewScriptBuilder().AddData(secret).Script(), hashLock, checker, nil},
+		{"hash lock wrong secret", NewScriptBuilder().AddData([]byte("guess")).Script(), hashLock, checker, ErrScriptFailed},
+		{"if branch", NewScriptBuilder().AddInt(1).Script(), branches, checker, ErrScriptFailed},
+		{"else branch", NewScriptBuilder().AddInt(0).Script(), branches, checker, nil},
+		{"unbalanced if", nil, Script{OP_1, OP_IF, OP_1}, checker, ErrUnbalancedIf},
+		{"cltv", unlock, cltv, checker, nil},
+		{"cltv locked", unlock, cltv, testChecker{lockTime: 99, sequence: 10}, ErrUnsatisfiedLockTime},
+		{"csv", unlock, csv, checker, nil},
+		{"csv locked", unlock, csv, testChecker{lockTime: 100, sequence: 9}, ErrUnsatisfiedLockTime},
+		{"p2sh", NewScriptBuilder().AddData(redeem).Script(), p2sh, checker, nil},
+		{"p2sh wrong redeem script", NewScriptBuilder().AddData(Script{OP_1, OP_1}).Script(), p2sh, checker, ErrScriptFailed},
+		{"p2sh failing redeem script", NewScriptBuilder().AddData(Script{OP_0}).Script(), P2SHScript(HashPubKey(Script{OP_0})), checker, ErrScriptFailed},
+		{"op_return", nil, NullDataScript([]byte("data")), checker, ErrOpReturn},
+		{"not push only", Script{OP_1, OP_DUP}, Script{OP_1}, checker, ErrNotPushOnly},
+		{"unknown opcode", nil, Script{0xff}, checker, ErrUnknownOpcode},
+		{"truncated push", nil, Script{0x05, 1, 2}, checker, ErrInvalidScript},
+		{"empty stack", nil, Script{OP_DUP}, checker, ErrStackUnderflow},
+	}
+	for _, test := range tests {
+		if err := ExecuteScripts(test.scriptSig, test.scriptPubKey, test.checker); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestScriptNum(t *testing.T) {
+	tests := []struct {
+		n    int64
+		data string
+	}{
+		{0, ""},
+		{1, "01"},
+		{-1, "81"},
+		{127, "7f"},
+		{128, "8000"},
+		{-128, "8080"},
+		{255, "ff00"},
+		{256, "0001"},
+		{-32768, "008080"},
+		{500000000, "0065cd1d"},
+		{0xffffffff, "ffffffff00"},
+	}
+	for _, test := range tests {
+		diff(t, test.data, Bytes2Hex(encodeScriptNum(test.n)), "encoding")
+		n, err := scriptNumOfSize(Hex2Bytes(test.data), maxLockTimeNumSize)
+		if err != nil {
+			t.Errorf("%d: %v", test.n, err)
+		}
+		diff(t, test.n, n, "decoding of "+test.data)
+	}
+	if _, err := scriptNum(Hex2Bytes("ffffffff00")); err != ErrInvalidScriptNum {
+		t.Errorf("5-byte number: got %v, want %v", err, ErrInvalidScriptNum)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"math/big"
+
+	secp "github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// The secp256k1 arithmetic is the one of the dcrd secp256k1 package, also
+// used by btcd, on fixed size field elements. Its KoblitzCurve implements
+// elliptic.Curve for the HD keys, and the ECDSA keys are generated and
+// signed with it instead of the generic curves of crypto/ecdsa.
+
+// koblitzCurve adds the operations on Jacobian points of the Schnorr
+// batch verification and MuSig to secp256k1
+type koblitzCurve struct {
+	*secp.KoblitzCurve
+}
+
+var secp256k1 = koblitzCurve{secp.S256()}
+
+// S256 returns the secp256k1 curve
+func S256() elliptic.Curve {
+	return secp.S256()
+}
+
+// jacobianPoint is a point (x/z², y/z³), z = 0 being the point at infinity
+type jacobianPoint = secp.JacobianPoint
+
+// fieldVal returns the field element of an integer below the field prime
+func fieldVal(v *big.Int) secp.FieldVal {
+	var f secp.FieldVal
+	f.SetByteSlice(v.Bytes())
+	return f
+}
+
+// fieldInt returns the integer of a field element
+func fieldInt(f *secp.FieldVal) *big.Int {
+	f.Normalize()
+	return new(big.Int).SetBytes(f.Bytes()[:])
+}
+
+func (c koblitzCurve) toJacobian(x, y *big.Int) jacobianPoint {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return jacobianPoint{}
+	}
+	fx, fy := fieldVal(x), fieldVal(y)
+	var one secp.FieldVal
+	one.SetInt(1)
+	return secp.MakeJacobianPoint(&fx, &fy, &one)
+}
+
+func (c koblitzCurve) toAffine(p jacobianPoint) (*big.Int, *big.Int) {
+	if p.Z.IsZero() {
+		return new(big.Int), new(big.Int)
+	}
+	p.ToAffine()
+	return fieldInt(&p.X), fieldInt(&p.Y)
+}
+
+// add adds the points
+func (c koblitzCurve) add(p, q jacobianPoint) jacobianPoint {
+	var sum jacobianPoint
+	secp.AddNonConst(&p, &q, &sum)
+	return sum
+}
+
+// decompress returns the point of the x coordinate with the parity of y
+func (c koblitzCurve) decompress(x *big.Int, odd bool) (*big.Int, *big.Int) {
+	if x.Sign() < 0 || x.Cmp(c.P) >= 0 {
+		return nil, nil
+	}
+	fx := fieldVal(x)
+	var fy secp.FieldVal
+	if !secp.DecompressY(&fx, odd, &fy) {
+		return nil, nil
+	}
+	return new(big.Int).Set(x), fieldInt(&fy)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestSecp256k1(t *testing.T) {
+	curve := S256()
+	params := curve.Params()
+	if !curve.IsOnCurve(params.Gx, params.Gy) {
+		t.Fatal("generator not on the curve")
+	}
+	if curve.IsOnCurve(params.Gx, new(big.Int).Add(params.Gy, big.NewInt(1))) {
+		t.Error("point off the curve accepted")
+	}
+	// public keys of the private keys 1, 2 and 3
+	tests := []struct {
+		privKey int64
+		pubKey  string
+	}{
+		{1, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{2, "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"},
+		{3, "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"},
+	}
+	for _, test := range tests {
+		x, y := curve.ScalarBaseMult(big.NewInt(test.privKey).Bytes())
+		diff(t, test.pubKey, hex.EncodeToString(marshalPubKey(curve, x, y, true)), "public key")
+		// the generator added to itself
+		if test.privKey == 2 {
+			dx, dy := curve.Double(params.Gx, params.Gy)
+			ax, ay := curve.Add(params.Gx, params.Gy, params.Gx, params.Gy)
+			if dx.Cmp(x) != 0 || dy.Cmp(y) != 0 || ax.Cmp(x) != 0 || ay.Cmp(y) != 0 {
+				t.Error("2G differs from G+G")
+			}
+		}
+	}
+	// the order of the generator
+	if x, y := curve.ScalarBaseMult(params.N.Bytes()); x.Sign() != 0 || y.Sign() != 0 {
+		t.Error("nG is not the point at infinity")
+	}
+}
+
+func TestParsePubKey(t *testing.T) {
+	_, pubKey := newKeyPair()
+	if len(pubKey) != 33 {
+		t.Fatalf("public key size: got %d, want 33", len(pubKey))
+	}
+	parsed, err := ParsePubKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pubKeyToByte(*parsed), pubKey) {
+		t.Error("public key changed by parsing")
+	}
+	uncompressed := marshalPubKey(parsed.Curve, parsed.X, parsed.Y, false)
+	if parsed, err := ParsePubKey(uncompressed); err != nil || !bytes.Equal(pubKeyToByte(*parsed), pubKey) {
+		t.Errorf("uncompressed public key: %v", err)
+	}
+	invalid := [][]byte{
+		nil,
+		pubKey[:32],
+		append([]byte{0x05}, pubKey[1:]...),
+		append(append([]byte{}, uncompressed[:64]...), uncompressed[64]^1),
+		// x = p is not a coordinate
+		append([]byte{0x02}, S256().Params().P.Bytes()...),
+	}
+	for _, data := range invalid {
+		if _, err := ParsePubKey(data); err != ErrInvalidPubKey {
+			t.Errorf("%x: got %v, want %v", data, err, ErrInvalidPubKey)
+		}
+	}
+}
+
+func TestSignDigest(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	digest := sha256.Sum256([]byte("payload"))
+	signature, err := signDigest(privKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature[0] != 0x30 {
+		t.Fatalf("signature not DER encoded: %x", signature)
+	}
+	if !verifySignature(pubKey, digest[:], signature) {
+		t.Fatal("signature rejected")
+	}
+	r, s, err := decodeSignature(S256(), signature, SigEncodingDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := S256().Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		t.Error("S in the upper half of the curve order")
+	}
+	highS, _ := encodeSignature(S256(), r, new(big.Int).Sub(n, s), SigEncodingDER)
+	if verifySignature(pubKey, digest[:], highS) {
+		t.Error("signature with S in the upper half accepted")
+	}
+	otherDigest := sha256.Sum256([]byte("other payload"))
+	if verifySignature(pubKey, otherDigest[:], signature) {
+		t.Error("signature of another digest accepted")
+	}
+	_, otherPubKey := newKeyPair()
+	if verifySignature(otherPubKey, digest[:], signature) {
+		t.Error("signature of another key accepted")
+	}
+	if verifySignature(pubKey, digest[:], append(append([]byte{}, signature...), 0)) {
+		t.Error("signature with trailing bytes accepted")
+	}
+	fixed, _ := encodeSignature(S256(), r, s, SigEncodingFixed)
+	if verifySignature(pubKey, digest[:], fixed) {
+		t.Error("fixed size signature accepted")
+	}
+}
+
+func TestP256KeyParams(t *testing.T) {
+	SetKeyParams(P256KeyParams)
+	defer SetKeyParams(Secp256k1KeyParams)
+	privKey, pubKey := newKeyPair()
+	if len(pubKey) != 65 {
+		t.Fatalf("public key size: got %d, want 65", len(pubKey))
+	}
+	digest := sha256.Sum256([]byte("payload"))
+	signature, err := signDigest(privKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != 64 {
+		t.Fatalf("signature size: got %d, want 64", len(signature))
+	}
+	if !verifySignature(pubKey, digest[:], signature) {
+		t.Error("signature rejected")
+	}
+	// the master key of the test vector 1 of SLIP-0010
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	masterKey, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", hex.EncodeToString(masterKey.Key), "master key")
+}
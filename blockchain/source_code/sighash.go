@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+)
+
+// SigHashType selects which parts of the transaction an input signature commits to.
+// It is appended as the last byte of the signature.
+type SigHashType byte
+
+const (
+	SigHashAll          SigHashType = 0x01 // sign all the inputs and outputs
+	SigHashNone         SigHashType = 0x02 // sign all the inputs but none of the outputs
+	SigHashSingle       SigHashType = 0x03 // sign all the inputs and the output with the same index
+	SigHashAnyOneCanPay SigHashType = 0x80 // combined with the above, sign only the own input
+
+	sigHashMask = 0x1f
+)
+
+var (
+	ErrInvalidSigHashType = errors.New("invalid sighash type")
+	ErrSigHashSingle      = errors.New("sighash single without output of the same index")
+)
+
+// sigHashPreimage is the data hashed to sign an input
+type sigHashPreimage struct {
+	Tx         Transaction // trimmed copy of the transaction
+	InputIndex int         // index of the signed input
+	PrevValue  int         // value of the spent output
+	PrevScript Script      // locking script of the spent output
+	HashType   SigHashType
+}
+
+// IsValid checks whether the sighash type is known
+func (t SigHashType) IsValid() bool {
+	base := t & sigHashMask
+	return t&^(sigHashMask|SigHashAnyOneCanPay) == 0 && base >= SigHashAll && base <= SigHashSingle
+}
+
+// SignatureHash returns the digest signed by the input idx spending prevOut.
+// The digest commits to the spent output (value and locking script), to the
+// input index and, depending on the sighash type, to the other inputs and outputs.
+func (tx *Transaction) SignatureHash(idx int, prevOut *TXOutput, hashType SigHashType) ([]byte, error) {
+	if idx < 0 || idx >= len(tx.Vin) {
+		return nil, ErrTxInputNotFound
+	}
+	if !hashType.IsValid() {
+		return nil, ErrInvalidSigHashType
+	}
+	txCopy := tx.TrimmedCopy()
+	txCopy.ID = nil
+	// ANYONECANPAY: the other inputs can be added or removed
+	if hashType&SigHashAnyOneCanPay != 0 {
+		txCopy.Vin = []TXInput{txCopy.Vin[idx]}
+	}
+	switch hashType & sigHashMask {
+	case SigHashNone:
+		txCopy.Vout = []TXOutput{}
+		txCopy.zeroOtherSequences(idx, hashType)
+	case SigHashSingle:
+		if idx >= len(tx.Vout) {
+			return nil, ErrSigHashSingle
+		}
+		txCopy.Vout = []TXOutput{tx.Vout[idx]}
+		txCopy.zeroOtherSequences(idx, hashType)
+	}
+	preimage := sigHashPreimage{
+		Tx:         txCopy,
+		InputIndex: idx,
+		PrevValue:  prevOut.Value,
+		PrevScript: prevOut.LockingScript(),
+		HashType:   hashType,
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(preimage); err != nil {
+		return nil, err
+	}
+	// double sha256, as the address checksum
+	first := sha256.Sum256(buf.Bytes())
+	digest := sha256.Sum256(first[:])
+	return digest[:], nil
+}
+
+// zeroOtherSequences lets the other inputs update their sequence
+// when they are still part of the signature hash
+func (tx *Transaction) zeroOtherSequences(idx int, hashType SigHashType) {
+	if hashType&SigHashAnyOneCanPay != 0 {
+		return
+	}
+	for i := range tx.Vin {
+		if i != idx {
+			tx.Vin[i].Sequence = 0
+		}
+	}
+}
+
+// txSigChecker checks the signatures of the script interpreter
+// against the signature hash of a transaction input
+type txSigChecker struct {
+	tx      *Transaction
+	idx     int
+	prevOut *TXOutput
+	batch   *SchnorrBatch // Schnorr signatures verified later, if set
+}
+
+// CheckSig verifies the signature, whose last byte is the sighash type,
+// of the input with the public key
+func (c txSigChecker) CheckSig(signature, pubKey []byte) bool {
+	if len(signature) == 0 {
+		return false
+	}
+	hashType := SigHashType(signature[len(signature)-1])
+	digest, err := c.tx.SignatureHash(c.idx, c.prevOut, hashType)
+	if err != nil {
+		return false
+	}
+	signature = signature[:len(signature)-1]
+	// a well-formed Schnorr signature added to the batch is assumed to be
+	// valid, the whole batch being verified once all the scripts are run
+	if c.batch != nil && len(pubKey) == SchnorrPubKeySize && schnorrEnabled() {
+		return c.batch.Add(pubKey, digest, signature)
+	}
+	return verifySignature(pubKey, digest, signature)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignatureHash(t *testing.T) {
+	address := GetStringAddress(GetAddress(bytes.Repeat([]byte{2}, 33)))
+	prevOut := NewTXOutput(10, address)
+	newTx := func() *Transaction {
+		return &Transaction{
+			Vin: []TXInput{
+				{Txid: []byte{1}, OutIdx: 0, Sequence: SequenceFinal},
+				{Txid: []byte{2}, OutIdx: 1, Sequence: SequenceFinal},
+			},
+			Vout: []TXOutput{*NewTXOutput(4, address), *NewTXOutput(5, address)},
+		}
+	}
+	changes := map[string]func(*Transaction){
+		"own output":        func(tx *Transaction) { tx.Vout[0].Value++ },
+		"other output":      func(tx *Transaction) { tx.Vout[1].Value++ },
+		"added output":      func(tx *Transaction) { tx.Vout = append(tx.Vout, tx.Vout[0]) },
+		"other input":       func(tx *Transaction) { tx.Vin[1].OutIdx++ },
+		"other sequence":    func(tx *Transaction) { tx.Vin[1].Sequence-- },
+		"added input":       func(tx *Transaction) { tx.Vin = append(tx.Vin, TXInput{Txid: []byte{3}}) },
+		"own sequence":      func(tx *Transaction) { tx.Vin[0].Sequence-- },
+		"lock time":         func(tx *Transaction) { tx.LockTime++ },
+		"own unlock script": func(tx *Transaction) { tx.Vin[0].ScriptSig = Script{OP_1} },
+	}
+	// the changes of the transaction keeping the signature of the input 0 valid
+	tests := []struct {
+		hashType  SigHashType
+		unchanged []string
+	}{
+		{SigHashAll, []string{"own unlock script"}},
+		{SigHashNone, []string{"own unlock script", "own output", "other output", "added output", "other sequence"}},
+		{SigHashSingle, []string{"own unlock script", "other output", "added output", "other sequence"}},
+		{SigHashAll | SigHashAnyOneCanPay, []string{"own unlock script", "other input", "other sequence", "added input"}},
+		{SigHashNone | SigHashAnyOneCanPay, []string{"own unlock script", "own output", "other output", "added output", "other input", "other sequence", "added input"}},
+		{SigHashSingle | SigHashAnyOneCanPay, []string{"own unlock script", "other output", "added output", "other input", "other sequence", "added input"}},
+	}
+	for _, test := range tests {
+		digest, err := newTx().SignatureHash(0, prevOut, test.hashType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, change := range changes {
+			tx := newTx()
+			change(tx)
+			changed, err := tx.SignatureHash(0, prevOut, test.hashType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := false
+			for _, unchanged := range test.unchanged {
+				want = want || unchanged == name
+			}
+			if bytes.Equal(digest, changed) != want {
+				t.Errorf("sighash %#x: digest unchanged by %s: got %v, want %v", test.hashType, name, !want, want)
+			}
+		}
+		// the spent output is always signed
+		otherOut := *prevOut
+		otherOut.Value++
+		if changed, _ := newTx().SignatureHash(0, &otherOut, test.hashType); bytes.Equal(digest, changed) {
+			t.Errorf("sighash %#x: digest unchanged by the value of the spent output", test.hashType)
+		}
+	}
+
+	for _, hashType := range []SigHashType{0, 4, 0x21, 0x41, 0x84} {
+		if _, err := newTx().SignatureHash(0, prevOut, hashType); err != ErrInvalidSigHashType {
+			t.Errorf("sighash %#x: got %v, want %v", hashType, err, ErrInvalidSigHashType)
+		}
+	}
+	tx := newTx()
+	tx.Vout = tx.Vout[:1]
+	if _, err := tx.SignatureHash(1, prevOut, SigHashSingle); err != ErrSigHashSingle {
+		t.Errorf("sighash single: got %v, want %v", err, ErrSigHashSingle)
+	}
+	if _, err := tx.SignatureHash(2, prevOut, SigHashAll); err != ErrTxInputNotFound {
+		t.Errorf("input out of range: got %v, want %v", err, ErrTxInputNotFound)
+	}
+}
+
+func TestSignAnyOneCanPay(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	otherPrivKey, otherPubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	otherCoinbaseTX := mineTestBlock(t, bc, otherPubKey).Transactions[0]
+	to := GetStringAddress(GetAddress(pubKey))
+	value := coinbaseTX.Vout[0].Value + otherCoinbaseTX.Vout[0].Value
+
+	// the first contributor signs its input and the output only
+	tx := &Transaction{
+		Vin:  []TXInput{{Txid: coinbaseTX.ID, OutIdx: 0, PubKey: pubKey, Sequence: SequenceFinal}},
+		Vout: []TXOutput{*NewTXOutput(value, to)},
+	}
+	if err := tx.SignInput(0, privKey, &coinbaseTX.Vout[0], SigHashAll|SigHashAnyOneCanPay); err != nil {
+		t.Fatal(err)
+	}
+	// the second one adds its input
+	tx.Vin = append(tx.Vin, TXInput{Txid: otherCoinbaseTX.ID, OutIdx: 0, PubKey: otherPubKey, Sequence: SequenceFinal})
+	if err := tx.SignInput(1, otherPrivKey, &otherCoinbaseTX.Vout[0], SigHashAll); err != nil {
+		t.Fatal(err)
+	}
+	tx.ID = tx.Hash()
+	if !bc.VerifyTransaction(tx) {
+		t.Error("transaction completed by another input rejected")
+	}
+	// the output signed by both cannot change
+	tx.Vout[0].Value--
+	tx.ID = tx.Hash()
+	if bc.VerifyTransaction(tx) {
+		t.Error("transaction with a changed output accepted")
+	}
+}
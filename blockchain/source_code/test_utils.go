@@ -51,9 +51,9 @@ func removeTXInputSignature(tx *Transaction) {
 	var inputs []TXInput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.OutIdx, nil, vin.PubKey})
+		inputs = append(inputs, TXInput{Txid: vin.Txid, OutIdx: vin.OutIdx, PubKey: vin.PubKey})
 	}
-	*tx = Transaction{tx.ID, inputs, tx.Vout}
+	*tx = Transaction{ID: tx.ID, Vin: inputs, Vout: tx.Vout}
 }
 
 // Transactions example flow:
@@ -76,12 +76,12 @@ var testTransactions = map[string]*Transaction{
 				Txid:      nil,
 				OutIdx:    -1,
 				Signature: nil,
-				PubKey:    []byte(GenesisCoinbaseData),
+				PubKey:    []byte(MainnetParams.GenesisCoinbaseData),
 			},
 		},
 		Vout: []TXOutput{
 			{
-				Value:      BlockReward,
+				Value:      MainnetParams.BaseSubsidy,
 				PubKeyHash: Hex2Bytes("2b02ea4c157844ec0b034fdde3379726ea228b38"),
 			},
 		},
@@ -212,7 +212,7 @@ func newMockCoinbaseTX(to, data, txID string) *Transaction {
 		},
 		Vout: []TXOutput{
 			{
-				Value:      BlockReward,
+				Value:      MainnetParams.BaseSubsidy,
 				PubKeyHash: Hex2Bytes(to),
 			},
 		},
@@ -304,7 +304,7 @@ var testUTXOs = map[string]struct {
 			// tx1: 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 5 "coins" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX and get 5 as remainder
 			"0ca136effc2424a42d2bcf6b498e7c0c226ada6eff5499a7fa600c0ae6bad9c0": {
 				0: {
-					Value:      BlockReward,
+					Value:      MainnetParams.BaseSubsidy,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
 				},
 			},
@@ -330,7 +330,7 @@ var testUTXOs = map[string]struct {
 			// tx3: 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX sent 3 "coins" to 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh and get 2 as remainder
 			"64e97834110d5525f68fbf719743cd22feffb4e91ffb50639f5e232228e3f1e5": {
 				0: {
-					Value:      BlockReward,
+					Value:      MainnetParams.BaseSubsidy,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
 				},
 			},
@@ -354,7 +354,7 @@ var testUTXOs = map[string]struct {
 			// tx4: 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh sent 2 "coins" to 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX and get 1 as remainder
 			"68f0b05abdfa09bbfb732e37248ccb2a737db189d03d22224c3aa13afe593994": {
 				0: {
-					Value:      BlockReward,
+					Value:      MainnetParams.BaseSubsidy,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
 				},
 			},
@@ -378,7 +378,7 @@ var testUTXOs = map[string]struct {
 			// tx5: 1HrwWkjdwQuhaHSco9H7u7SVsmo4aeDZBX sent 3 "coins" to 14vRYoWsjqC61tNmaLPPzjKnxirSxFoehh
 			"c8b152a0040e1f98b261b41444d6eeca09c3bfcc7d1ec69a792748f70efa1efb": {
 				0: {
-					Value:      BlockReward,
+					Value:      MainnetParams.BaseSubsidy,
 					PubKeyHash: Hex2Bytes("15e5ab1b9f1e79b58c95a1a0b3caa63c61617971"),
 				},
 			},
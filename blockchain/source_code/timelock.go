@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+// Lock time and sequence rules, as in Bitcoin BIP65, BIP68, BIP112 and BIP113
+const (
+	// LockTimeThreshold separates the lock times given as block height (below)
+	// from the ones given as unix time
+	LockTimeThreshold = 500000000
+	// SequenceFinal disables the absolute lock time when used by all inputs
+	SequenceFinal = 0xffffffff
+	// SequenceLockTimeDisableFlag disables the relative lock time of an input
+	SequenceLockTimeDisableFlag = 1 << 31
+	// SequenceLockTimeTypeFlag makes the relative lock time a number of
+	// 512 seconds units instead of a number of blocks
+	SequenceLockTimeTypeFlag = 1 << 22
+	// SequenceLockTimeMask extracts the relative lock time value
+	SequenceLockTimeMask = 0x0000ffff
+	// SequenceLockTimeGranularity is the log2 of the relative time unit: 512 seconds
+	SequenceLockTimeGranularity = 9
+	// medianTimeSpan is the number of blocks whose median timestamp is
+	// compared to the time based lock times
+	medianTimeSpan = 11
+)
+
+var (
+	ErrNonFinalTx     = errors.New("transaction is not final")
+	ErrSequenceLocked = errors.New("transaction input is locked by its sequence")
+)
+
+// RelativeLockBlocks returns the sequence locking an input for a number of blocks
+func RelativeLockBlocks(blocks int) uint32 {
+	return uint32(blocks) & SequenceLockTimeMask
+}
+
+// RelativeLockSeconds returns the sequence locking an input for a number of seconds,
+// rounded up to a multiple of 512 seconds
+func RelativeLockSeconds(seconds int64) uint32 {
+	units := (seconds + (1 << SequenceLockTimeGranularity) - 1) >> SequenceLockTimeGranularity
+	return SequenceLockTimeTypeFlag | (uint32(units) & SequenceLockTimeMask)
+}
+
+// SetLockTime sets the absolute lock time of an unsigned transaction,
+// enabling it on its inputs, and updates its ID
+func (tx *Transaction) SetLockTime(lockTime uint32) {
+	tx.LockTime = lockTime
+	for i := range tx.Vin {
+		if tx.Vin[i].Sequence == SequenceFinal {
+			tx.Vin[i].Sequence = SequenceFinal - 1
+		}
+	}
+	tx.ID = tx.Hash()
+}
+
+// SetSequence sets the sequence (relative lock time) of all the inputs of
+// an unsigned transaction and updates its ID
+func (tx *Transaction) SetSequence(sequence uint32) {
+	for i := range tx.Vin {
+		tx.Vin[i].Sequence = sequence
+	}
+	tx.ID = tx.Hash()
+}
+
+// IsFinal checks whether the absolute lock time of the transaction allows
+// it in a block of the given height, whose previous blocks have the given
+// median time
+func (tx *Transaction) IsFinal(height int, medianTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	limit := int64(height)
+	if tx.LockTime >= LockTimeThreshold {
+		limit = medianTime
+	}
+	if int64(tx.LockTime) < limit {
+		return true
+	}
+	// the lock time is ignored when all the inputs are final
+	for _, input := range tx.Vin {
+		if input.Sequence != SequenceFinal {
+			return false
+		}
+	}
+	return true
+}
+
+// VestingScript returns a redeem script paying to the public key hash
+// once the absolute lock time is reached:
+// <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func VestingScript(lockTime uint32, pubKeyHash []byte) Script {
+	b := NewScriptBuilder().AddInt(int64(lockTime)).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP)
+	return append(b.Script(), P2PKHScript(pubKeyHash)...)
+}
+
+// RelativeTimelockScript returns a redeem script paying to the public key
+// hash once the output is old enough (e.g. escrow refunds):
+// <sequence> OP_CHECKSEQUENCEVERIFY OP_DROP OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func RelativeTimelockScript(sequence uint32, pubKeyHash []byte) Script {
+	b := NewScriptBuilder().AddInt(int64(sequence)).AddOp(OP_CHECKSEQUENCEVERIFY).AddOp(OP_DROP)
+	return append(b.Script(), P2PKHScript(pubKeyHash)...)
+}
+
+// CheckLockTime checks the lock time of OP_CHECKLOCKTIMEVERIFY against
+// the lock time of the transaction
+func (c txSigChecker) CheckLockTime(lockTime int64) bool {
+	txLockTime := int64(c.tx.LockTime)
+	// both lock times must be heights or times
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return false
+	}
+	if lockTime > txLockTime {
+		return false
+	}
+	// a final input would disable the lock time of the transaction
+	return c.tx.Vin[c.idx].Sequence != SequenceFinal
+}
+
+// CheckSequence checks the relative lock time of OP_CHECKSEQUENCEVERIFY
+// against the sequence of the input
+func (c txSigChecker) CheckSequence(sequence int64) bool {
+	if sequence&SequenceLockTimeDisableFlag != 0 {
+		return true
+	}
+	txSequence := int64(c.tx.Vin[c.idx].Sequence)
+	if txSequence&SequenceLockTimeDisableFlag != 0 {
+		return false
+	}
+	// both relative lock times must be blocks or times
+	if (sequence & SequenceLockTimeTypeFlag) != (txSequence & SequenceLockTimeTypeFlag) {
+		return false
+	}
+	return sequence&SequenceLockTimeMask <= txSequence&SequenceLockTimeMask
+}
+
+// MedianTimePast returns the median timestamp of the last blocks up to
+// the given height
+func (bc *Blockchain) MedianTimePast(height int) int64 {
+	if height >= len(bc.blocks) {
+		height = len(bc.blocks) - 1
+	}
+	if height < 0 {
+		height = 0
+	}
+	timestamps := []int64{}
+	for h := height; h >= 0 && h > height-medianTimeSpan; h-- {
+		timestamps = append(timestamps, bc.blocks[h].Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// transactionHeight returns the height of the block containing the transaction
+func (bc *Blockchain) transactionHeight(ID []byte) (int, error) {
+	height, ok := bc.txHeights[Bytes2Hex(ID)]
+	if !ok {
+		return 0, ErrTxNotFound
+	}
+	return height, nil
+}
+
+// CheckTransactionLocks checks the absolute and relative lock times of a
+// transaction to be included in a block at the given height
+func (bc *Blockchain) CheckTransactionLocks(tx *Transaction, height int) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	medianTime := bc.MedianTimePast(height - 1)
+	if !tx.IsFinal(height, medianTime) {
+		return ErrNonFinalTx
+	}
+	for _, input := range tx.Vin {
+		if input.Sequence&SequenceLockTimeDisableFlag != 0 {
+			continue
+		}
+		prevHeight, err := bc.transactionHeight(input.Txid)
+		if err == ErrTxNotFound {
+			// the spent output is created in the same block
+			prevHeight = height
+		} else if err != nil {
+			return err
+		}
+		value := int64(input.Sequence & SequenceLockTimeMask)
+		if input.Sequence&SequenceLockTimeTypeFlag != 0 {
+			// time elapsed since the block before the one of the spent output
+			elapsed := medianTime - bc.MedianTimePast(prevHeight-1)
+			if elapsed < value<<SequenceLockTimeGranularity {
+				return ErrSequenceLocked
+			}
+		} else if int64(height-prevHeight) < value {
+			return ErrSequenceLocked
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestCheckTransactionLocksSequence(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	vout := []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value, GetStringAddress(GetAddress(pubKey)))}
+
+	final := newTestSpend(t, privKey, coinbaseTX, []int{0}, vout)
+	if err := bc.CheckTransactionLocks(final, 2); err != nil {
+		t.Errorf("final input: %v", err)
+	}
+
+	// the coinbase transaction is in block 1, the input is locked for 3 blocks
+	locked := &Transaction{Vin: []TXInput{{Txid: coinbaseTX.ID, OutIdx: 0, Sequence: RelativeLockBlocks(3)}}, Vout: vout}
+	tests := []struct {
+		height int
+		bc     *Blockchain
+		want   error
+	}{
+		{2, bc, ErrSequenceLocked},
+		{3, bc, ErrSequenceLocked},
+		{4, bc, nil},
+		{4, CopyBlockchain(bc), nil},
+		{3, CopyBlockchain(bc), ErrSequenceLocked},
+	}
+	for _, test := range tests {
+		if err := test.bc.CheckTransactionLocks(locked, test.height); err != test.want {
+			t.Errorf("height %d: got %v, want %v", test.height, err, test.want)
+		}
+	}
+
+	// a disabled relative lock time is not checked
+	locked.Vin[0].Sequence |= SequenceLockTimeDisableFlag
+	if err := bc.CheckTransactionLocks(locked, 2); err != nil {
+		t.Errorf("disabled lock: %v", err)
+	}
+
+	// an output of the same block cannot be spent with a relative lock time
+	unconfirmed := &Transaction{Vin: []TXInput{{Txid: final.ID, OutIdx: 0, Sequence: RelativeLockBlocks(1)}}, Vout: vout}
+	if err := bc.CheckTransactionLocks(unconfirmed, 2); err != ErrSequenceLocked {
+		t.Errorf("unconfirmed output: got %v, want %v", err, ErrSequenceLocked)
+	}
+}
+
+func TestCheckTransactionLocksReceivedBlock(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	acc := Account{Blockchain: CopyBlockchain(bc)}
+	tx := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(coinbaseTX.Vout[0].Value, GetStringAddress(GetAddress(pubKey)))})
+	block, err := bc.MineBlock([]*Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := acc.HandleMinedBlockIn(block); err != nil {
+		t.Fatal(err)
+	}
+	// the transaction is in block 2, the input is locked for 2 blocks
+	spend := &Transaction{Vin: []TXInput{{Txid: tx.ID, OutIdx: 0, Sequence: RelativeLockBlocks(2)}}, Vout: tx.Vout}
+	if err := acc.Blockchain.CheckTransactionLocks(spend, 3); err != ErrSequenceLocked {
+		t.Errorf("height 3: got %v, want %v", err, ErrSequenceLocked)
+	}
+	if err := acc.Blockchain.CheckTransactionLocks(spend, 4); err != nil {
+		t.Errorf("height 4: %v", err)
+	}
+}
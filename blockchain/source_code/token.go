@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tokenIssuanceMarker prefixes the data of the issuance outputs, followed by
+// the version, the decimals, the supply (8 bytes big endian) and the name
+var tokenIssuanceMarker = []byte("TKN\x01")
+
+const (
+	tokenIssuanceHeaderSize = 4 + 1 + 8
+	// MaxTokenNameSize is the maximum size of the name of a token
+	MaxTokenNameSize = MaxDataCarrierSize - tokenIssuanceHeaderSize
+	// MaxTokenDecimals is the maximum number of decimals of a token
+	MaxTokenDecimals = 18
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid token issuance")
+	ErrTokenNotFound       = errors.New("token not found")
+	ErrNoTokenFunds        = errors.New("not enough tokens")
+	ErrUnbalancedTokens    = errors.New("token inputs and outputs do not match")
+	ErrInvalidTokenOutput  = errors.New("invalid token output")
+	ErrMultipleIssuances   = errors.New("transaction issues several tokens")
+	ErrCoinbaseTokenOutput = errors.New("coinbase transaction cannot carry tokens")
+)
+
+// Token is a fungible token issued on the chain. Token amounts are carried
+// by the outputs (TokenID and TokenAmount) alongside their coin value.
+// The tokens of the inputs of a transaction must all be found in its
+// outputs, the ones carried by data carrier outputs being burned.
+type Token struct {
+	ID           []byte // sha256 of the first outpoint spent by the issuance transaction
+	Name         string
+	Supply       int // issued amount, in the smallest unit
+	Decimals     int // number of decimals used to display the amounts
+	IssuanceTxID []byte
+}
+
+// tokenID returns the ID of a token issued by a transaction spending the outpoint
+func tokenID(input TXInput) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(input.OutIdx))
+	hash := sha256.Sum256(append(append([]byte{}, input.Txid...), data...))
+	return hash[:]
+}
+
+// tokenIssuanceData returns the data of the issuance output of a token
+func tokenIssuanceData(name string, supply, decimals int) ([]byte, error) {
+	if name == "" || len(name) > MaxTokenNameSize || supply <= 0 || decimals < 0 || decimals > MaxTokenDecimals {
+		return nil, ErrInvalidToken
+	}
+	data := append([]byte{}, tokenIssuanceMarker...)
+	data = append(data, byte(decimals))
+	supplyBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(supplyBytes, uint64(supply))
+	data = append(data, supplyBytes...)
+	return append(data, name...), nil
+}
+
+// parseTokenIssuance returns the token issued by the data of an issuance output
+func parseTokenIssuance(data []byte) (*Token, error) {
+	if len(data) <= tokenIssuanceHeaderSize || !bytes.HasPrefix(data, tokenIssuanceMarker) {
+		return nil, ErrInvalidToken
+	}
+	supply := binary.BigEndian.Uint64(data[5:tokenIssuanceHeaderSize])
+	token := &Token{
+		Name:     string(data[tokenIssuanceHeaderSize:]),
+		Supply:   int(supply),
+		Decimals: int(data[4]),
+	}
+	if supply == 0 || token.Supply <= 0 || token.Decimals > MaxTokenDecimals {
+		return nil, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// TokenIssuance returns the token issued by the transaction, if any
+func (tx *Transaction) TokenIssuance() (*Token, error) {
+	var token *Token
+	for _, out := range tx.Vout {
+		if !out.IsDataCarrier() || !bytes.HasPrefix(out.Data(), tokenIssuanceMarker) {
+			continue
+		}
+		if token != nil {
+			return nil, ErrMultipleIssuances
+		}
+		issued, err := parseTokenIssuance(out.Data())
+		if err != nil {
+			return nil, err
+		}
+		token = issued
+	}
+	if token == nil || tx.IsCoinbase() {
+		return nil, ErrTokenNotFound
+	}
+	token.ID = tokenID(tx.Vin[0])
+	token.IssuanceTxID = tx.ID
+	return token, nil
+}
+
+// HasToken checks whether the output carries tokens
+func (out *TXOutput) HasToken() bool {
+	return len(out.TokenID) != 0 || out.TokenAmount != 0
+}
+
+// tokenAmounts adds the token amounts of the outputs by hex token ID
+func tokenAmounts(amounts map[string]int, outputs ...TXOutput) error {
+	for _, out := range outputs {
+		if !out.HasToken() {
+			continue
+		}
+		if len(out.TokenID) != sha256.Size || out.TokenAmount <= 0 {
+			return ErrInvalidTokenOutput
+		}
+		amounts[Bytes2Hex(out.TokenID)] += out.TokenAmount
+	}
+	return nil
+}
+
+// CheckTokens checks the token rules of a transaction: the tokens of the
+// inputs are all found in the outputs (the ones carried by data carrier
+// outputs being burned), except for the supply of a token issued by the
+// transaction
+func (tx *Transaction) CheckTokens(prevTXs map[string]*Transaction) error {
+	outAmounts := make(map[string]int)
+	if err := tokenAmounts(outAmounts, tx.Vout...); err != nil {
+		return err
+	}
+	if tx.IsCoinbase() {
+		if len(outAmounts) != 0 {
+			return ErrCoinbaseTokenOutput
+		}
+		return nil
+	}
+	inAmounts := make(map[string]int)
+	prevOuts, err := tx.spentOutputs(prevTXs)
+	if err != nil {
+		return err
+	}
+	for _, prevOut := range prevOuts {
+		if err := tokenAmounts(inAmounts, *prevOut); err != nil {
+			return err
+		}
+	}
+	token, err := tx.TokenIssuance()
+	if err == nil {
+		inAmounts[Bytes2Hex(token.ID)] += token.Supply
+	} else if err != ErrTokenNotFound {
+		return err
+	}
+	if len(inAmounts) != len(outAmounts) {
+		return ErrUnbalancedTokens
+	}
+	for id, amount := range inAmounts {
+		if outAmounts[id] != amount {
+			return ErrUnbalancedTokens
+		}
+	}
+	return nil
+}
+
+// newTokenOutput creates an output paying the token amount to the address
+func newTokenOutput(id []byte, amount int, address string) TXOutput {
+	out := NewTXOutput(0, address)
+	out.TokenID, out.TokenAmount = id, amount
+	return *out
+}
+
+// NewTokenIssuanceTransaction creates a transaction issuing a token with
+// the whole supply paid to the issuer. The coins of the issuer are spent
+// and sent back as change, the first one defining the token ID.
+// NOTE: The returned tx is NOT signed!
+func NewTokenIssuanceTransaction(pubKey []byte, name string, supply int, decimals int, utxos UTXOSet) (*Transaction, *Token, error) {
+	data, err := tokenIssuanceData(name, supply, decimals)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuance, err := NewDataOutput(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := NewDataTransaction(pubKey, nil, utxos)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := tokenID(tx.Vin[0])
+	address := string(GetAddress(pubKey))
+	tx.Vout = []TXOutput{*issuance, newTokenOutput(id, supply, address), tx.Vout[1]}
+	tx.ID = tx.Hash()
+	token, err := tx.TokenIssuance()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, token, nil
+}
+
+// newTokenSpend creates the inputs spending enough outputs of the token
+// and the change output of the token
+func newTokenSpend(pubKey []byte, id []byte, amount int, utxos UTXOSet) ([]TXInput, []TXOutput, error) {
+	if amount <= 0 {
+		return nil, nil, ErrInvalidTokenOutput
+	}
+	balance, tokenOutputs := utxos.FindSpendableTokenOutputs(HashPubKey(pubKey), id, amount)
+	if balance < amount {
+		return nil, nil, ErrNoTokenFunds
+	}
+	vin := []TXInput{}
+	for txID, outIdxs := range tokenOutputs {
+		for _, outIdx := range outIdxs {
+			vin = append(vin, TXInput{Txid: Hex2Bytes(txID), OutIdx: outIdx, PubKey: pubKey, Sequence: SequenceFinal})
+		}
+	}
+	vout := []TXOutput{}
+	if balance > amount {
+		vout = append(vout, newTokenOutput(id, balance-amount, string(GetAddress(pubKey))))
+	}
+	return vin, vout, nil
+}
+
+// NewTokenTransferTransaction creates a transaction sending an amount of
+// the token to the address, the remaining tokens being sent back
+// NOTE: The returned tx is NOT signed!
+func NewTokenTransferTransaction(pubKey []byte, id []byte, to string, amount int, utxos UTXOSet) (*Transaction, error) {
+	if _, err := ParseAddress(to); err != nil {
+		return nil, err
+	}
+	vin, change, err := newTokenSpend(pubKey, id, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	vout := append([]TXOutput{newTokenOutput(id, amount, to)}, change...)
+	tx := &Transaction{Vin: vin, Vout: vout}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
+
+// NewTokenBurnTransaction creates a transaction destroying an amount of
+// the token, sent to a data carrier output
+// NOTE: The returned tx is NOT signed!
+func NewTokenBurnTransaction(pubKey []byte, id []byte, amount int, utxos UTXOSet) (*Transaction, error) {
+	vin, change, err := newTokenSpend(pubKey, id, amount, utxos)
+	if err != nil {
+		return nil, err
+	}
+	burn, err := NewDataOutput(nil)
+	if err != nil {
+		return nil, err
+	}
+	burn.TokenID, burn.TokenAmount = id, amount
+	tx := &Transaction{Vin: vin, Vout: append([]TXOutput{*burn}, change...)}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
+
+// FindSpendableTokenOutputs finds the unspent outputs of the token locked
+// to the public key hash, until the amount is reached
+func (u UTXOSet) FindSpendableTokenOutputs(pubKeyHash []byte, id []byte, amount int) (int, map[string][]int) {
+	tokenOutputs := make(map[string][]int)
+	balance := 0
+	for txID, outputs := range u {
+		for outIdx, out := range outputs {
+			if balance >= amount {
+				return balance, tokenOutputs
+			}
+			if bytes.Equal(out.TokenID, id) && out.IsLockedWithKey(pubKeyHash) {
+				balance += out.TokenAmount
+				tokenOutputs[txID] = append(tokenOutputs[txID], outIdx)
+			}
+		}
+	}
+	return balance, tokenOutputs
+}
+
+// TokenBalances returns the token balances of the public key hash by hex token ID
+func (u UTXOSet) TokenBalances(pubKeyHash []byte) map[string]int {
+	balances := make(map[string]int)
+	for _, outputs := range u {
+		for _, out := range outputs {
+			if out.HasToken() && out.IsLockedWithKey(pubKeyHash) {
+				balances[Bytes2Hex(out.TokenID)] += out.TokenAmount
+			}
+		}
+	}
+	return balances
+}
+
+// FindToken finds the issuance of a token in the blockchain
+func (bc *Blockchain) FindToken(id []byte) (*Token, error) {
+	for _, block := range bc.blocks {
+		for _, tx := range block.Transactions {
+			token, err := tx.TokenIssuance()
+			if err == nil && bytes.Equal(token.ID, id) {
+				return token, nil
+			}
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+// FormatAmount returns a token amount with the decimals of the token
+func (t *Token) FormatAmount(amount int) string {
+	if t.Decimals == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+	units := fmt.Sprintf("%0*d", t.Decimals+1, amount)
+	return units[:len(units)-t.Decimals] + "." + units[len(units)-t.Decimals:]
+}
+
+func (t *Token) String() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("--- Token %x :", t.ID))
+	lines = append(lines, fmt.Sprintf("     Name:     %s", t.Name))
+	lines = append(lines, fmt.Sprintf("     Supply:   %s", t.FormatAmount(t.Supply)))
+	lines = append(lines, fmt.Sprintf("     Decimals: %d", t.Decimals))
+	lines = append(lines, fmt.Sprintf("     Issuance: %x", t.IssuanceTxID))
+	return strings.Join(lines, "\n")
+}
+
+// sortedTokenIDs returns the hex token IDs of the balances in order
+func sortedTokenIDs(balances map[string]int) []string {
+	ids := make([]string, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestCheckTokensDuplicateInput(t *testing.T) {
+	address := "12znKfjybYauJASaggYEKCWyN9MLKYfA5i"
+	id := sha256.Sum256([]byte("token"))
+	prevTX := &Transaction{Vout: []TXOutput{newTokenOutput(id[:], 100, address)}}
+	prevTX.ID = prevTX.Hash()
+	prevTXs := map[string]*Transaction{Bytes2Hex(prevTX.ID): prevTX}
+	input := TXInput{Txid: prevTX.ID, OutIdx: 0, Sequence: SequenceFinal}
+
+	tx := &Transaction{Vin: []TXInput{input}, Vout: []TXOutput{newTokenOutput(id[:], 100, address)}}
+	if err := tx.CheckTokens(prevTXs); err != nil {
+		t.Errorf("transfer of the tokens rejected: %v", err)
+	}
+	// spending the output twice must not double the tokens
+	tx = &Transaction{Vin: []TXInput{input, input}, Vout: []TXOutput{newTokenOutput(id[:], 200, address)}}
+	if err := tx.CheckTokens(prevTXs); err != ErrDuplicateInput {
+		t.Errorf("got %v, want %v", err, ErrDuplicateInput)
+	}
+}
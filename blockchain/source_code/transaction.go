@@ -3,72 +3,171 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"math/big"
+	"sort"
 	"strings"
 )
 
 var (
 	ErrNoFunds         = errors.New("not enough funds")
 	ErrTxInputNotFound = errors.New("transaction input not found")
+	ErrInvalidPayouts  = errors.New("payouts do not add up to the block reward")
+	ErrCoinbaseValue   = errors.New("coinbase pays more than the block subsidy")
+	ErrDuplicateInput  = errors.New("transaction spends the same output twice")
 )
 
 // Transaction represents a Bitcoin transaction
 type Transaction struct {
-	ID   []byte
-	Vin  []TXInput
-	Vout []TXOutput
+	ID       []byte
+	Vin      []TXInput
+	Vout     []TXOutput
+	LockTime uint32 // block height or unix time before which the transaction can't be mined
 }
 
-// NewCoinbaseTX creates a new coinbase transaction
-func NewCoinbaseTX(to, data string) (*Transaction, error) {
+// gob numbers the types in the order they are first encoded, and the
+// numbers are part of the encoding hashed into the transaction ID: the
+// transaction is encoded first, before any type holding its inputs or
+// outputs, so that its ID does not depend on what was encoded before
+func init() {
+	Transaction{}.Serialize()
+}
+
+// NewCoinbaseTX creates a new coinbase transaction paying
+// the subsidy of the block at the given height
+func NewCoinbaseTX(to, data string, height int) (*Transaction, error) {
+	return NewFeeCoinbaseTX(to, data, height, 0)
+}
+
+// NewFeeCoinbaseTX creates a new coinbase transaction paying the subsidy
+// of the block at the given height and the fees of its transactions
+func NewFeeCoinbaseTX(to, data string, height int, fees int) (*Transaction, error) {
+	if _, err:=ParseAddress(to); err != nil {
+		return nil, err
+	}
 	if data == "" {
 		data=RandomString(10)
 	}
 	tXInput :=TXInput{OutIdx:-1,PubKey:[]byte(data)}
-	txOutput:=TXOutput{Value:BlockReward,PubKeyHash:GetPubKeyHashFromAddress(to)}
-	tx:=&Transaction{ Vin:[]TXInput{tXInput}, Vout:[]TXOutput{txOutput}}
+	txOutput:=NewTXOutput(netParams.BlockSubsidy(height)+fees,to)
+	tx:=&Transaction{ Vin:[]TXInput{tXInput}, Vout:[]TXOutput{*txOutput}}
 	tx.ID=tx.Hash()
 	return tx,nil
 }
 
+// NewPayoutCoinbaseTX creates a coinbase transaction splitting the reward of
+// the block at the given height, its subsidy and the fees of its transactions,
+// between several addresses, given as address -> value
+func NewPayoutCoinbaseTX(payouts map[string]int, data string, height int, fees int) (*Transaction, error) {
+	if data == "" {
+		data = RandomString(10)
+	}
+	total := 0
+	addresses := make([]string, 0, len(payouts))
+	for address, value := range payouts {
+		if _, err := ParseAddress(address); err != nil {
+			return nil, err
+		}
+		total += value
+		addresses = append(addresses, address)
+	}
+	if len(payouts) == 0 || total != netParams.BlockSubsidy(height)+fees {
+		return nil, ErrInvalidPayouts
+	}
+	// keep the outputs order deterministic
+	sort.Strings(addresses)
+	vout := []TXOutput{}
+	for _, address := range addresses {
+		if payouts[address] > 0 {
+			vout = append(vout, *NewTXOutput(payouts[address], address))
+		}
+	}
+	tx := &Transaction{Vin: []TXInput{{OutIdx: -1, PubKey: []byte(data)}}, Vout: vout}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
 
-
-// NewUTXOTransaction creates a new UTXO transaction
+// NewUTXOTransaction creates a new UTXO transaction, selecting the coins
+// with the default coin selector and paying no fee
 // NOTE: The returned tx is NOT signed!
 func NewUTXOTransaction(pubKey []byte, to string, amount int, utxos UTXOSet) (*Transaction, error) {
-	// 1) Find valid spendable outputs and the current balance of the sender
-	// 2) The sender has sufficient funds? If not return the error:
-	// "Not enough funds"
-	// 3) Build a list of inputs based on the current valid outputs
-	// 4) Build a list of new outputs, creating a "change" output if necessary
-	// 5) Create a new transaction with the input and output list.
-	pubKeyHashSender:=HashPubKey(pubKey)
-	accumulatedBalance, spendableOutputs:=utxos.FindSpendableOutputs(pubKeyHashSender,amount)
-	if accumulatedBalance<amount {
-		return nil,ErrNoFunds
+	return NewFundedTransaction(pubKey, to, amount, utxos, FundingOptions{})
+}
+
+// NewFundedTransaction creates a transaction paying the amount to the
+// address, funded by the coins of the key chosen by the funding options.
+// The excess of the coins goes back to the key as change, unless it is
+// given to the fee to avoid a dust change output.
+// NOTE: The returned tx is NOT signed!
+func NewFundedTransaction(pubKey []byte, to string, amount int, utxos UTXOSet, opts FundingOptions) (*Transaction, error) {
+	return NewBatchTransaction(pubKey, []Payment{{Address: to, Amount: amount}}, utxos, opts)
+}
+
+// NewMultisigTransaction creates a transaction spending the outputs locked
+// to the hash of a multisig redeem script, sending the change back to it.
+// The unlocking script of each input only contains the redeem script:
+// the signatures are collected by signing the transaction with Sign.
+func NewMultisigTransaction(redeemScript Script, to string, amount int, utxos UTXOSet) (*Transaction, error) {
+	if _, _, err := redeemScript.ParseMultisig(); err != nil {
+		return nil, err
 	}
+	return NewP2SHTransaction(redeemScript, to, amount, utxos)
+}
 
-	vin:=[]TXInput{}
-	for id,val:=range spendableOutputs{
-		for _,outIdx:=range val{
-			tXInput:=TXInput{Txid:Hex2Bytes(id),OutIdx:outIdx,PubKey:pubKey}
-			vin= append(vin,tXInput)
+// NewP2SHTransaction creates a transaction spending the outputs locked to
+// the hash of a redeem script (multisig or timelocked key), sending the
+// change back to it. The timelock of the redeem script, if any, is set on
+// the transaction.
+// NOTE: The returned tx is NOT signed!
+func NewP2SHTransaction(redeemScript Script, to string, amount int, utxos UTXOSet) (*Transaction, error) {
+	if _, err := ParseAddress(to); err != nil {
+		return nil, err
+	}
+	coins := utxos.ScriptCoins(redeemScript)
+	accumulatedBalance := coinsValue(coins)
+	if accumulatedBalance < amount {
+		return nil, ErrNoFunds
+	}
+	// unsigned unlocking script: the redeem script, after OP_0 for multisig
+	scriptSig := NewScriptBuilder().AddData(redeemScript).Script()
+	if _, _, err := redeemScript.ParseMultisig(); err == nil {
+		scriptSig = multisigUnlockingScript(nil, redeemScript)
+	}
+	vin := []TXInput{}
+	for _, c := range coins {
+		vin = append(vin, TXInput{
+			Txid:      c.TxID,
+			OutIdx:    c.OutIdx,
+			ScriptSig: scriptSig,
+			Sequence:  SequenceFinal,
+		})
+	}
+	vout := []TXOutput{*NewTXOutput(amount, to)}
+	if accumulatedBalance > amount {
+		vout = append(vout, *NewTXOutput(accumulatedBalance-amount, GetScriptAddress(redeemScript)))
+	}
+	tx := &Transaction{Vin: vin, Vout: vout}
+	tx.ID = tx.Hash()
+	if opcode, value, ok := redeemScript.Timelock(); ok {
+		if opcode == OP_CHECKLOCKTIMEVERIFY {
+			tx.SetLockTime(uint32(value))
+		} else {
+			tx.SetSequence(uint32(value))
 		}
+	}
+	return tx, nil
+}
 
+// multisigUnlockingScript returns the script unlocking a P2SH multisig output:
+// OP_0 <sig1> ... <sigm> <redeemScript>
+func multisigUnlockingScript(signatures [][]byte, redeemScript Script) Script {
+	b := NewScriptBuilder().AddOp(OP_0)
+	for _, signature := range signatures {
+		b.AddData(signature)
 	}
-	PubKeyHashRecepient:=GetPubKeyHashFromAddress(to)
-	tXOutputTo:=TXOutput{Value:amount,PubKeyHash:PubKeyHashRecepient}
-	tXOutputFrom:=TXOutput{Value:accumulatedBalance-amount,PubKeyHash:pubKeyHashSender}
-	vout:=[]TXOutput{tXOutputTo,tXOutputFrom}
-	tx:=&Transaction{Vin:vin,Vout:vout}
-	tx.ID=tx.Hash()
-	return tx,nil
+	return b.AddData(redeemScript).Script()
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -116,6 +215,7 @@ func (tx Transaction) TrimmedCopy() Transaction {
 	for _,input:=range tx.Vin{
 		input.Signature=nil
 		input.PubKey=nil
+		input.ScriptSig=nil
 		vin = append(vin, input)
 	}
 	txCopy:=tx
@@ -123,116 +223,236 @@ func (tx Transaction) TrimmedCopy() Transaction {
 	return txCopy
 }
 
-// Sign signs each input of a Transaction
+// prevOutput returns the output spent by the input among the previous transactions
+func prevOutput(prevTXs map[string]*Transaction, input TXInput) (*TXOutput, error) {
+	prevTX := prevTXs[Bytes2Hex(input.Txid)]
+	if prevTX == nil || input.OutIdx < 0 || input.OutIdx >= len(prevTX.Vout) {
+		return nil, ErrTxInputNotFound
+	}
+	return &prevTX.Vout[input.OutIdx], nil
+}
+
+// spentOutputs returns the outputs spent by the inputs of the transaction,
+// each output being spent once at most
+func (tx *Transaction) spentOutputs(prevTXs map[string]*Transaction) ([]*TXOutput, error) {
+	spent := make(map[string]bool)
+	outputs := []*TXOutput{}
+	for _, input := range tx.Vin {
+		if spent[outpoint(input)] {
+			return nil, ErrDuplicateInput
+		}
+		spent[outpoint(input)] = true
+		out, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// Sign signs each input of a Transaction with SigHashAll. Inputs spending
+// a P2SH multisig output collect the signature among the ones of the other signers.
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]*Transaction) error {
+	return tx.SignWithType(privKey, prevTXs, SigHashAll)
+}
+
+// SignWithType signs each input of a Transaction individually with the given sighash type
+func (tx *Transaction) SignWithType(privKey ecdsa.PrivateKey, prevTXs map[string]*Transaction, hashType SigHashType) error {
 	//1) coinbase transactions are not signed.
 	if tx.IsCoinbase(){ return nil }
-	//2) Throw a Panic in case of any prevTXs (used inputs) didn't exists
+	//2) Return an error in case of any prevTXs (used inputs) didn't exists
+	// or can't be unlocked by the key
+	pubKey := pubKeyToByte(privKey.PublicKey)
 	for _, input := range tx.Vin{
-		//if the input txID is not in the key of prevTXs, return error
-		if prevTXs[Bytes2Hex(input.Txid)]==nil{
+		output, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return err
+		}
+		if output.LockingScript().IsP2SH() {
+			if _, err := input.p2shSigner(output, pubKey); err != nil {
+				return err
+			}
+		} else if !output.IsLockedWithKey(HashPubKey(input.PubKey)) {
 			return ErrTxInputNotFound
 		}
-		//check if the public key field of input and output match or not
-		exsitFlag := false
-		for _, output := range prevTXs[Bytes2Hex(input.Txid)].Vout{
-			if(bytes.Equal(HashPubKey(input.PubKey),output.PubKeyHash)){
-				exsitFlag=true
+	}
+	//3) Sign each input over its own signature hash
+	for idx, input := range tx.Vin {
+		output, _ := prevOutput(prevTXs, input)
+		if err := tx.SignInput(idx, privKey, output, hashType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignInput signs the input idx spending prevOut and sets its unlocking script
+func (tx *Transaction) SignInput(idx int, privKey ecdsa.PrivateKey, prevOut *TXOutput, hashType SigHashType) error {
+	digest, err := tx.SignatureHash(idx, prevOut, hashType)
+	if err != nil {
+		return err
+	}
+	input := &tx.Vin[idx]
+	// inputs carrying an x-only public key are signed with Schnorr
+	sign := signDigest
+	if len(input.PubKey) == SchnorrPubKeySize && !prevOut.LockingScript().IsP2SH() {
+		sign = SchnorrSign
+	}
+	signature, err := sign(privKey, digest)
+	if err != nil {
+		return err
+	}
+	// the sighash type is appended to the signature
+	signature = append(signature, byte(hashType))
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	if prevOut.LockingScript().IsP2SH() {
+		redeemScript, err := input.p2shSigner(prevOut, pubKey)
+		if err != nil {
+			return err
+		}
+		if _, _, err := redeemScript.ParseMultisig(); err == nil {
+			checker := txSigChecker{tx: tx, idx: idx, prevOut: prevOut}
+			scriptSig, err := input.addMultisigSignature(prevOut, pubKey, signature, checker)
+			if err != nil {
+				return err
+			}
+			input.ScriptSig = scriptSig
+			return nil
+		}
+		// redeem script ending like a P2PKH script: <signature> <pubKey> <redeemScript>
+		input.Signature, input.PubKey = signature, pubKey
+		input.ScriptSig = NewScriptBuilder().AddData(signature).AddData(pubKey).AddData(redeemScript).Script()
+		return nil
+	}
+	input.Signature = signature
+	input.ScriptSig = P2PKHUnlockingScript(signature, input.PubKey)
+	return nil
+}
+
+// p2shSigner returns the redeem script of an input spending a P2SH
+// output, checking that the public key is one of its signers
+func (in *TXInput) p2shSigner(output *TXOutput, pubKey []byte) (Script, error) {
+	pushed, err := in.ScriptSig.PushedData()
+	if err != nil || len(pushed) == 0 {
+		return nil, ErrInvalidMultisig
+	}
+	redeemScript := Script(pushed[len(pushed)-1])
+	if !output.IsLockedWithScript(redeemScript) {
+		return nil, ErrInvalidMultisig
+	}
+	if !canSignScript(redeemScript, pubKey) {
+		return nil, ErrTxInputNotFound
+	}
+	return redeemScript, nil
+}
+
+// canSignScript checks whether the public key is one of the keys of a
+// multisig script, or the key of a script ending like a P2PKH script
+func canSignScript(script Script, pubKey []byte) bool {
+	if bytes.Equal(script.TrailingPubKeyHash(), HashPubKey(pubKey)) {
+		return true
+	}
+	_, pubKeys, err := script.ParseMultisig()
+	if err != nil {
+		return false
+	}
+	for _, key := range pubKeys {
+		if bytes.Equal(key, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// addMultisigSignature returns the unlocking script of the input with the
+// signature added to the previous ones, ordered as their public keys in
+// the redeem script, keeping at most the required number of signatures
+func (in *TXInput) addMultisigSignature(output *TXOutput, pubKey, signature []byte, checker SignatureChecker) (Script, error) {
+	redeemScript, err := in.p2shSigner(output, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	m, pubKeys, err := redeemScript.ParseMultisig()
+	if err != nil {
+		return nil, err
+	}
+	// pushed data: OP_0 <sig1> ... <sigk> <redeemScript>
+	pushed, _ := in.ScriptSig.PushedData()
+	previous := [][]byte{}
+	if len(pushed) > 2 {
+		previous = pushed[1 : len(pushed)-1]
+	}
+	previous = append(previous, signature)
+	signatures := [][]byte{}
+	for _, key := range pubKeys {
+		for _, sig := range previous {
+			if len(signatures) < m && checker.CheckSig(sig, key) {
+				signatures = append(signatures, sig)
 				break
 			}
 		}
-		if !exsitFlag{
-			return ErrTxInputNotFound
-		} 
-	}
-	//3) Create a copy of the transaction to be signed
-	txCopy:=tx.TrimmedCopy()
-	//4) Sign all the previous TXInputs of the transaction tx using the
-	// copy as the payload (serialized) to be signed in the ecdsa.Sig
-
-	//calculate the signature
-	payload:=txCopy.Serialize()
-	r, s, serr := ecdsa.Sign(rand.Reader, &privKey, payload)
-	if serr != nil {
-		fmt.Println(serr)
-		panic(serr)
-	}
-	signature :=append(r.Bytes(),s.Bytes()...)
-	//assign the signature to each input of the transaction
-	vin:=[]TXInput{}
-	for _,input:=range tx.Vin{
-		input.Signature=signature
-		vin = append(vin, input)
 	}
-	tx.Vin=vin
-	return nil	
+	return multisigUnlockingScript(signatures, redeemScript), nil
 }
 
-// Verify verifies signatures of Transaction inputs
+// Verify verifies signatures of Transaction inputs by running
+// their unlocking script against the locking script of the spent output
 func (tx Transaction) Verify(prevTXs map[string]*Transaction) bool {
+	return tx.verify(prevTXs, nil)
+}
+
+// verify verifies the inputs of the transaction, adding their Schnorr
+// signatures to the batch, if any, instead of verifying them
+func (tx Transaction) verify(prevTXs map[string]*Transaction, batch *SchnorrBatch) bool {
 	//1) coinbase transactions are not signed.
 	if tx.IsCoinbase(){ return true }
-	//2) Throw a Panic in case of any prevTXs (used inputs) didn't exists
-	for _, input := range tx.Vin{
-		//if the input txID is not in the key of prevTXs, return error
-		if prevTXs[Bytes2Hex(input.Txid)]==nil{
+	//2) Each input must unlock the output it spends, its signatures
+	// being checked against its own signature hash
+	for idx, input := range tx.Vin{
+		output, err := prevOutput(prevTXs, input)
+		if err != nil {
 			return false
 		}
-		//check if the public key field of input and output match or not
-		exsitFlag := false
-		for _, output := range prevTXs[Bytes2Hex(input.Txid)].Vout{
-			if(bytes.Equal(HashPubKey(input.PubKey),output.PubKeyHash)){
-				exsitFlag=true
-				break
-			}
-		}
-		if !exsitFlag{
+		checker := txSigChecker{tx: &tx, idx: idx, prevOut: output, batch: batch}
+		if ExecuteScripts(input.UnlockingScript(), output.LockingScript(), checker) != nil {
 			return false
-			//panic(ErrTxInputNotFound)
-		} 
-	}
-	//3) Create the same copy of the transaction that was signed
-	// and get the curve used for sign: P256
-	txCopy:=tx.TrimmedCopy()
-	curveForSign:= elliptic.P256()
-	// 4) Doing the opposite operation of the signing, perform the
-	// verification of the signature,
-	for _,input:=range tx.Vin{
-		//recovering the R and S byte fields of the Signature
-		length:=len(input.Signature)
-		r:= new(big.Int).SetBytes(input.Signature[:length/2])
-		s:= new(big.Int).SetBytes(input.Signature[length/2:])
-		//recovering X and Y fields of the PubKey from the inputs of tx
-		length=len(input.PubKey)
-		x:= new(big.Int).SetBytes(input.PubKey[:length/2])
-		y:= new(big.Int).SetBytes(input.PubKey[length/2:])
-
-		ecdsaPubKey:=ecdsa.PublicKey{curveForSign, x, y}
-		if !ecdsa.Verify(&ecdsaPubKey, txCopy.Serialize(), r, s) {
-			return false
-		}	
+		}
 	}
 	return true
 }
 
+// VerifyInput runs the unlocking script of the input idx against
+// the locking script of the output it spends
+func (tx *Transaction) VerifyInput(idx int, prevOut *TXOutput) error {
+	checker := txSigChecker{tx: tx, idx: idx, prevOut: prevOut}
+	return ExecuteScripts(tx.Vin[idx].UnlockingScript(), prevOut.LockingScript(), checker)
+}
+
 // String returns a human-readable representation of a transaction
 func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("--- Transaction %x :", tx.ID))
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
+	}
 
 	for i, input := range tx.Vin {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
 		lines = append(lines, fmt.Sprintf("       OutIdx:    %d", input.OutIdx))
+		lines = append(lines, fmt.Sprintf("       Sequence:  %x", input.Sequence))
 		lines = append(lines, fmt.Sprintf("       PubKey: %x", input.PubKey))
 		lines = append(lines, fmt.Sprintf("       PubKeyHash: %x", HashPubKey(input.PubKey)))
+		lines = append(lines, fmt.Sprintf("       ScriptSig: %s", input.UnlockingScript()))
 	}
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
 		lines = append(lines, fmt.Sprintf("       PubKeyHash: %x", output.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("       ScriptPubKey: %s", output.LockingScript()))
 	}
 
 	return strings.Join(lines, "\n")
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+)
+
+var (
+	ErrUnbalancedTransaction = errors.New("contributions and payments do not match")
+	ErrNothingToSign         = errors.New("no input can be signed with this key")
+	ErrMissingSignatures     = errors.New("transaction is not fully signed")
+)
+
+// Contribution is the part of a collaborative transaction paid by one owner
+type Contribution struct {
+	PubKey []byte // public key of the owner of the spent outputs
+	Amount int    // amount paid by the owner, the rest of its outputs is sent back as change
+}
+
+// Payment is an amount paid to an address
+type Payment struct {
+	Address string
+	Amount  int
+}
+
+// NewCollaborativeTransaction creates a transaction spending the coins of
+// several owners. Each owner signs its own inputs with SignOwnInputs and
+// the transaction can be mined once Finalize succeeds.
+// NOTE: The returned tx is NOT signed!
+func NewCollaborativeTransaction(contributions []Contribution, payments []Payment, utxos UTXOSet) (*Transaction, error) {
+	contributed, paid := 0, 0
+	for _, c := range contributions {
+		contributed += c.Amount
+	}
+	for _, p := range payments {
+		paid += p.Amount
+	}
+	if len(contributions) == 0 || len(payments) == 0 || contributed != paid {
+		return nil, ErrUnbalancedTransaction
+	}
+
+	vin := []TXInput{}
+	vout := []TXOutput{}
+	for _, p := range payments {
+		if p.Amount <= 0 || !ValidateAddress(p.Address) {
+			return nil, ErrUnbalancedTransaction
+		}
+		vout = append(vout, *NewTXOutput(p.Amount, p.Address))
+	}
+	for _, c := range contributions {
+		pubKeyHash := HashPubKey(c.PubKey)
+		// the owners pay no fee, the largest coins first
+		params := CoinSelectionParams{Target: c.Amount, NumOutputs: 1}
+		selection, err := (LargestFirst{}).SelectCoins(utxos.Coins(pubKeyHash), params)
+		if err != nil {
+			return nil, err
+		}
+		vin = append(vin, selection.inputs(c.PubKey, SequenceFinal)...)
+		if selection.Change > 0 {
+			vout = append(vout, TXOutput{Value: selection.Change, PubKeyHash: pubKeyHash, ScriptPubKey: P2PKHScript(pubKeyHash)})
+		}
+	}
+	tx := &Transaction{Vin: vin, Vout: vout}
+	tx.ID = tx.Hash()
+	return tx, nil
+}
+
+// SignOwnInputs signs, with SigHashAll, the inputs of the transaction
+// that can be unlocked by the key, leaving the other inputs untouched.
+// It returns the number of signed inputs.
+func (tx *Transaction) SignOwnInputs(privKey ecdsa.PrivateKey, prevTXs map[string]*Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+	pubKey := pubKeyToByte(privKey.PublicKey)
+	signed := 0
+	for idx, input := range tx.Vin {
+		output, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return signed, err
+		}
+		if output.LockingScript().IsP2SH() {
+			if _, err := input.p2shSigner(output, pubKey); err != nil {
+				continue
+			}
+		} else if !output.IsLockedWithKey(HashPubKey(pubKey)) {
+			continue
+		}
+		if err := tx.SignInput(idx, privKey, output, SigHashAll); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+	if signed == 0 {
+		return 0, ErrNothingToSign
+	}
+	return signed, nil
+}
+
+// Finalize checks that every input of the transaction is signed
+func (tx *Transaction) Finalize(prevTXs map[string]*Transaction) error {
+	if !tx.Verify(prevTXs) {
+		return ErrMissingSignatures
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestCollaborativeTransaction(t *testing.T) {
+	alicePrivKey, alicePubKey := newKeyPair()
+	bobPrivKey, bobPubKey := newKeyPair()
+	carolPrivKey, carolPubKey := newKeyPair()
+	bc, _ := newTestChain(t, alicePubKey)
+	mineTestBlock(t, bc, bobPubKey)
+	carol := GetStringAddress(GetAddress(carolPubKey))
+	contributions := []Contribution{{PubKey: alicePubKey, Amount: 3}, {PubKey: bobPubKey, Amount: 4}}
+	utxos := bc.FindUTXOSet()
+
+	unbalanced := []Payment{{Address: carol, Amount: 8}}
+	if _, err := NewCollaborativeTransaction(contributions, unbalanced, utxos); err != ErrUnbalancedTransaction {
+		t.Errorf("unbalanced contributions: got %v, want %v", err, ErrUnbalancedTransaction)
+	}
+	tx, err := NewCollaborativeTransaction(contributions, []Payment{{Address: carol, Amount: 7}}, utxos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevTXs, err := bc.GetInputTXsOf(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.SignOwnInputs(carolPrivKey, prevTXs); err != ErrNothingToSign {
+		t.Errorf("signing without inputs: got %v, want %v", err, ErrNothingToSign)
+	}
+	if signed, err := tx.SignOwnInputs(alicePrivKey, prevTXs); err != nil || signed != 1 {
+		t.Fatalf("alice signed %d inputs: %v", signed, err)
+	}
+	if err := tx.Finalize(prevTXs); err != ErrMissingSignatures {
+		t.Errorf("finalizing without bob: got %v, want %v", err, ErrMissingSignatures)
+	}
+	if signed, err := tx.SignOwnInputs(bobPrivKey, prevTXs); err != nil || signed != 1 {
+		t.Fatalf("bob signed %d inputs: %v", signed, err)
+	}
+	if err := tx.Finalize(prevTXs); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, bc, carolPubKey, tx)
+	utxos = bc.FindUTXOSet()
+	for _, balance := range []struct {
+		pubKey []byte
+		want   int
+	}{
+		{alicePubKey, netParams.BlockSubsidy(1) - 3},
+		{bobPubKey, netParams.BlockSubsidy(2) - 4},
+		{carolPubKey, netParams.BlockSubsidy(3) + 7},
+	} {
+		got := 0
+		for _, out := range utxos.FindUTXO(HashPubKey(balance.pubKey)) {
+			got += out.Value
+		}
+		diff(t, balance.want, got, "balance")
+	}
+}
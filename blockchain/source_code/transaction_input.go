@@ -8,6 +8,17 @@ type TXInput struct {
 	OutIdx    int    // The index of the specific output in the transaction. The first output is 0, etc.
 	Signature []byte // The signature of this input
 	PubKey    []byte // The logic that authorizes the use of this input by satisfying the output's PubKeyHash. In this demo we will be using the raw public key (not hashed)
+	ScriptSig Script // The unlocking script satisfying the locking script of the referenced output
+	Sequence  uint32 // The relative lock time of the input, see SequenceLockTimeDisableFlag
+}
+
+// UnlockingScript returns the script unlocking the referenced output.
+// Inputs without ScriptSig are unlocked by <Signature> <PubKey>.
+func (in *TXInput) UnlockingScript() Script {
+	if len(in.ScriptSig) != 0 {
+		return in.ScriptSig
+	}
+	return P2PKHUnlockingScript(in.Signature, in.PubKey)
 }
 
 // UsesKey checks whether the address initiated the transaction
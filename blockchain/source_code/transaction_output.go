@@ -2,32 +2,89 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 )
 
+var ErrDataTooLarge = errors.New("data carrier output is too large")
+
 // TXOutput represents a transaction output
 type TXOutput struct {
-	Value      int    // The transaction value
-	PubKeyHash []byte // The conditions to claim this output. For this demo we will use the hash of the public key (used to "lock" the output)
+	Value        int    // The transaction value
+	PubKeyHash   []byte // The conditions to claim this output. For this demo we will use the hash of the public key (used to "lock" the output)
+	ScriptPubKey Script // The locking script of the output
+	TokenID      []byte // The token carried by the output, see Token
+	TokenAmount  int    // The amount of the token carried by the output
+	NFT          *NFT   // The non-fungible token carried by the output, if any
+}
+
+// LockingScript returns the script locking the output.
+// Outputs without ScriptPubKey are locked to their PubKeyHash (P2PKH).
+func (out *TXOutput) LockingScript() Script {
+	if len(out.ScriptPubKey) != 0 {
+		return out.ScriptPubKey
+	}
+	return P2PKHScript(out.PubKeyHash)
 }
 
 // Lock locks the transaction to a specific address
-// Only this address owns this transaction
-func (out *TXOutput) Lock(address string) {
-	pubKeyHash:=GetPubKeyHashFromAddress(address)
-	out.PubKeyHash=pubKeyHash
+// Only this address owns this transaction. An invalid address returns
+// its error and makes an unspendable OP_RETURN output, rejected if it
+// carries a value.
+func (out *TXOutput) Lock(address string) error {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		out.PubKeyHash, out.ScriptPubKey = nil, NullDataScript(nil)
+		return err
+	}
+	out.PubKeyHash = addr.Hash
+	out.ScriptPubKey = addr.LockingScript()
+	return nil
 }
 
 // IsLockedWithKey checks if the output can be used by the owner of the pubkey
 func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Equal(out.PubKeyHash, pubKeyHash)
+	return bytes.Equal(out.LockingScript().PubKeyHash(), pubKeyHash)
+}
+
+// IsLockedWithScript checks if the output pays to the hash of the redeem script
+func (out *TXOutput) IsLockedWithScript(redeemScript Script) bool {
+	return bytes.Equal(out.LockingScript().ScriptHash(), HashPubKey(redeemScript))
 }
 
 // NewTXOutput create a new TXOutput
+// The transaction constructors check the address with ParseAddress first.
 func NewTXOutput(value int, address string) *TXOutput {
-	return &TXOutput{Value:value, PubKeyHash:GetPubKeyHashFromAddress(address)}
+	out := &TXOutput{Value: value}
+	out.Lock(address)
+	return out
+}
+
+// NewDataOutput creates a provably unspendable output carrying the data,
+// with no value. It is never added to the UTXO set.
+func NewDataOutput(data []byte) (*TXOutput, error) {
+	if len(data) > MaxDataCarrierSize {
+		return nil, ErrDataTooLarge
+	}
+	return &TXOutput{Value: 0, ScriptPubKey: NullDataScript(data)}, nil
+}
+
+// IsDataCarrier checks whether the output only carries data
+func (out *TXOutput) IsDataCarrier() bool {
+	return out.ScriptPubKey.IsNullData()
+}
+
+// Data returns the data carried by a data carrier output, or nil
+func (out *TXOutput) Data() []byte {
+	return out.ScriptPubKey.NullData()
 }
 
 func (out TXOutput) String() string {
+	if out.NFT != nil {
+		return fmt.Sprintf("{%d, %x, NFT %x}", out.Value, out.PubKeyHash, out.NFT.ID)
+	}
+	if out.HasToken() {
+		return fmt.Sprintf("{%d, %x, %d of token %x}", out.Value, out.PubKeyHash, out.TokenAmount, out.TokenID)
+	}
 	return fmt.Sprintf("{%d, %x}", out.Value, out.PubKeyHash)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	_, pubKey := newKeyPair()
+	address := GetStringAddress(GetAddress(pubKey))
+	out := TXOutput{Value: 1}
+	if err := out.Lock(address); err != nil {
+		t.Fatal(err)
+	}
+	if !out.IsLockedWithKey(HashPubKey(pubKey)) {
+		t.Error("output not locked to the key")
+	}
+	typo := address[:len(address)-1] + "x"
+	if err := out.Lock(typo); err != ErrAddressChecksum {
+		t.Errorf("address with a typo: got %v, want %v", err, ErrAddressChecksum)
+	}
+	if err := out.Lock(""); err != ErrEmptyAddress {
+		t.Errorf("empty address: got %v, want %v", err, ErrEmptyAddress)
+	}
+	// the coinbases are not paid to an invalid address
+	if _, err := NewCoinbaseTX(typo, "", 1); err != ErrAddressChecksum {
+		t.Errorf("coinbase: got %v, want %v", err, ErrAddressChecksum)
+	}
+	if _, err := NewPayoutCoinbaseTX(map[string]int{typo: netParams.BlockSubsidy(1)}, "", 1, 0); err != ErrAddressChecksum {
+		t.Errorf("payout coinbase: got %v, want %v", err, ErrAddressChecksum)
+	}
+	coinbaseTX, err := NewCoinbaseTX(address, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(coinbaseTX.Vout[0].PubKeyHash, HashPubKey(pubKey)) {
+		t.Error("coinbase not paid to the address")
+	}
+}
@@ -13,19 +13,35 @@ import (
 type UTXOSet map[string]map[int]TXOutput
 
 // FindSpendableOutputs finds and returns unspent outputs in the UTXO Set
-// to reference in inputs
+// to reference in inputs, worth at least the amount and selected largest
+// first, or all of them if the amount is not positive. The balance is
+// below the amount if the outputs are not enough.
 func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	spendableOutputs:=make(map[string][]int)
-	accumulatedBalance:=0
-	for txID, mapTXOutput := range u{	
-		for outIdx, txOutput := range mapTXOutput{	
-			if  txOutput.IsLockedWithKey(pubKeyHash) {
-				accumulatedBalance=accumulatedBalance+txOutput.Value
-				spendableOutputs[txID]=append(spendableOutputs[txID],outIdx)
-			}
+	coins:=u.Coins(pubKeyHash)
+	if amount > 0 {
+		params:=CoinSelectionParams{Target:amount, NumOutputs:1}
+		if selection, err:=(LargestFirst{}).SelectCoins(coins, params); err == nil {
+			coins=selection.Coins
 		}
 	}
-	return accumulatedBalance, spendableOutputs
+	spendableOutputs:=make(map[string][]int)
+	for _, c := range coins {
+		txID:=Bytes2Hex(c.TxID)
+		spendableOutputs[txID]=append(spendableOutputs[txID],c.OutIdx)
+	}
+	return coinsValue(coins), spendableOutputs
+}
+
+// FindScriptOutputs finds and returns the unspent outputs in the UTXO Set
+// locked to the hash of the redeem script
+func (u UTXOSet) FindScriptOutputs(redeemScript Script) (int, map[string][]int) {
+	coins:=u.ScriptCoins(redeemScript)
+	spendableOutputs:=make(map[string][]int)
+	for _, c := range coins {
+		txID:=Bytes2Hex(c.TxID)
+		spendableOutputs[txID]=append(spendableOutputs[txID],c.OutIdx)
+	}
+	return coinsValue(coins), spendableOutputs
 }
 
 // FindUTXO finds all UTXO in the UTXO Set for a given unlockingData key (e.g., address)
@@ -72,6 +88,10 @@ func (u UTXOSet) Update(transactions []*Transaction) {
 		}
 		//add new output from the new set of transactions
 		for index, txOutput := range tx.Vout{
+			//data carrier outputs are unspendable
+			if txOutput.IsDataCarrier() {
+				continue
+			}
 			txIDString:=fmt.Sprintf("%x", tx.ID)
 			if u[txIDString]==nil{
 				m := make(map[int]TXOutput)
@@ -1,25 +1,36 @@
 package main
 
 import (
-	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/x509"
-	"encoding/pem"
+	"errors"
+	"math/big"
 
+	secp "github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 	"golang.org/x/crypto/ripemd160"
 )
 
-const (
-	version            = byte(0x00)
-	addressChecksumLen = 4
+var (
+	ErrInvalidPrivateKey = errors.New("invalid private key")
 )
 
-// newKeyPair creates a new cryptographic key pair
+const addressChecksumLen = 4
+
+// newKeyPair creates a new cryptographic key pair on the curve of the network
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var privateKey *ecdsa.PrivateKey
+	var err error
+	if keyParams.Curve == S256() {
+		var key *secp.PrivateKey
+		key, err = secp.GeneratePrivateKey()
+		if err == nil {
+			privateKey = key.ToECDSA()
+		}
+	} else {
+		privateKey, err = ecdsa.GenerateKey(keyParams.Curve, rand.Reader)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -27,25 +38,106 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	return *privateKey, pubKeyToByte(publicKey)
 }
 
-// pubKeyToByte converts the ecdsa.PublicKey to a concatenation of its coordinates in bytes
+// pubKeyToByte returns the SEC1 encoding of the ecdsa.PublicKey, compressed
+// or not depending on the network, with coordinates of fixed size
 func pubKeyToByte(pubkey ecdsa.PublicKey) []byte {
 	// step 1 of: https://en.bitcoin.it/wiki/Technical_background_of_version_1_Bitcoin_addresses#How_to_create_Bitcoin_Address
-	pubKeyByte:=[]byte{}
-	pubKeyByte = append(pubKeyByte, pubkey.X.Bytes()...)
-	pubKeyByte = append(pubKeyByte, pubkey.Y.Bytes()...)
-	return pubKeyByte
+	return marshalPubKey(pubkey.Curve, pubkey.X, pubkey.Y, keyParams.CompressedPubKeys)
+}
+
+// signDigest signs the digest and returns the signature in the encoding
+// of the network. secp256k1 keys are signed in constant time with RFC 6979
+// nonces. S is normalized to the lower half of the curve order, so that
+// the signature cannot be altered by negating it.
+func signDigest(privKey ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	var r, s *big.Int
+	if privKey.Curve == S256() {
+		key := secp.PrivKeyFromBytes(privKey.D.FillBytes(make([]byte, 32)))
+		defer key.Zero()
+		sig := secpecdsa.Sign(key, digest)
+		sigR, sigS := sig.R(), sig.S()
+		rBytes, sBytes := sigR.Bytes(), sigS.Bytes()
+		r, s = new(big.Int).SetBytes(rBytes[:]), new(big.Int).SetBytes(sBytes[:])
+	} else {
+		var err error
+		r, s, err = ecdsa.Sign(rand.Reader, &privKey, digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	n := privKey.Curve.Params().N
+	if isHighS(n, s) {
+		s.Sub(n, s)
+	}
+	return encodeSignature(privKey.Curve, r, s, keyParams.SigEncoding)
+}
+
+// isHighS reports whether s is in the upper half of the curve order
+func isHighS(n, s *big.Int) bool {
+	return s.Cmp(new(big.Int).Rsh(n, 1)) > 0
+}
+
+// verifySignature verifies the signature of the payload with the public
+// key, both in the encodings of the network. x-only public keys are
+// verified with Schnorr. ECDSA signatures with S in the upper half of the
+// curve order are rejected, as signDigest never produces them.
+func verifySignature(pubKey, payload, signature []byte) bool {
+	if len(signature) == 0 || len(pubKey) == 0 {
+		return false
+	}
+	if len(pubKey) == SchnorrPubKeySize {
+		return schnorrEnabled() && SchnorrVerify(pubKey, payload, signature)
+	}
+	ecdsaPubKey, err := ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	r, s, err := decodeSignature(keyParams.Curve, signature, keyParams.SigEncoding)
+	if err != nil || isHighS(keyParams.Curve.Params().N, s) {
+		return false
+	}
+	if keyParams.Curve == S256() {
+		var sigR, sigS secp.ModNScalar
+		sigR.SetByteSlice(r.Bytes())
+		sigS.SetByteSlice(s.Bytes())
+		var x, y secp.FieldVal
+		x.SetByteSlice(ecdsaPubKey.X.Bytes())
+		y.SetByteSlice(ecdsaPubKey.Y.Bytes())
+		return secpecdsa.NewSignature(&sigR, &sigS).Verify(payload, secp.NewPublicKey(&x, &y))
+	}
+	return ecdsa.Verify(ecdsaPubKey, payload, r, s)
 }
 
 // GetAddress returns address
 // https://en.bitcoin.it/wiki/Technical_background_of_version_1_Bitcoin_addresses#How_to_create_Bitcoin_Address
 func GetAddress(pubKeyBytes []byte) []byte {
 	hashRipemd160:=HashPubKey(pubKeyBytes)
-	version:=[]byte{version}
-	versionedPayload:=append(version,hashRipemd160...)
-	checksum:=checksum(versionedPayload)
-	appendChecksum:=append(versionedPayload,checksum...)
-	address:=Base58Encode(appendChecksum)
-	return address
+	return encodeAddress(netParams.PubKeyHashAddrID, hashRipemd160)
+}
+
+// GetScriptAddress returns the pay to script hash address of a redeem script
+func GetScriptAddress(redeemScript Script) string {
+	return string(encodeAddress(netParams.ScriptHashAddrID, HashPubKey(redeemScript)))
+}
+
+// encodeAddress returns the Base58Check encoding of the versioned hash
+func encodeAddress(addressVersion byte, hash []byte) []byte {
+	versionedPayload := append([]byte{addressVersion}, hash...)
+	checksum := checksum(versionedPayload)
+	appendChecksum := append(versionedPayload, checksum...)
+	return Base58Encode(appendChecksum)
+}
+
+// GetWitnessAddress returns the Bech32 pay to witness public key hash address
+func GetWitnessAddress(pubKeyBytes []byte) string {
+	address := &Address{Type: AddressP2WPKH, Hash: HashPubKey(pubKeyBytes)}
+	return address.String()
+}
+
+// IsScriptAddress checks whether the address pays to a script hash
+func IsScriptAddress(address string) bool {
+	addr, err := ParseAddress(address)
+	return err == nil && addr.Type == AddressP2SH
 }
 
 // GetStringAddress returns address as string
@@ -68,28 +160,20 @@ func HashPubKey(pubKey []byte) []byte {
 	return hashRipemd160
 }
 
-// GetPubKeyHashFromAddress returns the hash of the public key
-// discarding the version and the checksum
+// GetPubKeyHashFromAddress returns the hash of the public key, or of the
+// script, of an address, or nil if the address is invalid
 func GetPubKeyHashFromAddress(address string) []byte {
-	addressDecoded:=Base58Decode([]byte(address))
-	length := len(addressDecoded)
-	pubKeyHash:=addressDecoded[1:length-addressChecksumLen]
-	return pubKeyHash
-
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return nil
+	}
+	return addr.Hash
 }
 
-// ValidateAddress check if an address is valid
+// ValidateAddress check if an address is valid, see ParseAddress
 func ValidateAddress(address string) bool {
-	// Validate a address by decoding it, extracting the
-	// checksum, re-computing it using the "checksum" function
-	// and comparing both.
-	addressDecoded:=Base58Decode([]byte(address))
-	length := len(addressDecoded)
-	pubKeyHash:=addressDecoded[1:length-addressChecksumLen]
-	checksumExtracted:=addressDecoded[length-addressChecksumLen:length]
-	version:=[]byte{version}
-	versionedPayload:=append(version,pubKeyHash...)
-	return bytes.Equal(checksumExtracted,checksum(versionedPayload))
+	_, err := ParseAddress(address)
+	return err == nil
 }
 
 // Checksum generates a checksum for a public key
@@ -107,39 +191,15 @@ func checksum(payload []byte) []byte {
 	return checksum
 }
 
-func encodeKeyPair(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) (string, string) {
-	return encodePrivateKey(privateKey), encodePublicKey(publicKey)
-}
-
-func encodePrivateKey(privateKey *ecdsa.PrivateKey) string {
-	x509Encoded, _ := x509.MarshalECPrivateKey(privateKey)
-	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
-
-	return string(pemEncoded)
-}
-
-func encodePublicKey(publicKey *ecdsa.PublicKey) string {
-	x509EncodedPub, _ := x509.MarshalPKIXPublicKey(publicKey)
-	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})
-
-	return string(pemEncodedPub)
-}
-
-func decodeKeyPair(pemEncoded string, pemEncodedPub string) (*ecdsa.PrivateKey, *ecdsa.PublicKey) {
-	return decodePrivateKey(pemEncoded), decodePublicKey(pemEncodedPub)
-}
-
-func decodePrivateKey(pemEncoded string) *ecdsa.PrivateKey {
-	block, _ := pem.Decode([]byte(pemEncoded))
-	privateKey, _ := x509.ParseECPrivateKey(block.Bytes)
-
-	return privateKey
-}
-
-func decodePublicKey(pemEncodedPub string) *ecdsa.PublicKey {
-	blockPub, _ := pem.Decode([]byte(pemEncodedPub))
-	genericPubKey, _ := x509.ParsePKIXPublicKey(blockPub.Bytes)
-	publicKey := genericPubKey.(*ecdsa.PublicKey) // cast to ecdsa
-
-	return publicKey
+// privateKeyFromBytes returns the private key of the 32-byte big endian scalar
+func privateKeyFromBytes(d []byte) (ecdsa.PrivateKey, error) {
+	curve := keyParams.Curve
+	k := new(big.Int).SetBytes(d)
+	if len(d) != 32 || k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return ecdsa.PrivateKey{}, ErrInvalidPrivateKey
+	}
+	privKey := ecdsa.PrivateKey{D: k}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(d)
+	return privKey, nil
 }
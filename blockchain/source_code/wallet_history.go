@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TxDirection tells how a transaction moves the coins of a wallet
+type TxDirection int
+
+const (
+	TxIncoming TxDirection = iota // pays the wallet, e.g. a coinbase
+	TxOutgoing                    // spends coins of the wallet to other addresses
+	TxSelf                        // moves coins between addresses of the wallet
+)
+
+// String returns the name of the direction
+func (d TxDirection) String() string {
+	switch d {
+	case TxIncoming:
+		return "incoming"
+	case TxOutgoing:
+		return "outgoing"
+	default:
+		return "self"
+	}
+}
+
+// WalletTx is a transaction of the history of a wallet
+type WalletTx struct {
+	TxID           []byte
+	Direction      TxDirection
+	Amount         int      // coins received, or sent to other addresses
+	Fee            int      // fee paid by the wallet, when it funds all the inputs
+	Counterparties []string // addresses of the senders (incoming) or the recipients (outgoing)
+	Coinbase       bool
+	Height         int   // height of the block of the transaction
+	BlockTime      int64 // timestamp of the block of the transaction
+	Confirmations  int
+	Label          string
+}
+
+// String returns a line describing the transaction
+func (t WalletTx) String() string {
+	label := ""
+	if t.Label != "" {
+		label = fmt.Sprintf(" %q", t.Label)
+	}
+	return fmt.Sprintf("%x%s: %s %d, fee %d, counterparties [%s], %d confirmations, block time %d",
+		t.TxID, label, t.Direction, t.Amount, t.Fee, strings.Join(t.Counterparties, " "), t.Confirmations, t.BlockTime)
+}
+
+// TxHistory indexes the transactions of a blockchain paying or spending
+// the outputs of the public key hashes of a wallet
+type TxHistory struct {
+	pubKeyHashes map[string]bool
+	txs          map[string]*Transaction // all indexed transactions, to find the spent outputs
+	entries      []WalletTx              // sorted by height
+	height       int                     // number of indexed blocks
+}
+
+// NewTxHistory creates the history of the public key hashes in the blockchain
+func NewTxHistory(bc *Blockchain, pubKeyHashes [][]byte) *TxHistory {
+	h := &TxHistory{}
+	h.Update(bc, pubKeyHashes)
+	return h
+}
+
+// Update indexes the blocks added to the blockchain since the last update.
+// The whole blockchain is indexed again if the wallet has new public key hashes.
+func (h *TxHistory) Update(bc *Blockchain, pubKeyHashes [][]byte) {
+	for _, pubKeyHash := range pubKeyHashes {
+		if !h.pubKeyHashes[Bytes2Hex(pubKeyHash)] {
+			h.reset(pubKeyHashes)
+			break
+		}
+	}
+	for ; h.height < len(bc.blocks); h.height++ {
+		block := bc.blocks[h.height]
+		for _, tx := range block.Transactions {
+			h.txs[Bytes2Hex(tx.ID)] = tx
+			if entry, ok := h.walletTx(tx); ok {
+				entry.Height, entry.BlockTime = h.height, block.Timestamp
+				h.entries = append(h.entries, entry)
+			}
+		}
+	}
+}
+
+// reset clears the index of the history of other public key hashes
+func (h *TxHistory) reset(pubKeyHashes [][]byte) {
+	h.pubKeyHashes = make(map[string]bool)
+	for _, pubKeyHash := range pubKeyHashes {
+		h.pubKeyHashes[Bytes2Hex(pubKeyHash)] = true
+	}
+	h.txs = make(map[string]*Transaction)
+	h.entries = nil
+	h.height = 0
+}
+
+// isMine checks whether the output pays to a public key hash of the wallet
+func (h *TxHistory) isMine(out TXOutput) bool {
+	pubKeyHash := out.LockingScript().PubKeyHash()
+	return pubKeyHash != nil && h.pubKeyHashes[Bytes2Hex(pubKeyHash)]
+}
+
+// walletTx returns the entry of a transaction paying or spending the
+// coins of the wallet
+func (h *TxHistory) walletTx(tx *Transaction) (WalletTx, bool) {
+	received, sent, inputs, outputs := 0, 0, 0, 0
+	allMine := true
+	senders := []string{}
+	for _, in := range tx.Vin {
+		if tx.IsCoinbase() {
+			break
+		}
+		prevTx, ok := h.txs[Bytes2Hex(in.Txid)]
+		if !ok || in.OutIdx < 0 || in.OutIdx >= len(prevTx.Vout) {
+			allMine = false
+			continue
+		}
+		prevOut := prevTx.Vout[in.OutIdx]
+		inputs += prevOut.Value
+		if h.isMine(prevOut) {
+			sent += prevOut.Value
+		} else {
+			allMine = false
+			senders = appendAddress(senders, prevOut)
+		}
+	}
+	external := 0
+	recipients := []string{}
+	for _, out := range tx.Vout {
+		outputs += out.Value
+		if h.isMine(out) {
+			received += out.Value
+		} else if out.Value > 0 {
+			external += out.Value
+			recipients = appendAddress(recipients, out)
+		}
+	}
+	if received == 0 && sent == 0 {
+		return WalletTx{}, false
+	}
+	entry := WalletTx{TxID: tx.ID, Coinbase: tx.IsCoinbase()}
+	switch {
+	case sent == 0:
+		entry.Direction, entry.Amount, entry.Counterparties = TxIncoming, received, senders
+	case external == 0:
+		entry.Direction = TxSelf
+	default:
+		entry.Direction, entry.Amount, entry.Counterparties = TxOutgoing, sent-received, recipients
+	}
+	if sent > 0 && allMine {
+		entry.Fee = inputs - outputs
+		if entry.Direction == TxOutgoing {
+			entry.Amount -= entry.Fee
+		}
+	}
+	return entry, true
+}
+
+// appendAddress appends the address the output pays to, if it has one
+// and is not in the addresses yet
+func appendAddress(addresses []string, out TXOutput) []string {
+	address := outputAddress(out)
+	if address == "" {
+		return addresses
+	}
+	for _, a := range addresses {
+		if a == address {
+			return addresses
+		}
+	}
+	return append(addresses, address)
+}
+
+// outputAddress returns the address an output pays to, or "" if its
+// locking script has no address
+func outputAddress(out TXOutput) string {
+	script := out.LockingScript()
+	var addr *Address
+	var err error
+	switch {
+	case script.IsP2PKH():
+		addr, err = NewAddress(AddressP2PKH, script.PubKeyHash())
+	case script.IsP2WPKH():
+		addr, err = NewAddress(AddressP2WPKH, script.PubKeyHash())
+	case script.IsP2SH():
+		addr, err = NewAddress(AddressP2SH, script.ScriptHash())
+	default:
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// List returns the transactions of the history, the most recent first,
+// with their confirmations in the blockchain
+func (h *TxHistory) List(bc *Blockchain) []WalletTx {
+	list := make([]WalletTx, len(h.entries))
+	copy(list, h.entries)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Height > list[j].Height })
+	for i := range list {
+		list[i].Confirmations = len(bc.blocks) - list[i].Height
+	}
+	return list
+}
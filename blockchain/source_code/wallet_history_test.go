@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestListTransactions(t *testing.T) {
+	privKey, pubKey := newKeyPair()
+	_, bobPubKey := newKeyPair()
+	bc, coinbaseTX := newTestChain(t, pubKey)
+	acc := newTestSwapAccount("alice", privKey, bc)
+	bob := GetStringAddress(GetAddress(bobPubKey))
+	value := coinbaseTX.Vout[0].Value
+	sendTX := newTestSpend(t, privKey, coinbaseTX, []int{0}, []TXOutput{*NewTXOutput(3, bob), *NewTXOutput(value-4, acc.Address)})
+	block := mineTestBlock(t, bc, bobPubKey, sendTX)
+	acc.Labels.SetTransaction(sendTX.ID, "rent")
+
+	list, err := acc.ListTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WalletTx{
+		{TxID: sendTX.ID, Direction: TxOutgoing, Amount: 3, Fee: 1, Counterparties: []string{bob}, Height: 2, BlockTime: block.Timestamp, Confirmations: 1, Label: "rent"},
+		{TxID: coinbaseTX.ID, Direction: TxIncoming, Amount: value, Counterparties: []string{}, Coinbase: true, Height: 1, BlockTime: bc.blocks[1].Timestamp, Confirmations: 2},
+	}
+	diff(t, want, list, "transactions")
+}
+
+func TestLabels(t *testing.T) {
+	_, pubKey := newKeyPair()
+	address := GetStringAddress(GetAddress(pubKey))
+	labels := NewLabels()
+	if err := labels.SetAddress("not an address", "bob"); err == nil {
+		t.Error("label of an invalid address accepted")
+	}
+	if err := labels.SetAddress(address, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	found, err := labels.FindAddress("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, address, found, "address of the label")
+	if _, err := labels.FindAddress("carol"); err != ErrLabelNotFound {
+		t.Errorf("unknown label: got %v, want %v", err, ErrLabelNotFound)
+	}
+	if err := labels.SetAddress(address, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := labels.FindAddress("bob"); err != ErrLabelNotFound {
+		t.Errorf("removed label: got %v, want %v", err, ErrLabelNotFound)
+	}
+}
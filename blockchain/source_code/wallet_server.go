@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+// WalletServer exposes the wallet of an account to local clients with
+// line-delimited JSON-RPC messages, as the PoolServer:
+//
+//	getbalance  []                                   -> balance
+//	sendmany    [{address: amount, ...}, (fee rate)] -> hex ID of the transaction
+//	bumpfee     [hex ID, fee rate]                   -> hex ID of the replacement
+//	cpfp        [hex ID, fee rate]                   -> hex ID of the child
+//	estimatefee [blocks, (confidence)]               -> fee rate
+//
+// The transactions are signed by the account and added to the mempool,
+// to be mined. The fee rate is in coins per 1000 bytes, the one of the
+// funding options of the account if omitted. bumpfee replaces a
+// transaction of the account signaling replaceability, cpfp spends the
+// outputs of the account of a transaction of the mempool. estimatefee
+// returns the fee rate confirming within the blocks with the confidence,
+// between 0 and 1, DefaultFeeConfidence if omitted.
+type WalletServer struct {
+	acc      Account
+	mempool  *Mempool
+	calls    chan<- func() // requests run by the goroutine owning the blockchain
+	listener net.Listener
+}
+
+// NewWalletServer creates a server for the wallet of the account, sending
+// its transactions to the mempool. The requests are sent to calls, to be
+// run one at a time by the goroutine adding the blocks to the blockchain
+// of the account (see Users.HandleChannel), so that they never read the
+// blockchain while a block is added.
+func NewWalletServer(acc Account, mempool *Mempool, calls chan<- func()) *WalletServer {
+	return &WalletServer{acc: acc, mempool: mempool, calls: calls}
+}
+
+// Listen starts accepting clients on the given address
+func (s *WalletServer) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.acceptLoop()
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *WalletServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the server
+func (s *WalletServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *WalletServer) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *WalletServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			enc.Encode(stratumResponse{Error: errorString(err)})
+			continue
+		}
+		result, err := s.handle(req)
+		enc.Encode(stratumResponse{ID: req.ID, Result: result, Error: errorString(err)})
+	}
+}
+
+// handle runs a client request on the goroutine owning the blockchain
+func (s *WalletServer) handle(req stratumRequest) (result interface{}, err error) {
+	done := make(chan struct{})
+	s.calls <- func() {
+		defer close(done)
+		result, err = s.dispatch(req)
+	}
+	<-done
+	return result, err
+}
+
+// dispatch runs a client request with the wallet
+func (s *WalletServer) dispatch(req stratumRequest) (interface{}, error) {
+	switch req.Method {
+	case "getbalance":
+		return s.acc.GetBalance(), nil
+	case "sendmany":
+		var amounts map[string]int
+		opts := s.acc.Funding
+		if len(req.Params) < 1 || len(req.Params) > 2 ||
+			json.Unmarshal(req.Params[0], &amounts) != nil ||
+			(len(req.Params) == 2 && json.Unmarshal(req.Params[1], &opts.FeeRate) != nil) {
+			return nil, ErrInvalidParams
+		}
+		return s.sendMany(NewPaymentRequest(amounts), opts)
+	case "bumpfee", "cpfp":
+		var txID string
+		var feeRate int
+		if len(req.Params) != 2 || json.Unmarshal(req.Params[0], &txID) != nil ||
+			json.Unmarshal(req.Params[1], &feeRate) != nil {
+			return nil, ErrInvalidParams
+		}
+		bump := s.acc.BumpFee
+		if req.Method == "cpfp" {
+			bump = s.acc.BumpFeeCPFP
+		}
+		tx, err := bump(s.mempool, Hex2Bytes(txID), feeRate)
+		if err != nil {
+			return nil, err
+		}
+		return Bytes2Hex(tx.ID), nil
+	case "estimatefee":
+		var target int
+		confidence := DefaultFeeConfidence
+		if len(req.Params) < 1 || len(req.Params) > 2 || json.Unmarshal(req.Params[0], &target) != nil ||
+			(len(req.Params) == 2 && json.Unmarshal(req.Params[1], &confidence) != nil) {
+			return nil, ErrInvalidParams
+		}
+		return s.mempool.FeeEstimator().EstimateFeeRate(target, confidence)
+	}
+	return nil, errors.New("unknown method " + req.Method)
+}
+
+// sendMany pays the request with the coins of the account not spent in
+// the mempool, and adds the transaction to the mempool
+func (s *WalletServer) sendMany(request PaymentRequest, opts FundingOptions) (string, error) {
+	utxos := s.acc.Blockchain.FindUTXOSet()
+	s.mempool.ExcludeSpent(utxos)
+	tx, err := s.acc.produceBatchTransferTx(request, utxos, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := s.mempool.Add(tx); err != nil {
+		return "", err
+	}
+	return Bytes2Hex(tx.ID), nil
+}
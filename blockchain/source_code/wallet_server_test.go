@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+// newTestWalletServer starts a wallet server of a new account, its calls
+// run by a goroutine as Users.HandleChannel does, and connects to it
+func newTestWalletServer(t *testing.T) (*Mempool, func(req string) stratumResponse) {
+	t.Helper()
+	privKey, _ := newKeyPair()
+	mempool, acc := newTestMempool(t, "alice", privKey)
+	calls := make(chan func())
+	go func() {
+		for call := range calls {
+			call()
+		}
+	}()
+	server := NewWalletServer(acc, mempool, calls)
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+		close(calls)
+	})
+	scanner := bufio.NewScanner(conn)
+	return mempool, func(req string) stratumResponse {
+		t.Helper()
+		if _, err := conn.Write([]byte(req + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if !scanner.Scan() {
+			t.Fatalf("no response to %s: %v", req, scanner.Err())
+		}
+		var resp stratumResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+}
+
+func TestWalletServerSendMany(t *testing.T) {
+	mempool, call := newTestWalletServer(t)
+	resp := call(`{"id":1,"method":"getbalance","params":[]}`)
+	if resp.Error != nil {
+		t.Fatal(*resp.Error)
+	}
+	diff(t, float64(40), resp.Result, "balance")
+
+	_, bobPubKey := newKeyPair()
+	_, carolPubKey := newKeyPair()
+	bob := GetStringAddress(GetAddress(bobPubKey))
+	carol := GetStringAddress(GetAddress(carolPubKey))
+	resp = call(`{"id":2,"method":"sendmany","params":[{"` + bob + `":5,"` + carol + `":3}]}`)
+	if resp.Error != nil {
+		t.Fatal(*resp.Error)
+	}
+	diff(t, 2, resp.ID, "response ID")
+	txID, ok := resp.Result.(string)
+	if !ok {
+		t.Fatalf("result %v is not a transaction ID", resp.Result)
+	}
+	tx, err := mempool.Get(Hex2Bytes(txID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := map[string]int{}
+	for _, out := range tx.Vout {
+		paid[Bytes2Hex(out.PubKeyHash)] += out.Value
+	}
+	diff(t, []int{5, 3}, []int{paid[Bytes2Hex(HashPubKey(bobPubKey))], paid[Bytes2Hex(HashPubKey(carolPubKey))]}, "payments")
+}
+
+func TestWalletServerErrors(t *testing.T) {
+	_, call := newTestWalletServer(t)
+	_, bobPubKey := newKeyPair()
+	bob := GetStringAddress(GetAddress(bobPubKey))
+	for _, test := range []struct {
+		req, err string
+	}{
+		{`{"id":1,"method":"sendmany","params":["x"]}`, ErrInvalidParams.Error()},
+		{`{"id":1,"method":"sendmany","params":[]}`, ErrInvalidParams.Error()},
+		{`{"id":1,"method":"sendmany","params":[{"` + bob + `":5},"x"]}`, ErrInvalidParams.Error()},
+		{`{"id":1,"method":"sendmany","params":[{"` + bob + `":0}]}`, ErrInvalidPayment.Error()},
+		{`{"id":1,"method":"bumpfee","params":["00"]}`, ErrInvalidParams.Error()},
+		{`{"id":1,"method":"estimatefee","params":[]}`, ErrInvalidParams.Error()},
+		{`{"id":1,"method":"getbalances","params":[]}`, "unknown method getbalances"},
+	} {
+		resp := call(test.req)
+		if resp.Error == nil {
+			t.Errorf("%s: got result %v, want error %q", test.req, resp.Result, test.err)
+			continue
+		}
+		diff(t, test.err, *resp.Error, test.req)
+	}
+}
+
+func TestPaymentRequestValidate(t *testing.T) {
+	_, bobPubKey := newKeyPair()
+	bob := GetStringAddress(GetAddress(bobPubKey))
+	payment, err := ParsePayment(bob + " 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff(t, Payment{Address: bob, Amount: 5}, payment, "payment")
+	for _, s := range []string{bob, bob + " five", bob + " 5 6"} {
+		if _, err := ParsePayment(s); err != ErrInvalidPayment {
+			t.Errorf("parsing %q: got %v, want %v", s, err, ErrInvalidPayment)
+		}
+	}
+
+	if err := (PaymentRequest{payment}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, test := range []struct {
+		request PaymentRequest
+		err     error
+	}{
+		{PaymentRequest{}, ErrInvalidPayment},
+		{PaymentRequest{{Address: bob, Amount: -1}}, ErrInvalidPayment},
+		{PaymentRequest{payment, payment}, ErrDuplicatePayment},
+	} {
+		if err := test.request.Validate(); err != test.err {
+			t.Errorf("validating %v: got %v, want %v", test.request, err, test.err)
+		}
+	}
+}
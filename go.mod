@@ -3,6 +3,7 @@ module dat650
 go 1.17
 
 require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.3.0
 	github.com/google/go-cmp v0.5.4
 	github.com/manifoldco/promptui v0.8.0
 	github.com/stretchr/testify v1.7.0